@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type archiveChatBody struct {
+	Archived *bool `json:"archived"`
+}
+
+type archiveChatHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewArchiveChatHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *archiveChatHandler {
+	return &archiveChatHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Archive WhatsApp Chat
+//
+//	@Summary		Archive WhatsApp Chat
+//	@Description	Archives or unarchives a chat. Archiving also unpins it.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Param			data		body	archiveChatBody	true	"Archive state"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Chat archived or unarchived"
+//	@Router			/{instanceId}/chats/{jid}/archive [post]
+func (h *archiveChatHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	var body archiveChatBody
+	if err := c.ShouldBindJSON(&body); err != nil || body.Archived == nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	err = h.whatsAppService.ArchiveChat(instance, jid, *body.Archived)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
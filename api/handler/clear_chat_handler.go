@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type clearChatHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewClearChatHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *clearChatHandler {
+	return &clearChatHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Clear WhatsApp Chat
+//
+//	@Summary		Clear WhatsApp Chat
+//	@Description	Deletes all messages of a chat but keeps the chat.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Chat cleared"
+//	@Router			/{instanceId}/chats/{jid}/clear [post]
+func (h *clearChatHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	err = h.whatsAppService.ClearChat(instance, jid)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type createApiTokenBody struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type createApiTokenHandler struct {
+	apiTokenService service.ApiTokenService
+}
+
+func NewCreateApiTokenHandler(
+	apiTokenService service.ApiTokenService,
+) *createApiTokenHandler {
+	return &createApiTokenHandler{
+		apiTokenService: apiTokenService,
+	}
+}
+
+// Create API Token
+//
+//	@Summary		Create API Token
+//	@Description	Creates a token that authenticates requests to the routes of the specified instance only, sent as "Authorization: Bearer <token>" or "X-API-Key: <token>". Scopes can be read, send and admin, where admin includes the others and is the default. The token is only returned once. Tokens can only be managed while API_KEY is set.
+//	@Tags			API Tokens
+//	@Param			instanceId	path	string				true	"Instance ID"
+//	@Param			data		body	createApiTokenBody	true	"API token"
+//	@Accept			json
+//	@Produce		json
+//	@Success		201	{object}	response.ApiTokenSecret	"API token"
+//	@Router			/{instanceId}/tokens [post]
+func (h *createApiTokenHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+
+	var body createApiTokenBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	if len(body.Scopes) == 0 {
+		body.Scopes = []string{model.ScopeAdmin}
+	}
+
+	for _, scope := range body.Scopes {
+		switch scope {
+		case model.ScopeRead, model.ScopeSend, model.ScopeAdmin:
+		default:
+			response.ErrorResponse(c, http.StatusBadRequest, "Invalid scope: "+scope)
+			return
+		}
+	}
+
+	token, secret, err := h.apiTokenService.CreateToken(instanceID, body.Name, body.Scopes)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusCreated, response.NewApiTokenSecretResponse(*token, secret))
+}
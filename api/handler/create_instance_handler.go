@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+	"zapmeow/pkg/whatsapp"
+	"zapmeow/pkg/zapmeow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// instance IDs are used in URLs and storage paths
+var instanceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type createInstanceBody struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Tenant     string `json:"tenant"`
+	WebhookURL string `json:"webhook_url"`
+	ProxyURL   string `json:"proxy_url"`
+	// DeviceName, DevicePlatform and DeviceBrowserLabel default to the
+	// settings of the server
+	DeviceName         string `json:"device_name"`
+	DevicePlatform     string `json:"device_platform"`
+	DeviceBrowserLabel string `json:"device_browser_label"`
+}
+
+type createInstanceHandler struct {
+	app             *zapmeow.ZapMeow
+	whatsAppService service.WhatsAppService
+	accountService  service.AccountService
+}
+
+func NewCreateInstanceHandler(
+	app *zapmeow.ZapMeow,
+	whatsAppService service.WhatsAppService,
+	accountService service.AccountService,
+) *createInstanceHandler {
+	return &createInstanceHandler{
+		app:             app,
+		whatsAppService: whatsAppService,
+		accountService:  accountService,
+	}
+}
+
+// Create Instance
+//
+//	@Summary		Create Instance
+//	@Description	Creates an instance, to be paired through its QR code or a phone number. A random ID is generated when none is given. Messages of instances with their own webhook are sent to it instead of the default one, and instances with a proxy connect to WhatsApp through it. The device name, platform (e.g. CHROME or DESKTOP) and browser label (e.g. "Chrome (Linux)") are how the instance shows up in the linked devices of the phone, and default to the settings of the server.
+//	@Tags			Instances
+//	@Param			data	body	createInstanceBody	true	"Instance"
+//	@Accept			json
+//	@Produce		json
+//	@Success		201	{object}	response.Instance	"Created instance"
+//	@Router			/instances [post]
+func (h *createInstanceHandler) Handler(c *gin.Context) {
+	var body createInstanceBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	if body.ID == "" {
+		id, err := helper.MakeInstanceID()
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		body.ID = id
+	} else if !instanceIDPattern.MatchString(body.ID) {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid instance ID")
+		return
+	}
+
+	if body.WebhookURL != "" {
+		if webhookURL, err := url.ParseRequestURI(body.WebhookURL); err != nil || webhookURL.Host == "" {
+			response.ErrorResponse(c, http.StatusBadRequest, "Invalid webhook URL")
+			return
+		}
+	}
+
+	if body.ProxyURL != "" {
+		if _, err := helper.ParseProxyURL(body.ProxyURL); err != nil {
+			response.ErrorResponse(c, http.StatusBadRequest, "Invalid proxy URL. "+err.Error())
+			return
+		}
+	}
+
+	if body.DeviceName == "" {
+		body.DeviceName = h.app.Config.DeviceName
+	}
+	if body.DevicePlatform == "" {
+		body.DevicePlatform = h.app.Config.DevicePlatform
+	}
+	if body.DeviceBrowserLabel == "" {
+		body.DeviceBrowserLabel = h.app.Config.DeviceBrowserLabel
+	}
+
+	if len(body.DeviceName) > 64 {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid device name")
+		return
+	}
+	if !whatsapp.IsValidPlatform(body.DevicePlatform) {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid device platform")
+		return
+	}
+	if !whatsapp.IsValidBrowserLabel(body.DeviceBrowserLabel) {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid device browser label")
+		return
+	}
+
+	h.app.Mutex.Lock()
+	defer h.app.Mutex.Unlock()
+	account, err := h.accountService.GetAccountByInstanceID(body.ID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account != nil {
+		response.ErrorResponse(c, http.StatusConflict, "Instance already exists")
+		return
+	}
+
+	account = &model.Account{
+		InstanceID: body.ID,
+		Name:       body.Name,
+		Tenant:     body.Tenant,
+		WebhookURL: body.WebhookURL,
+		ProxyURL:   body.ProxyURL,
+		Status:     "UNPAIRED",
+
+		DeviceName:         body.DeviceName,
+		DevicePlatform:     body.DevicePlatform,
+		DeviceBrowserLabel: body.DeviceBrowserLabel,
+	}
+	if err := h.accountService.CreateAccount(account); err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusCreated, response.NewInstanceResponse(
+		*account,
+		h.whatsAppService.GetInstanceStatus(*account),
+	))
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type deleteChatHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewDeleteChatHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *deleteChatHandler {
+	return &deleteChatHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Delete WhatsApp Chat
+//
+//	@Summary		Delete WhatsApp Chat
+//	@Description	Deletes a chat and all of its messages.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Chat deleted"
+//	@Router			/{instanceId}/chats/{jid} [delete]
+func (h *deleteChatHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	err = h.whatsAppService.DeleteChat(instance, jid)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
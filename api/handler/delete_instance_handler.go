@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+	"zapmeow/pkg/zapmeow"
+
+	"github.com/gin-gonic/gin"
+)
+
+type deleteInstanceHandler struct {
+	app             *zapmeow.ZapMeow
+	whatsAppService service.WhatsAppService
+	accountService  service.AccountService
+}
+
+func NewDeleteInstanceHandler(
+	app *zapmeow.ZapMeow,
+	whatsAppService service.WhatsAppService,
+	accountService service.AccountService,
+) *deleteInstanceHandler {
+	return &deleteInstanceHandler{
+		app:             app,
+		whatsAppService: whatsAppService,
+		accountService:  accountService,
+	}
+}
+
+// Delete Instance
+//
+//	@Summary		Delete Instance
+//	@Description	Logs the specified instance out of WhatsApp and deletes it along with its messages, chats, media, settings, rate limits, send jobs and API tokens.
+//	@Tags			Instances
+//	@Param			id	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Instance deleted"
+//	@Router			/instances/{id} [delete]
+func (h *deleteInstanceHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("id")
+
+	h.app.Mutex.Lock()
+	defer h.app.Mutex.Unlock()
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	if err := h.whatsAppService.DeleteInstance(instanceID); err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+	"zapmeow/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type exportChatHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+	exportService   service.ExportService
+}
+
+func NewExportChatHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+	exportService service.ExportService,
+) *exportChatHandler {
+	return &exportChatHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+		exportService:   exportService,
+	}
+}
+
+// Export WhatsApp Chat
+//
+//	@Summary		Export WhatsApp Chat
+//	@Description	Streams a zip archive with the full chat transcript (JSON, CSV or WhatsApp-style TXT) and the media files it references. Media that expired or wasn't downloaded is flagged in the transcript, and an errors.txt entry lists media that went missing or the error that cut the export short.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Param			format		query	string	false	"Transcript format: json (default), csv or txt"
+//	@Produce		application/zip
+//	@Success		200	{file}	file	"Zip archive"
+//	@Router			/{instanceId}/chats/{jid}/export [get]
+func (h *exportChatHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	format := service.ExportFormat(c.DefaultQuery("format", string(service.ExportJSON)))
+	if !format.IsValid() {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid format")
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="chat_%s_%s.zip"`, jid.User, format))
+	c.Status(http.StatusOK)
+
+	// the archive is streamed, so errors can't change the status anymore.
+	// When the archive can't be completed, the connection is dropped, so the
+	// client sees the download fail instead of a truncated archive.
+	err = h.exportService.ExportChat(c.Writer, instanceID, jid.User, format)
+	if err != nil {
+		logger.Error("Failed to export chat. ", err)
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+		c.Abort()
+	}
+}
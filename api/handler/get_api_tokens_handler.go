@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getApiTokensResponse struct {
+	Tokens []response.ApiToken `json:"tokens"`
+}
+
+type getApiTokensHandler struct {
+	apiTokenService service.ApiTokenService
+}
+
+func NewGetApiTokensHandler(
+	apiTokenService service.ApiTokenService,
+) *getApiTokensHandler {
+	return &getApiTokensHandler{
+		apiTokenService: apiTokenService,
+	}
+}
+
+// Get API Tokens
+//
+//	@Summary		Get API Tokens
+//	@Description	Returns the API tokens of the specified instance, without the tokens themselves.
+//	@Tags			API Tokens
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	getApiTokensResponse	"API tokens"
+//	@Router			/{instanceId}/tokens [get]
+func (h *getApiTokensHandler) Handler(c *gin.Context) {
+	tokens, err := h.apiTokenService.GetTokens(c.Param("instanceId"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, getApiTokensResponse{
+		Tokens: response.NewApiTokensResponse(tokens),
+	})
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getChatResponse struct {
+	Chat response.Chat `json:"chat"`
+}
+
+type getChatHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewGetChatHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *getChatHandler {
+	return &getChatHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Get WhatsApp Chat
+//
+//	@Summary		Get WhatsApp Chat
+//	@Description	Returns a chat with its last message, unread count and settings (archived, pinned, muted, marked as unread).
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Produce		json
+//	@Success		200	{object}	getChatResponse	"Chat"
+//	@Router			/{instanceId}/chats/{jid} [get]
+func (h *getChatHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	chat, err := h.chatService.GetChat(instanceID, jid.User)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if chat == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	settings, err := h.chatService.GetChatSettings(instanceID, []string{chat.ChatJID})
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chat.Name = h.whatsAppService.GetChatName(instance, *chat)
+	response.Response(c, http.StatusOK, getChatResponse{
+		Chat: response.NewChatResponse(*chat, settings[chat.ChatJID]),
+	})
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/helper"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getChatsResponse struct {
+	Chats []response.Chat `json:"chats"`
+	Total int64           `json:"total"`
+}
+
+type getChatsHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewGetChatsHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *getChatsHandler {
+	return &getChatsHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Get WhatsApp Chats
+//
+//	@Summary		Get WhatsApp Chats
+//	@Description	Returns the chats of the specified instance with their last message, unread count and settings, most recent first.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			limit		query	int		false	"Page size (default 20, max 100)"
+//	@Param			offset		query	int		false	"Page offset"
+//	@Produce		json
+//	@Success		200	{object}	getChatsResponse	"List of chats"
+//	@Router			/{instanceId}/chats [get]
+func (h *getChatsHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	limit, offset, err := helper.MakePagination(c.Query("limit"), c.Query("offset"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chats, err := h.chatService.GetChats(instanceID, limit, offset)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	total, err := h.chatService.CountChats(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chatJIDs := make([]string, len(chats))
+	for i := range chats {
+		chats[i].Name = h.whatsAppService.GetChatName(instance, chats[i])
+		chatJIDs[i] = chats[i].ChatJID
+	}
+
+	settings, err := h.chatService.GetChatSettings(instanceID, chatJIDs)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, getChatsResponse{
+		Chats: response.NewChatsResponse(chats, settings),
+		Total: total,
+	})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type historySyncProgressResponse struct {
+	Syncs []response.HistorySyncProgress `json:"syncs"`
+}
+
+type getHistorySyncProgressHandler struct {
+	accountService             service.AccountService
+	historySyncProgressService service.HistorySyncProgressService
+}
+
+func NewGetHistorySyncProgressHandler(
+	accountService service.AccountService,
+	historySyncProgressService service.HistorySyncProgressService,
+) *getHistorySyncProgressHandler {
+	return &getHistorySyncProgressHandler{
+		accountService:             accountService,
+		historySyncProgressService: historySyncProgressService,
+	}
+}
+
+// Get History Sync Progress
+//
+//	@Summary		Get History Sync Progress
+//	@Description	Returns the progress of the history syncs of the specified instance, per sync type.
+//	@Tags			WhatsApp History
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	historySyncProgressResponse	"History sync progress"
+//	@Router			/{instanceId}/sync [get]
+func (h *getHistorySyncProgressHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	progress, err := h.historySyncProgressService.GetProgressByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, historySyncProgressResponse{
+		Syncs: response.NewHistorySyncProgressesResponse(progress),
+	})
+}
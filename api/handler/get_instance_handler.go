@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getInstanceHandler struct {
+	whatsAppService service.WhatsAppService
+	accountService  service.AccountService
+}
+
+func NewGetInstanceHandler(
+	whatsAppService service.WhatsAppService,
+	accountService service.AccountService,
+) *getInstanceHandler {
+	return &getInstanceHandler{
+		whatsAppService: whatsAppService,
+		accountService:  accountService,
+	}
+}
+
+// Get Instance
+//
+//	@Summary		Get Instance
+//	@Description	Returns the specified instance with its status, without connecting it.
+//	@Tags			Instances
+//	@Param			id	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	response.Instance	"Instance"
+//	@Router			/instances/{id} [get]
+func (h *getInstanceHandler) Handler(c *gin.Context) {
+	account, err := h.accountService.GetAccountByInstanceID(c.Param("id"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	response.Response(c, http.StatusOK, response.NewInstanceResponse(
+		*account,
+		h.whatsAppService.GetInstanceStatus(*account),
+	))
+}
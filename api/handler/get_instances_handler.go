@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"zapmeow/api/helper"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getInstancesResponse struct {
+	Instances []response.Instance `json:"instances"`
+	Total     int                 `json:"total"`
+}
+
+type getInstancesHandler struct {
+	whatsAppService service.WhatsAppService
+	accountService  service.AccountService
+}
+
+func NewGetInstancesHandler(
+	whatsAppService service.WhatsAppService,
+	accountService service.AccountService,
+) *getInstancesHandler {
+	return &getInstancesHandler{
+		whatsAppService: whatsAppService,
+		accountService:  accountService,
+	}
+}
+
+// List Instances
+//
+//	@Summary		List Instances
+//	@Description	Returns the instances, oldest first, optionally only those of a tenant or with one of the given statuses (CONNECTED, DISCONNECTED, UNPAIRED, PAIRING or TIMEOUT).
+//	@Tags			Instances
+//	@Param			tenant	query	string	false	"Tenant"
+//	@Param			status	query	string	false	"Comma-separated statuses"
+//	@Param			limit	query	int		false	"Page size (default 20, max 100)"
+//	@Param			offset	query	int		false	"Page offset"
+//	@Produce		json
+//	@Success		200	{object}	getInstancesResponse	"Instances"
+//	@Router			/instances [get]
+func (h *getInstancesHandler) Handler(c *gin.Context) {
+	limit, offset, err := helper.MakePagination(c.Query("limit"), c.Query("offset"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statuses := make(map[string]bool)
+	for _, status := range strings.Split(c.Query("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			statuses[strings.ToUpper(status)] = true
+		}
+	}
+
+	accounts, err := h.accountService.GetAccounts(c.Query("tenant"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// the status depends on the connection, so it's filtered here
+	instances := []response.Instance{}
+	for _, account := range accounts {
+		status := h.whatsAppService.GetInstanceStatus(account)
+		if len(statuses) > 0 && !statuses[status] {
+			continue
+		}
+		instances = append(instances, response.NewInstanceResponse(account, status))
+	}
+
+	total := len(instances)
+	instances = instances[helper.Min(offset, total):helper.Min(offset+limit, total)]
+
+	response.Response(c, http.StatusOK, getInstancesResponse{
+		Instances: instances,
+		Total:     total,
+	})
+}
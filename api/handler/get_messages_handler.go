@@ -69,6 +69,7 @@ func (h *getMessagesHandler) Handler(c *gin.Context) {
 		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	h.whatsAppService.DownloadMessagesMedia(instance, *messages)
 
 	response.Response(c, http.StatusOK, getMessagesResponse{
 		Messages: response.NewMessagesResponse(messages),
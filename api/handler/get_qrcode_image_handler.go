@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"zapmeow/api/helper"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+	"zapmeow/pkg/zapmeow"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	QrCodePNG = "png"
+	QrCodeSVG = "svg"
+)
+
+const (
+	defaultQrCodeSize = 256
+	minQrCodeSize     = 64
+	maxQrCodeSize     = 1024
+)
+
+type getQrCodeImageHandler struct {
+	app             *zapmeow.ZapMeow
+	whatsAppService service.WhatsAppService
+	accountService  service.AccountService
+	format          string
+}
+
+func NewGetQrCodeImageHandler(
+	app *zapmeow.ZapMeow,
+	whatsAppService service.WhatsAppService,
+	accountService service.AccountService,
+	format string,
+) *getQrCodeImageHandler {
+	return &getQrCodeImageHandler{
+		app:             app,
+		whatsAppService: whatsAppService,
+		accountService:  accountService,
+		format:          format,
+	}
+}
+
+// Get QR Code Image for WhatsApp Login
+//
+//	@Summary		Get WhatsApp QR Code Image
+//	@Description	Returns the current QR code to initiate WhatsApp login as a PNG or SVG image. QR codes rotate, so poll this endpoint or use the QR code stream.
+//	@Tags			WhatsApp Login
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			format		path	string	true	"Image format"	Enums(png, svg)
+//	@Param			size		query	int		false	"Width and height in pixels (default 256, from 64 to 1024)"
+//	@Produce		png
+//	@Produce		image/svg+xml
+//	@Success		200	{file}	binary	"QR Code"
+//	@Router			/{instanceId}/qrcode.{format} [get]
+func (h *getQrCodeImageHandler) Handler(c *gin.Context) {
+	size := defaultQrCodeSize
+	if value := c.Query("size"); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size < minQrCodeSize || size > maxQrCodeSize {
+			response.ErrorResponse(c, http.StatusBadRequest, "Invalid size")
+			return
+		}
+	}
+
+	instanceID := c.Param("instanceId")
+	_, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.app.Mutex.Lock()
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	h.app.Mutex.Unlock()
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "Account not found")
+		return
+	}
+
+	if account.QrCode == "" {
+		response.ErrorResponse(c, http.StatusNotFound, "QR code not available")
+		return
+	}
+
+	var image []byte
+	var contentType string
+	switch h.format {
+	case QrCodeSVG:
+		image, err = helper.MakeQrCodeSVG(account.QrCode, size)
+		contentType = "image/svg+xml"
+	default:
+		image, err = helper.MakeQrCodePNG(account.QrCode, size)
+		contentType = "image/png"
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, image)
+}
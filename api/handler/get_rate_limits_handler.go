@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getRateLimitsHandler struct {
+	rateLimitService service.RateLimitService
+}
+
+func NewGetRateLimitsHandler(
+	rateLimitService service.RateLimitService,
+) *getRateLimitsHandler {
+	return &getRateLimitsHandler{
+		rateLimitService: rateLimitService,
+	}
+}
+
+// Get Rate Limits
+//
+//	@Summary		Get Rate Limits
+//	@Description	Returns the limits on the messages sent by the specified instance.
+//	@Tags			Instances
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	response.RateLimits	"Rate limits"
+//	@Router			/{instanceId}/rate-limits [get]
+func (h *getRateLimitsHandler) Handler(c *gin.Context) {
+	limits, err := h.rateLimitService.GetLimits(c.Param("instanceId"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, response.NewRateLimitsResponse(limits))
+}
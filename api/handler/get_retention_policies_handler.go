@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type retentionPoliciesResponse struct {
+	Policies []response.RetentionPolicy `json:"policies"`
+}
+
+type getRetentionPoliciesHandler struct {
+	accountService         service.AccountService
+	retentionPolicyService service.RetentionPolicyService
+}
+
+func NewGetRetentionPoliciesHandler(
+	accountService service.AccountService,
+	retentionPolicyService service.RetentionPolicyService,
+) *getRetentionPoliciesHandler {
+	return &getRetentionPoliciesHandler{
+		accountService:         accountService,
+		retentionPolicyService: retentionPolicyService,
+	}
+}
+
+// Get Media Retention Policies
+//
+//	@Summary		Get Media Retention Policies
+//	@Description	Returns the media retention policies of the specified instance.
+//	@Tags			WhatsApp Media
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	retentionPoliciesResponse	"Retention policies"
+//	@Router			/{instanceId}/retention [get]
+func (h *getRetentionPoliciesHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	policies, err := h.retentionPolicyService.GetPoliciesByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, retentionPoliciesResponse{
+		Policies: response.NewRetentionPoliciesResponse(policies),
+	})
+}
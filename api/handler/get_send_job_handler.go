@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sendJobResponse struct {
+	Job response.SendJob `json:"job"`
+}
+
+type getSendJobHandler struct {
+	sendJobService service.SendJobService
+}
+
+func NewGetSendJobHandler(
+	sendJobService service.SendJobService,
+) *getSendJobHandler {
+	return &getSendJobHandler{
+		sendJobService: sendJobService,
+	}
+}
+
+// Get Send Job
+//
+//	@Summary		Get Send Job
+//	@Description	Returns a message sent in the background with async=true. Its status is pending while it waits for its turn, a retry or the rate limits, processing while it's being sent, then succeeded, with the ID of the message, or failed, with the last error.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jobId		path	int		true	"Job ID"
+//	@Produce		json
+//	@Success		200	{object}	sendJobResponse	"Send Job"
+//	@Router			/{instanceId}/jobs/{jobId} [get]
+func (h *getSendJobHandler) Handler(c *gin.Context) {
+	jobID, err := strconv.ParseUint(c.Param("jobId"), 10, 0)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	job, err := h.sendJobService.GetJob(c.Param("instanceId"), uint(jobID))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if job == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	response.Response(c, http.StatusOK, sendJobResponse{
+		Job: response.NewSendJobResponse(*job),
+	})
+}
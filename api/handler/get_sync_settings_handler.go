@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type getSyncSettingsHandler struct {
+	accountService      service.AccountService
+	syncSettingsService service.SyncSettingsService
+}
+
+func NewGetSyncSettingsHandler(
+	accountService service.AccountService,
+	syncSettingsService service.SyncSettingsService,
+) *getSyncSettingsHandler {
+	return &getSyncSettingsHandler{
+		accountService:      accountService,
+		syncSettingsService: syncSettingsService,
+	}
+}
+
+// Get History Sync Settings
+//
+//	@Summary		Get History Sync Settings
+//	@Description	Returns how much history is imported for the specified instance.
+//	@Tags			WhatsApp History
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	response.SyncSettings	"History sync settings"
+//	@Router			/{instanceId}/sync/settings [get]
+func (h *getSyncSettingsHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	settings, err := h.syncSettingsService.GetSettings(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, response.NewSyncSettingsResponse(settings))
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type markChatUnreadBody struct {
+	Unread *bool `json:"unread"`
+}
+
+type markChatUnreadHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewMarkChatUnreadHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *markChatUnreadHandler {
+	return &markChatUnreadHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Mark WhatsApp Chat as Unread
+//
+//	@Summary		Mark WhatsApp Chat as Unread
+//	@Description	Marks a chat as unread, or as read again.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Param			data		body	markChatUnreadBody	true	"Unread state"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Chat marked as unread or read"
+//	@Router			/{instanceId}/chats/{jid}/unread [post]
+func (h *markChatUnreadHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	var body markChatUnreadBody
+	if err := c.ShouldBindJSON(&body); err != nil || body.Unread == nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	err = h.whatsAppService.MarkChatAsUnread(instance, jid, *body.Unread)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type muteChatBody struct {
+	Muted    *bool `json:"muted"`
+	Duration int64 `json:"duration"`
+}
+
+type muteChatHandler struct {
+	whatsAppService service.WhatsAppService
+	chatService     service.ChatService
+}
+
+func NewMuteChatHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+) *muteChatHandler {
+	return &muteChatHandler{
+		whatsAppService: whatsAppService,
+		chatService:     chatService,
+	}
+}
+
+// Mute WhatsApp Chat
+//
+//	@Summary		Mute WhatsApp Chat
+//	@Description	Mutes a chat for the given number of seconds (0 mutes it forever), or unmutes it.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			jid			path	string	true	"Phone or chat JID"
+//	@Param			data		body	muteChatBody	true	"Mute state and duration in seconds"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Chat muted or unmuted"
+//	@Router			/{instanceId}/chats/{jid}/mute [post]
+func (h *muteChatHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	var body muteChatBody
+	if err := c.ShouldBindJSON(&body); err != nil || body.Muted == nil || body.Duration < 0 {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, c.Param("jid"))
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	err = h.whatsAppService.MuteChat(instance, jid, *body.Muted, time.Duration(body.Duration)*time.Second)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type pairPhoneBody struct {
+	Phone string `json:"phone"`
+}
+
+type pairPhoneResponse struct {
+	Code string `json:"code"`
+}
+
+type pairPhoneHandler struct {
+	whatsAppService service.WhatsAppService
+}
+
+func NewPairPhoneHandler(
+	whatsAppService service.WhatsAppService,
+) *pairPhoneHandler {
+	return &pairPhoneHandler{
+		whatsAppService: whatsAppService,
+	}
+}
+
+// Pair by Phone Number
+//
+//	@Summary		Pair by Phone Number
+//	@Description	Returns an 8-character code to link the instance by entering it on the phone, instead of scanning the QR code. The code expires along with the QR codes of the instance, after which its status is TIMEOUT.
+//	@Tags			WhatsApp Login
+//	@Param			instanceId	path	string			true	"Instance ID"
+//	@Param			data		body	pairPhoneBody	true	"Phone number with country code"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	pairPhoneResponse	"Pairing code"
+//	@Router			/{instanceId}/pair/phone [post]
+func (h *pairPhoneHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusBadRequest, "Instance is already paired")
+		return
+	}
+
+	var body pairPhoneBody
+	if err := c.ShouldBindJSON(&body); err != nil || body.Phone == "" {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	code, err := h.whatsAppService.PairPhone(instance, body.Phone)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, pairPhoneResponse{
+		Code: code,
+	})
+}
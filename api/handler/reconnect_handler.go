@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type reconnectHandler struct {
+	whatsAppService service.WhatsAppService
+}
+
+func NewReconnectHandler(
+	whatsAppService service.WhatsAppService,
+) *reconnectHandler {
+	return &reconnectHandler{
+		whatsAppService: whatsAppService,
+	}
+}
+
+// Reconnect to WhatsApp
+//
+//	@Summary		Reconnect to WhatsApp
+//	@Description	Connects the specified paired instance again right away. Instances are reconnected automatically, except when another client replaced their connection (connection state CONFLICT).
+//	@Tags			WhatsApp Login
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Reconnecting"
+//	@Router			/{instanceId}/reconnect [post]
+func (h *reconnectHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if instance.Client.Store.ID == nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Instance is not paired")
+		return
+	}
+
+	if instance.Client.IsConnected() {
+		response.Response(c, http.StatusOK, gin.H{})
+		return
+	}
+
+	err = h.whatsAppService.Reconnect(instance)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
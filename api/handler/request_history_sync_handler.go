@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultHistorySyncCount is how many messages are requested when the
+// request doesn't say
+const defaultHistorySyncCount = 50
+
+type requestHistorySyncBody struct {
+	Chat  string `json:"chat"`
+	Count int    `json:"count"`
+}
+
+type requestHistorySyncHandler struct {
+	whatsAppService            service.WhatsAppService
+	chatService                service.ChatService
+	historySyncProgressService service.HistorySyncProgressService
+}
+
+func NewRequestHistorySyncHandler(
+	whatsAppService service.WhatsAppService,
+	chatService service.ChatService,
+	historySyncProgressService service.HistorySyncProgressService,
+) *requestHistorySyncHandler {
+	return &requestHistorySyncHandler{
+		whatsAppService:            whatsAppService,
+		chatService:                chatService,
+		historySyncProgressService: historySyncProgressService,
+	}
+}
+
+// Request History Sync
+//
+//	@Summary		Request History Sync
+//	@Description	Asks the phone for the messages of a chat older than the oldest stored one. They're imported as an on-demand history sync, whose completion is sent to the webhook.
+//	@Tags			WhatsApp History
+//	@Param			instanceId	path	string					true	"Instance ID"
+//	@Param			data		body	requestHistorySyncBody	true	"Chat and number of messages"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"History sync requested"
+//	@Router			/{instanceId}/sync [post]
+func (h *requestHistorySyncHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	var body requestHistorySyncBody
+	if err := c.ShouldBindJSON(&body); err != nil || body.Chat == "" || body.Count < 0 {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	count := body.Count
+	if count == 0 {
+		count = defaultHistorySyncCount
+	}
+
+	jid, ok := h.chatService.ResolveChatJID(instanceID, body.Chat)
+	if !ok {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+		return
+	}
+
+	err = h.whatsAppService.RequestHistorySync(instance, jid, count)
+	if errors.Is(err, service.ErrNoStoredMessages) {
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = h.historySyncProgressService.RecordRequest(instanceID, service.HistorySyncOnDemand)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type retryMediaHandler struct {
+	whatsAppService service.WhatsAppService
+	messageService  service.MessageService
+}
+
+func NewRetryMediaHandler(
+	whatsAppService service.WhatsAppService,
+	messageService service.MessageService,
+) *retryMediaHandler {
+	return &retryMediaHandler{
+		whatsAppService: whatsAppService,
+		messageService:  messageService,
+	}
+}
+
+// Retry Media Download
+//
+//	@Summary		Retry Media Download
+//	@Description	Asks the phone to upload the media of a message again, once it's no longer available on the WhatsApp servers. The media is downloaded when the phone answers.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			messageId	path	string	true	"Message ID"
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Media requested"
+//	@Router			/{instanceId}/media/{messageId}/retry [post]
+func (h *retryMediaHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	message, err := h.messageService.GetMessage(instanceID, c.Param("messageId"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if message == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	if message.MediaType == "" || len(message.MediaKey) == 0 {
+		response.ErrorResponse(c, http.StatusBadRequest, "Message has no media to download")
+		return
+	}
+	if message.MediaExpired {
+		response.ErrorResponse(c, http.StatusBadRequest, "Message media expired")
+		return
+	}
+
+	// the media was already downloaded
+	if message.MediaPath != "" {
+		response.Response(c, http.StatusOK, gin.H{})
+		return
+	}
+
+	err = h.whatsAppService.RetryMessageMedia(instance, message)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
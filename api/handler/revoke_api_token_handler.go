@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type revokeApiTokenHandler struct {
+	apiTokenService service.ApiTokenService
+}
+
+func NewRevokeApiTokenHandler(
+	apiTokenService service.ApiTokenService,
+) *revokeApiTokenHandler {
+	return &revokeApiTokenHandler{
+		apiTokenService: apiTokenService,
+	}
+}
+
+// Revoke API Token
+//
+//	@Summary		Revoke API Token
+//	@Description	Deletes the specified API token, which stops working right away.
+//	@Tags			API Tokens
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			tokenId		path	int		true	"API token ID"
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"API token revoked"
+//	@Router			/{instanceId}/tokens/{tokenId} [delete]
+func (h *revokeApiTokenHandler) Handler(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 0)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	token, err := h.apiTokenService.GetToken(c.Param("instanceId"), uint(tokenID))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if token == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "API token not found")
+		return
+	}
+
+	if err := h.apiTokenService.RevokeToken(token); err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, gin.H{})
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rotateApiTokenHandler struct {
+	apiTokenService service.ApiTokenService
+}
+
+func NewRotateApiTokenHandler(
+	apiTokenService service.ApiTokenService,
+) *rotateApiTokenHandler {
+	return &rotateApiTokenHandler{
+		apiTokenService: apiTokenService,
+	}
+}
+
+// Rotate API Token
+//
+//	@Summary		Rotate API Token
+//	@Description	Replaces the specified API token with a new one, keeping its name and scopes. The previous token stops working right away, and the new one is only returned once.
+//	@Tags			API Tokens
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			tokenId		path	int		true	"API token ID"
+//	@Produce		json
+//	@Success		200	{object}	response.ApiTokenSecret	"API token"
+//	@Router			/{instanceId}/tokens/{tokenId}/rotate [post]
+func (h *rotateApiTokenHandler) Handler(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 0)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	token, err := h.apiTokenService.GetToken(c.Param("instanceId"), uint(tokenID))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if token == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "API token not found")
+		return
+	}
+
+	secret, err := h.apiTokenService.RotateToken(token)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, response.NewApiTokenSecretResponse(*token, secret))
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type searchMessagesResponse struct {
+	Results []response.SearchResult `json:"results"`
+}
+
+type searchMessagesHandler struct {
+	whatsAppService service.WhatsAppService
+	messageService  service.MessageService
+}
+
+func NewSearchMessagesHandler(
+	whatsAppService service.WhatsAppService,
+	messageService service.MessageService,
+) *searchMessagesHandler {
+	return &searchMessagesHandler{
+		whatsAppService: whatsAppService,
+		messageService:  messageService,
+	}
+}
+
+// Search WhatsApp Messages
+//
+//	@Summary		Search WhatsApp Messages
+//	@Description	Full-text search over message bodies, captions and document filenames of the specified instance, ranked by relevance. Unavailable while encryption at rest is enabled.
+//	@Tags			WhatsApp Chat
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Param			q			query	string	true	"Search terms"
+//	@Param			chat		query	string	false	"Restrict to a chat (phone or JID)"
+//	@Param			from		query	string	false	"Only messages sent at or after this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			to			query	string	false	"Only messages sent at or before this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			limit		query	int		false	"Page size (default 20, max 100)"
+//	@Param			offset		query	int		false	"Page offset"
+//	@Produce		json
+//	@Success		200	{object}	searchMessagesResponse	"Matching messages with highlighted snippets"
+//	@Failure		501	{object}	response.Error	"Search is unavailable while encryption at rest is enabled"
+//	@Router			/{instanceId}/messages/search [get]
+func (h *searchMessagesHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.whatsAppService.IsAuthenticated(instance) {
+		response.ErrorResponse(c, http.StatusUnauthorized, "unautenticated")
+		return
+	}
+
+	filter := model.MessageSearchFilter{
+		Query: c.Query("q"),
+	}
+	if filter.Query == "" {
+		response.ErrorResponse(c, http.StatusBadRequest, "Missing search query")
+		return
+	}
+
+	if chat := c.Query("chat"); chat != "" {
+		jid, ok := helper.MakeJID(chat)
+		if !ok {
+			response.ErrorResponse(c, http.StatusBadRequest, "Invalid chat")
+			return
+		}
+		filter.Chat = jid.User
+	}
+
+	filter.From, err = helper.ParseTime(c.Query("from"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid from date")
+		return
+	}
+
+	filter.To, err = helper.ParseTime(c.Query("to"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Invalid to date")
+		return
+	}
+
+	filter.Limit, filter.Offset, err = helper.MakePagination(c.Query("limit"), c.Query("offset"))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.messageService.SearchMessages(instanceID, filter)
+	if errors.Is(err, service.ErrSearchUnavailable) {
+		response.ErrorResponse(c, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	messages := make([]model.Message, len(results))
+	for i := range results {
+		messages[i] = results[i].Message
+	}
+	h.whatsAppService.DownloadMessagesMedia(instance, messages)
+
+	response.Response(c, http.StatusOK, searchMessagesResponse{
+		Results: response.NewSearchResultsResponse(results),
+	})
+}
@@ -1,14 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"zapmeow/api/helper"
-	"zapmeow/api/model"
 	"zapmeow/api/response"
 	"zapmeow/api/service"
+	"zapmeow/pkg/ratelimit"
 
 	"github.com/gin-gonic/gin"
-	"github.com/vincent-petithory/dataurl"
 )
 
 type sendImageMessageBody struct {
@@ -22,29 +22,34 @@ type sendImageMessageResponse struct {
 
 type sendImageMessageHandler struct {
 	whatsAppService service.WhatsAppService
-	messageService  service.MessageService
+	sendService     service.SendService
+	sendJobService  service.SendJobService
 }
 
 func NewSendImageMessageHandler(
 	whatsAppService service.WhatsAppService,
-	messageService service.MessageService,
+	sendService service.SendService,
+	sendJobService service.SendJobService,
 ) *sendImageMessageHandler {
 	return &sendImageMessageHandler{
 		whatsAppService: whatsAppService,
-		messageService:  messageService,
+		sendService:     sendService,
+		sendJobService:  sendJobService,
 	}
 }
 
 // Send Image Message on WhatsApp
 //
 //	@Summary		Send Image Message on WhatsApp
-//	@Description	Sends an image message on WhatsApp using the specified instance.
+//	@Description	Sends an image message on WhatsApp using the specified instance. Returns 429 with a Retry-After header when it would exceed the rate limits of the instance. With async=true, the message is sent in the background and a job is returned right away, which is retried on failure and waits for the rate limits instead.
 //	@Tags			WhatsApp Chat
 //	@Param			instanceId	path	string					true	"Instance ID"
+//	@Param			async		query	bool					false	"Send in the background"
 //	@Param			data		body	sendImageMessageBody	true	"Image message body"
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	sendImageMessageResponse	"Message Send Response"
+//	@Success		202	{object}	sendJobResponse				"Send Job"
 //	@Router			/{instanceId}/chat/send/image [post]
 func (h *sendImageMessageHandler) Handler(c *gin.Context) {
 	instanceID := c.Param("instanceId")
@@ -65,59 +70,47 @@ func (h *sendImageMessageHandler) Handler(c *gin.Context) {
 		return
 	}
 
-	jid, ok := helper.MakeJID(body.Phone)
-	if !ok {
+	if _, ok := helper.MakeJID(body.Phone); !ok {
 		response.ErrorResponse(c, http.StatusBadRequest, "Invalid phone")
 		return
 	}
 
-	mimitype, err := helper.GetMimeTypeFromDataURI(body.Base64)
-	if err != nil {
+	if _, err := helper.GetMimeTypeFromDataURI(body.Base64); err != nil {
 		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	imageURL, err := dataurl.DecodeString(body.Base64)
-	if err != nil {
-		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
-		return
+	message := service.OutgoingMessage{
+		Type:   service.ImageMessage,
+		Phone:  body.Phone,
+		Base64: body.Base64,
 	}
 
-	resp, err := h.whatsAppService.SendImageMessage(instance, jid, imageURL, mimitype)
-	if err != nil {
-		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
-		return
-	}
+	if c.Query("async") == "true" {
+		job, err := h.sendJobService.CreateJob(instanceID, message)
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
 
-	path, err := helper.SaveMedia(
-		instanceID,
-		resp.ID,
-		imageURL.Data,
-		mimitype,
-	)
-	if err != nil {
-		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		response.Response(c, http.StatusAccepted, sendJobResponse{
+			Job: response.NewSendJobResponse(*job),
+		})
 		return
 	}
 
-	message := model.Message{
-		FromMe:     true,
-		ChatJID:    jid.User,
-		SenderJID:  resp.Sender.User,
-		InstanceID: instanceID,
-		Timestamp:  resp.Timestamp,
-		MessageID:  resp.ID,
-		MediaType:  "image",
-		MediaPath:  path,
-	}
-
-	err = h.messageService.CreateMessage(&message)
+	sent, err := h.sendService.Send(c.Request.Context(), instance, message)
 	if err != nil {
+		var limitErr *ratelimit.Error
+		if errors.As(err, &limitErr) {
+			response.RateLimitResponse(c, limitErr)
+			return
+		}
 		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	response.Response(c, http.StatusOK, sendImageMessageResponse{
-		Message: response.NewMessageResponse(message),
+		Message: response.NewMessageResponse(*sent),
 	})
 }
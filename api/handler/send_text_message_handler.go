@@ -1,11 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"zapmeow/api/helper"
-	"zapmeow/api/model"
 	"zapmeow/api/response"
 	"zapmeow/api/service"
+	"zapmeow/pkg/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,29 +22,34 @@ type sendTextMessageResponse struct {
 
 type sendTextMessageHandler struct {
 	whatsAppService service.WhatsAppService
-	messageService  service.MessageService
+	sendService     service.SendService
+	sendJobService  service.SendJobService
 }
 
 func NewSendTextMessageHandler(
 	whatsAppService service.WhatsAppService,
-	messageService service.MessageService,
+	sendService service.SendService,
+	sendJobService service.SendJobService,
 ) *sendTextMessageHandler {
 	return &sendTextMessageHandler{
 		whatsAppService: whatsAppService,
-		messageService:  messageService,
+		sendService:     sendService,
+		sendJobService:  sendJobService,
 	}
 }
 
 // Send Text Message on WhatsApp
 //
 //	@Summary		Send Text Message on WhatsApp
-//	@Description	Sends a text message on WhatsApp using the specified instance.
+//	@Description	Sends a text message on WhatsApp using the specified instance. Returns 429 with a Retry-After header when it would exceed the rate limits of the instance. With async=true, the message is sent in the background and a job is returned right away, which is retried on failure and waits for the rate limits instead.
 //	@Tags			WhatsApp Chat
 //	@Param			instanceId	path	string				true	"Instance ID"
+//	@Param			async		query	bool				false	"Send in the background"
 //	@Param			data		body	sendTextMessageBody	true	"Text message body"
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	sendTextMessageResponse	"Message Send Response"
+//	@Success		202	{object}	sendJobResponse			"Send Job"
 //	@Router			/{instanceId}/chat/send/text [post]
 func (h *sendTextMessageHandler) Handler(c *gin.Context) {
 	instanceID := c.Param("instanceId")
@@ -56,39 +62,45 @@ func (h *sendTextMessageHandler) Handler(c *gin.Context) {
 	var body sendTextMessageBody
 	if err := c.ShouldBindJSON(&body); err != nil {
 		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
-
 		return
 	}
 
-	jid, ok := helper.MakeJID(body.Phone)
-	if !ok {
+	if _, ok := helper.MakeJID(body.Phone); !ok {
 		response.ErrorResponse(c, http.StatusBadRequest, "Invalid phone")
 		return
 	}
 
-	resp, err := h.whatsAppService.SendTextMessage(instance, jid, body.Text)
-	if err != nil {
-		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
-		return
+	message := service.OutgoingMessage{
+		Type:  service.TextMessage,
+		Phone: body.Phone,
+		Text:  body.Text,
 	}
 
-	message := model.Message{
-		MessageID:  resp.ID,
-		ChatJID:    jid.User,
-		SenderJID:  resp.Sender.User,
-		InstanceID: instanceID,
-		Body:       body.Text,
-		Timestamp:  resp.Timestamp,
-		FromMe:     true,
+	if c.Query("async") == "true" {
+		job, err := h.sendJobService.CreateJob(instanceID, message)
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.Response(c, http.StatusAccepted, sendJobResponse{
+			Job: response.NewSendJobResponse(*job),
+		})
+		return
 	}
 
-	err = h.messageService.CreateMessage(&message)
+	sent, err := h.sendService.Send(c.Request.Context(), instance, message)
 	if err != nil {
+		var limitErr *ratelimit.Error
+		if errors.As(err, &limitErr) {
+			response.RateLimitResponse(c, limitErr)
+			return
+		}
 		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	response.Response(c, http.StatusOK, sendTextMessageResponse{
-		Message: response.NewMessageResponse(message),
+		Message: response.NewMessageResponse(*sent),
 	})
 }
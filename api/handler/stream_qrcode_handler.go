@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+	"zapmeow/pkg/zapmeow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// qrCodeStreamKeepAlive is how often an idle stream is written to, so proxies
+// don't close it between QR codes
+const qrCodeStreamKeepAlive = 15 * time.Second
+
+type streamQrCodeHandler struct {
+	app             *zapmeow.ZapMeow
+	whatsAppService service.WhatsAppService
+	accountService  service.AccountService
+}
+
+func NewStreamQrCodeHandler(
+	app *zapmeow.ZapMeow,
+	whatsAppService service.WhatsAppService,
+	accountService service.AccountService,
+) *streamQrCodeHandler {
+	return &streamQrCodeHandler{
+		app:             app,
+		whatsAppService: whatsAppService,
+		accountService:  accountService,
+	}
+}
+
+// Stream QR Codes for WhatsApp Login
+//
+//	@Summary		Stream WhatsApp QR Codes
+//	@Description	Server-sent events with each new QR code as it rotates ("code"), followed by the outcome of the pairing ("success", "timeout", "rate-limit" or "error"), after which the stream ends.
+//	@Tags			WhatsApp Login
+//	@Param			instanceId	path	string	true	"Instance ID"
+//	@Produce		text/event-stream
+//	@Success		200	{object}	service.PairingEvent	"Pairing events"
+//	@Router			/{instanceId}/qrcode/stream [get]
+func (h *streamQrCodeHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	instance, err := h.whatsAppService.GetInstance(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	events, unsubscribe := h.whatsAppService.SubscribePairing(instanceID)
+	defer unsubscribe()
+
+	// the current QR code was generated before subscribing
+	var pending []service.PairingEvent
+	if h.whatsAppService.IsAuthenticated(instance) {
+		pending = append(pending, service.PairingEvent{Event: service.PairingSuccess})
+	} else {
+		h.app.Mutex.Lock()
+		account, err := h.accountService.GetAccountByInstanceID(instanceID)
+		h.app.Mutex.Unlock()
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if account != nil && account.QrCode != "" {
+			pending = append(pending, service.PairingEvent{Event: service.PairingCode, Code: account.QrCode})
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(qrCodeStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		var event service.PairingEvent
+		if len(pending) > 0 {
+			event, pending = pending[0], pending[1:]
+		} else {
+			select {
+			case event = <-events:
+			case <-keepAlive.C:
+				c.SSEvent("ping", "")
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			case <-*h.app.StopCh:
+				return false
+			}
+		}
+
+		c.SSEvent(event.Event, event)
+		return event.Event == service.PairingCode
+	})
+}
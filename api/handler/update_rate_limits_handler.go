@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updateRateLimitsBody struct {
+	MessagesPerSecond *int `json:"messages_per_second"`
+	MessagesPerMinute *int `json:"messages_per_minute"`
+	NewChatsPerDay    *int `json:"new_chats_per_day"`
+	MinIntervalMs     *int `json:"min_interval_ms"`
+	MaxIntervalMs     *int `json:"max_interval_ms"`
+}
+
+type updateRateLimitsHandler struct {
+	rateLimitService service.RateLimitService
+}
+
+func NewUpdateRateLimitsHandler(
+	rateLimitService service.RateLimitService,
+) *updateRateLimitsHandler {
+	return &updateRateLimitsHandler{
+		rateLimitService: rateLimitService,
+	}
+}
+
+// Update Rate Limits
+//
+//	@Summary		Update Rate Limits
+//	@Description	Limits the messages sent by the specified instance per second and per minute, and the messages sent per day to users it has no chat with. Consecutive messages are spaced by a random interval between min_interval_ms and max_interval_ms. Messages that would exceed a limit are rejected with 429 and a Retry-After header. Zero disables a limit and omitted limits are kept.
+//	@Tags			Instances
+//	@Param			instanceId	path	string					true	"Instance ID"
+//	@Param			data		body	updateRateLimitsBody	true	"Rate limits"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	response.RateLimits	"Rate limits"
+//	@Router			/{instanceId}/rate-limits [put]
+func (h *updateRateLimitsHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+
+	var body updateRateLimitsBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	current, err := h.rateLimitService.GetLimits(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	limits := model.RateLimits{
+		InstanceID:        instanceID,
+		MessagesPerSecond: current.MessagesPerSecond,
+		MessagesPerMinute: current.MessagesPerMinute,
+		NewChatsPerDay:    current.NewChatsPerDay,
+		MinIntervalMs:     current.MinIntervalMs,
+		MaxIntervalMs:     current.MaxIntervalMs,
+	}
+	if body.MessagesPerSecond != nil {
+		limits.MessagesPerSecond = *body.MessagesPerSecond
+	}
+	if body.MessagesPerMinute != nil {
+		limits.MessagesPerMinute = *body.MessagesPerMinute
+	}
+	if body.NewChatsPerDay != nil {
+		limits.NewChatsPerDay = *body.NewChatsPerDay
+	}
+	if body.MinIntervalMs != nil {
+		limits.MinIntervalMs = *body.MinIntervalMs
+	}
+	if body.MaxIntervalMs != nil {
+		limits.MaxIntervalMs = *body.MaxIntervalMs
+	}
+
+	if limits.MessagesPerSecond < 0 || limits.MessagesPerMinute < 0 || limits.NewChatsPerDay < 0 ||
+		limits.MinIntervalMs < 0 || limits.MaxIntervalMs < 0 {
+		response.ErrorResponse(c, http.StatusBadRequest, "Rate limits can't be negative")
+		return
+	}
+
+	if limits.MaxIntervalMs < limits.MinIntervalMs {
+		response.ErrorResponse(c, http.StatusBadRequest, "Maximum interval can't be below the minimum interval")
+		return
+	}
+
+	if err := h.rateLimitService.SaveLimits(&limits); err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, response.NewRateLimitsResponse(&limits))
+}
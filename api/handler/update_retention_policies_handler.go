@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type retentionPolicyBody struct {
+	MediaType    string `json:"media_type"`
+	MaxAgeDays   int    `json:"max_age_days"`
+	MaxSizeBytes int64  `json:"max_size_bytes"`
+}
+
+type updateRetentionPoliciesBody struct {
+	Policies []retentionPolicyBody `json:"policies"`
+}
+
+type updateRetentionPoliciesHandler struct {
+	accountService         service.AccountService
+	retentionPolicyService service.RetentionPolicyService
+}
+
+func NewUpdateRetentionPoliciesHandler(
+	accountService service.AccountService,
+	retentionPolicyService service.RetentionPolicyService,
+) *updateRetentionPoliciesHandler {
+	return &updateRetentionPoliciesHandler{
+		accountService:         accountService,
+		retentionPolicyService: retentionPolicyService,
+	}
+}
+
+// Update Media Retention Policies
+//
+//	@Summary		Update Media Retention Policies
+//	@Description	Replaces the media retention policies of the specified instance. Each policy applies to a media type (image, audio, document, sticker) or to all media when media_type is empty, and expires media older than max_age_days or beyond max_size_bytes, newest media kept first. Zero disables a limit.
+//	@Tags			WhatsApp Media
+//	@Param			instanceId	path	string						true	"Instance ID"
+//	@Param			data		body	updateRetentionPoliciesBody	true	"Retention policies"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	retentionPoliciesResponse	"Retention policies"
+//	@Router			/{instanceId}/retention [put]
+func (h *updateRetentionPoliciesHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	var body updateRetentionPoliciesBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	seen := make(map[string]bool)
+	policies := make([]model.RetentionPolicy, 0, len(body.Policies))
+	for _, policy := range body.Policies {
+		switch policy.MediaType {
+		case "", "image", "audio", "document", "sticker":
+		default:
+			response.ErrorResponse(c, http.StatusBadRequest, "Invalid media type: "+policy.MediaType)
+			return
+		}
+
+		if seen[policy.MediaType] {
+			response.ErrorResponse(c, http.StatusBadRequest, "Duplicated policy for media type: "+policy.MediaType)
+			return
+		}
+		seen[policy.MediaType] = true
+
+		if policy.MaxAgeDays < 0 || policy.MaxSizeBytes < 0 {
+			response.ErrorResponse(c, http.StatusBadRequest, "Retention limits can't be negative")
+			return
+		}
+
+		policies = append(policies, model.RetentionPolicy{
+			MediaType:    policy.MediaType,
+			MaxAgeDays:   policy.MaxAgeDays,
+			MaxSizeBytes: policy.MaxSizeBytes,
+		})
+	}
+
+	if err := h.retentionPolicyService.ReplacePolicies(instanceID, policies); err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, retentionPoliciesResponse{
+		Policies: response.NewRetentionPoliciesResponse(policies),
+	})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updateSyncSettingsBody struct {
+	Enabled            *bool `json:"enabled"`
+	MaxMessagesPerChat *int  `json:"max_messages_per_chat"`
+	MaxAgeDays         *int  `json:"max_age_days"`
+	IncludeGroups      *bool `json:"include_groups"`
+	DownloadMedia      *bool `json:"download_media"`
+}
+
+type updateSyncSettingsHandler struct {
+	accountService      service.AccountService
+	syncSettingsService service.SyncSettingsService
+}
+
+func NewUpdateSyncSettingsHandler(
+	accountService service.AccountService,
+	syncSettingsService service.SyncSettingsService,
+) *updateSyncSettingsHandler {
+	return &updateSyncSettingsHandler{
+		accountService:      accountService,
+		syncSettingsService: syncSettingsService,
+	}
+}
+
+// Update History Sync Settings
+//
+//	@Summary		Update History Sync Settings
+//	@Description	Changes how much history is imported for the specified instance: whether it's imported at all, how many of the newest messages per chat, up to how many days old, whether group chats are included and whether their media can be downloaded when first read. Zero disables a limit and omitted settings are kept. On-demand syncs requested through the API aren't limited.
+//	@Tags			WhatsApp History
+//	@Param			instanceId	path	string					true	"Instance ID"
+//	@Param			data		body	updateSyncSettingsBody	true	"History sync settings"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	response.SyncSettings	"History sync settings"
+//	@Router			/{instanceId}/sync/settings [put]
+func (h *updateSyncSettingsHandler) Handler(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+	account, err := h.accountService.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if account == nil {
+		response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+		return
+	}
+
+	var body updateSyncSettingsBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "Error trying to validate infos. ")
+		return
+	}
+
+	if (body.MaxMessagesPerChat != nil && *body.MaxMessagesPerChat < 0) ||
+		(body.MaxAgeDays != nil && *body.MaxAgeDays < 0) {
+		response.ErrorResponse(c, http.StatusBadRequest, "Sync limits can't be negative")
+		return
+	}
+
+	current, err := h.syncSettingsService.GetSettings(instanceID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	settings := model.SyncSettings{
+		InstanceID:         instanceID,
+		Enabled:            current.Enabled,
+		MaxMessagesPerChat: current.MaxMessagesPerChat,
+		MaxAgeDays:         current.MaxAgeDays,
+		IncludeGroups:      current.IncludeGroups,
+		DownloadMedia:      current.DownloadMedia,
+	}
+	if body.Enabled != nil {
+		settings.Enabled = *body.Enabled
+	}
+	if body.MaxMessagesPerChat != nil {
+		settings.MaxMessagesPerChat = *body.MaxMessagesPerChat
+	}
+	if body.MaxAgeDays != nil {
+		settings.MaxAgeDays = *body.MaxAgeDays
+	}
+	if body.IncludeGroups != nil {
+		settings.IncludeGroups = *body.IncludeGroups
+	}
+	if body.DownloadMedia != nil {
+		settings.DownloadMedia = *body.DownloadMedia
+	}
+
+	if err := h.syncSettingsService.SaveSettings(&settings); err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Response(c, http.StatusOK, response.NewSyncSettingsResponse(&settings))
+}
@@ -0,0 +1,22 @@
+package helper
+
+import (
+	"sync"
+	"zapmeow/config"
+	"zapmeow/pkg/encryption"
+)
+
+var (
+	keyring     *encryption.Keyring
+	keyringOnce sync.Once
+)
+
+// GetKeyring returns the keyring used to encrypt media and message text at
+// rest, shared by the whole process.
+func GetKeyring() *encryption.Keyring {
+	keyringOnce.Do(func() {
+		config := config.Load()
+		keyring = encryption.NewKeyring(config.EncryptionKey, MakeKeysPath())
+	})
+	return keyring
+}
@@ -0,0 +1,17 @@
+package helper
+
+import (
+	"strings"
+	"zapmeow/api/model"
+)
+
+// HasScope reports whether the comma-separated scopes grant scope. The admin
+// scope grants all of them.
+func HasScope(scopes string, scope string) bool {
+	for _, granted := range strings.Split(scopes, ",") {
+		if granted == scope || granted == model.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// MakeInstanceID generates a random ID for instances created without one.
+func MakeInstanceID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,11 @@
+package helper
+
+import (
+	"fmt"
+	"zapmeow/config"
+)
+
+func MakeKeysPath() string {
+	config := config.Load()
+	return fmt.Sprintf("%s/keys", config.StoragePath)
+}
@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+func MakePagination(limit string, offset string) (int, int, error) {
+	pageLimit := DefaultPageLimit
+	if limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		pageLimit = Min(value, MaxPageLimit)
+	}
+
+	pageOffset := 0
+	if offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+		pageOffset = value
+	}
+
+	return pageLimit, pageOffset, nil
+}
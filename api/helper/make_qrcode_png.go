@@ -0,0 +1,8 @@
+package helper
+
+import qrcode "github.com/skip2/go-qrcode"
+
+// MakeQrCodePNG renders a QR code as a square PNG of the given size in pixels.
+func MakeQrCodePNG(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, size)
+}
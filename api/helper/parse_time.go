@@ -0,0 +1,20 @@
+package helper
+
+import "time"
+
+// ParseTime accepts either an RFC 3339 timestamp or a plain date. An empty
+// value returns nil so it can be used directly for optional query filters.
+func ParseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
@@ -0,0 +1,12 @@
+package helper
+
+import "os"
+
+// ReadMedia reads a stored media file, decrypting it if needed.
+func ReadMedia(instanceID string, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return GetKeyring().Decrypt(instanceID, data)
+}
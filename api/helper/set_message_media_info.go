@@ -0,0 +1,19 @@
+package helper
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/whatsapp"
+)
+
+// SetMessageMediaInfo keeps what's needed to download the media of a message
+// later, when it couldn't be downloaded along with the message.
+func SetMessageMediaInfo(message *model.Message, info *whatsapp.MediaInfo) {
+	if info == nil {
+		return
+	}
+	message.MediaDirectPath = info.DirectPath
+	message.MediaKey = info.MediaKey
+	message.MediaFileSHA256 = info.FileSHA256
+	message.MediaFileEncSHA256 = info.FileEncSHA256
+	message.MediaFileLength = info.FileLength
+}
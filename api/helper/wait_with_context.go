@@ -0,0 +1,23 @@
+package helper
+
+import (
+	"context"
+	"sync"
+)
+
+// WaitWithContext waits for the wait group, or returns the error of the
+// context when it's done first.
+func WaitWithContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiTokenKey is the context key of the API token of the request. It isn't
+// set for requests made with the master key.
+const apiTokenKey = "apiToken"
+
+// Authenticate accepts either the master key, which reaches every route, or
+// an instance token, which only reaches the routes of its own instance. An
+// empty master key disables authentication.
+func Authenticate(apiKey string, apiTokenService service.ApiTokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			c.Next()
+			return
+		}
+
+		key := getAPIKey(c)
+		if key == "" {
+			response.ErrorResponse(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			c.Next()
+			return
+		}
+
+		token, err := apiTokenService.Authenticate(key)
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if token == nil {
+			response.ErrorResponse(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		instanceID := c.Param("instanceId")
+		if instanceID == "" {
+			instanceID = c.Param("id")
+		}
+
+		if instanceID == "" || instanceID != token.InstanceID {
+			response.ErrorResponse(c, http.StatusForbidden, "API token doesn't have access to this route")
+			return
+		}
+
+		c.Set(apiTokenKey, token)
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests made with an instance token lacking scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(apiTokenKey)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		token := value.(*model.ApiToken)
+		if !helper.HasScope(token.Scopes, scope) {
+			response.ErrorResponse(c, http.StatusForbidden, "API token is missing the "+scope+" scope")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireApiKey rejects requests to manage API tokens while authentication
+// is disabled, as their tokens wouldn't restrict anything.
+func RequireApiKey(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			response.ErrorResponse(c, http.StatusForbidden, "API tokens require API_KEY to be set")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func getAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+
+	authorization := c.GetHeader("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
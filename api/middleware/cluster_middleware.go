@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"zapmeow/api/response"
+	"zapmeow/pkg/cluster"
+	"zapmeow/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forwardedHeader marks requests proxied by another node, so they aren't
+// proxied again while an instance moves between nodes.
+const forwardedHeader = "X-Zapmeow-Forwarded-By"
+
+// RouteInstance proxies requests for an instance owned by another node to
+// that node. param is the path parameter holding the instance ID.
+func RouteInstance(cluster cluster.Cluster, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, err := cluster.Owner(c.Param(param))
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if owner != nil && owner.ID == cluster.NodeID() {
+			c.Next()
+			return
+		}
+
+		if owner == nil || owner.Addr == "" || c.GetHeader(forwardedHeader) != "" {
+			c.Header("Retry-After", "5")
+			response.ErrorResponse(c, http.StatusServiceUnavailable, "Instance is moving to another node")
+			return
+		}
+
+		target, err := url.Parse(owner.Addr)
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		// QR code streams are flushed as each event is written
+		proxy.FlushInterval = -1
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("Error proxying request to node ", owner.ID, ". ", err)
+			response.ErrorResponse(c, http.StatusBadGateway, "Node of the instance is unreachable")
+		}
+
+		c.Request.Header.Set(forwardedHeader, cluster.NodeID())
+		proxy.ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
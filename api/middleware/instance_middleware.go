@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireInstance rejects requests for instances that weren't created
+// through the instance API, so a mistyped ID doesn't create a new one.
+func RequireInstance(accountService service.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, err := accountService.GetAccountByInstanceID(c.Param("instanceId"))
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if account == nil {
+			response.ErrorResponse(c, http.StatusNotFound, "Instance not found")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,16 +1,41 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Account struct {
 	gorm.Model
-	User       string
-	Agent      uint8
-	Device     uint8
-	Server     string
-	AD         bool
-	QrCode     string
-	Status     string
-	WasSynced  bool
-	InstanceID string
+	User               string
+	Agent              uint8
+	Device             uint16
+	Server             string
+	QrCode             string
+	PairingCode        string
+	Status             string
+	InstanceID         string
+	Name               string
+	Tenant             string `gorm:"index"`
+	WebhookURL         string
+	ProxyURL           string
+	DeviceName         string
+	DevicePlatform     string
+	DeviceBrowserLabel string
+	ConnectionState    string
+	ConnectionError    string
+	ReconnectAttempts  int
+	LastConnectedAt    *time.Time
+	LastDisconnectedAt *time.Time
 }
+
+// connection states of paired accounts, next to their Status
+const (
+	ConnectionConnected    = "CONNECTED"
+	ConnectionDisconnected = "DISCONNECTED"
+	ConnectionReconnecting = "RECONNECTING"
+	// ConnectionConflict means another client replaced the connection, so it
+	// isn't reconnected automatically
+	ConnectionConflict = "CONFLICT"
+)
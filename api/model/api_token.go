@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ApiToken grants access to the routes of one instance. Only the hash of the
+// token is stored, and its prefix tells tokens apart in listings.
+type ApiToken struct {
+	gorm.Model
+	InstanceID string `gorm:"index"`
+	Name       string
+	Prefix     string
+	TokenHash  string `gorm:"uniqueIndex"`
+	// Scopes is a comma-separated list of scopes
+	Scopes     string
+	LastUsedAt *time.Time
+}
+
+// scopes of API tokens, where admin includes the others
+const (
+	ScopeRead  = "read"
+	ScopeSend  = "send"
+	ScopeAdmin = "admin"
+)
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Chat struct {
+	gorm.Model
+	InstanceID        string `gorm:"uniqueIndex:idx_chats_instance_chat"`
+	ChatJID           string `gorm:"column:chat_jid;uniqueIndex:idx_chats_instance_chat"`
+	Name              string
+	Description       string
+	IsGroup           bool
+	LastMessageID     string
+	LastMessageBody   string
+	LastMessageFromMe bool
+	LastMessageAt     time.Time `gorm:"index"`
+	UnreadCount       int
+}
+
+const ChatPreviewLength = 100
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChatSettings mirrors the chat state kept in WhatsApp's app state, whether
+// it was changed through the API or on the phone.
+type ChatSettings struct {
+	gorm.Model
+	InstanceID   string `gorm:"uniqueIndex:idx_chat_settings_instance_chat"`
+	ChatJID      string `gorm:"column:chat_jid;uniqueIndex:idx_chat_settings_instance_chat"`
+	Archived     bool
+	Pinned       bool
+	Muted        bool
+	MutedUntil   *time.Time // nil while muted means muted forever
+	MarkedUnread bool
+}
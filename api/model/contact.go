@@ -0,0 +1,13 @@
+package model
+
+import "gorm.io/gorm"
+
+// Contact keeps the names of a user known to an instance: the name the
+// account saved them with and the push name they chose themselves.
+type Contact struct {
+	gorm.Model
+	InstanceID string `gorm:"uniqueIndex:idx_contacts_instance_jid"`
+	JID        string `gorm:"column:jid;uniqueIndex:idx_contacts_instance_jid"`
+	Name       string
+	PushName   string
+}
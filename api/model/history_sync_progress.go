@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HistorySyncProgress tracks the import of one history sync type of an
+// instance, from the metadata WhatsApp attaches to each chunk.
+type HistorySyncProgress struct {
+	gorm.Model
+	InstanceID            string `gorm:"uniqueIndex:idx_history_sync_progresses_instance_sync_type"`
+	SyncType              string `gorm:"uniqueIndex:idx_history_sync_progresses_instance_sync_type"`
+	Chunks                int
+	LastChunkOrder        uint32
+	Progress              uint32
+	ConversationsImported int
+	MessagesImported      int
+	Completed             bool
+	RequestedAt           *time.Time
+	LastChunkAt           *time.Time
+	CompletedAt           *time.Time
+}
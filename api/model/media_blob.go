@@ -0,0 +1,14 @@
+package model
+
+import "gorm.io/gorm"
+
+// MediaBlob is a media file stored once per instance under its SHA-256 and
+// shared by every message with the same content.
+type MediaBlob struct {
+	gorm.Model
+	InstanceID string `gorm:"uniqueIndex:idx_media_blobs_instance_sha256"`
+	SHA256     string `gorm:"column:sha256;uniqueIndex:idx_media_blobs_instance_sha256"`
+	Path       string
+	Size       int64
+	RefCount   int
+}
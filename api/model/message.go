@@ -6,15 +6,31 @@ import (
 	"gorm.io/gorm"
 )
 
+// Message is indexed by chat and timestamp, the order chats are listed,
+// exported and expired in.
 type Message struct {
 	gorm.Model
 	SenderJID  string `gorm:"column:sender_jid"`
-	ChatJID    string `gorm:"column:chat_jid"`
-	InstanceID string
+	ChatJID    string `gorm:"column:chat_jid;index:idx_messages_instance_chat_timestamp,priority:2"`
+	InstanceID string `gorm:"index:idx_messages_instance_chat_timestamp,priority:1"`
 	MessageID  string
-	Timestamp  time.Time
+	Timestamp  time.Time `gorm:"index:idx_messages_instance_chat_timestamp,priority:3"`
 	Body       string
+	Caption    string
+	Filename   string
 	MediaType  string // text, image, ptt, audio, document
 	MediaPath  string
-	FromMe     bool
+	// MediaSHA256 references the shared MediaBlob the media is stored in
+	MediaSHA256 string `gorm:"column:media_sha256"`
+	// MediaExpired is set once retention removed the media file
+	MediaExpired  bool
+	MediaMimetype string
+	// the media info lets media that wasn't downloaded yet be downloaded
+	// when it's first read
+	MediaDirectPath    string
+	MediaKey           []byte
+	MediaFileSHA256    []byte `gorm:"column:media_file_sha256"`
+	MediaFileEncSHA256 []byte `gorm:"column:media_file_enc_sha256"`
+	MediaFileLength    uint64
+	FromMe             bool
 }
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type MessageSearchFilter struct {
+	Query  string
+	Chat   string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+type MessageSearchResult struct {
+	Message
+	Snippet string
+	Score   float64
+}
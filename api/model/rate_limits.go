@@ -0,0 +1,17 @@
+package model
+
+import "gorm.io/gorm"
+
+// RateLimits throttles the messages sent by an instance. Zero limits are
+// disabled; instances without limits use the defaults from the config.
+type RateLimits struct {
+	gorm.Model
+	InstanceID        string `gorm:"uniqueIndex"`
+	MessagesPerSecond int
+	MessagesPerMinute int
+	NewChatsPerDay    int
+	// MinIntervalMs and MaxIntervalMs bound the random interval between
+	// consecutive messages
+	MinIntervalMs int
+	MaxIntervalMs int
+}
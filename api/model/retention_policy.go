@@ -0,0 +1,13 @@
+package model
+
+import "gorm.io/gorm"
+
+// RetentionPolicy limits how long and how much media of an instance is kept.
+// An empty MediaType applies to all media types; zero limits are disabled.
+type RetentionPolicy struct {
+	gorm.Model
+	InstanceID   string `gorm:"uniqueIndex:idx_retention_policies_instance_media_type"`
+	MediaType    string `gorm:"uniqueIndex:idx_retention_policies_instance_media_type"`
+	MaxAgeDays   int
+	MaxSizeBytes int64
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SendJob is a message sent in the background. Its payload holds the
+// message until it's sent or failed for good.
+type SendJob struct {
+	gorm.Model
+	InstanceID string `gorm:"index"`
+	Type       string
+	Phone      string
+	Payload    string
+	Status     string `gorm:"index"`
+	Attempts   int
+	// NextAttemptAt is when a pending job is due, or when a processing job
+	// is delivered again if the node processing it stopped
+	NextAttemptAt time.Time
+	Error         string
+	MessageID     string
+	CompletedAt   *time.Time
+}
+
+const (
+	SendJobPending    = "pending"
+	SendJobProcessing = "processing"
+	SendJobSucceeded  = "succeeded"
+	SendJobFailed     = "failed"
+)
@@ -0,0 +1,15 @@
+package model
+
+import "gorm.io/gorm"
+
+// SyncSettings limits the history imported for an instance. Zero limits are
+// disabled; instances without settings use the defaults from the config.
+type SyncSettings struct {
+	gorm.Model
+	InstanceID         string `gorm:"uniqueIndex"`
+	Enabled            bool
+	MaxMessagesPerChat int
+	MaxAgeDays         int
+	IncludeGroups      bool
+	DownloadMedia      bool
+}
@@ -2,13 +2,24 @@ package queue
 
 import (
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
 	"zapmeow/pkg/logger"
+	"zapmeow/pkg/queue"
 	"zapmeow/pkg/zapmeow"
 )
 
+// HistorySyncPartitions is the number of partitions of the history sync
+// queue. It doesn't depend on the worker count, so queued history syncs keep
+// their partition when HISTORY_SYNC_WORKERS changes.
+const HistorySyncPartitions = 64
+
 type HistorySyncQueueData struct {
 	InstanceID string
 	History    []byte
+	queueName  string
+	job        *queue.Job
 }
 
 type historySyncQueue struct {
@@ -17,7 +28,9 @@ type historySyncQueue struct {
 
 type HistorySyncQueue interface {
 	Enqueue(item HistorySyncQueueData) error
-	Dequeue() (*HistorySyncQueueData, error)
+	Dequeue(partitions []int, timeout time.Duration) (*HistorySyncQueueData, error)
+	Ack(item *HistorySyncQueueData) error
+	Nack(item *HistorySyncQueueData) error
 }
 
 func NewHistorySyncQueue(app *zapmeow.ZapMeow) *historySyncQueue {
@@ -35,29 +48,70 @@ func (q *historySyncQueue) Enqueue(item HistorySyncQueueData) error {
 		return err
 	}
 
-	return q.app.Queue.Enqueue(q.app.Config.HistorySyncQueueName, jsonData)
+	partition := q.makePartition(item.InstanceID)
+	return q.app.Queue.Enqueue(q.makeQueueName(partition), jsonData)
 }
 
-func (q *historySyncQueue) Dequeue() (*HistorySyncQueueData, error) {
-	result, err := q.app.Queue.Dequeue(q.app.Config.HistorySyncQueueName)
+// Dequeue waits up to timeout for the next history sync of any of the
+// partitions, which must be acked once imported or nacked if importing it
+// failed.
+func (q *historySyncQueue) Dequeue(partitions []int, timeout time.Duration) (*HistorySyncQueueData, error) {
+	queueNames := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		queueNames = append(queueNames, q.makeQueueName(partition))
+	}
+
+	job, err := q.app.Queue.Dequeue(queueNames, timeout)
 	if err != nil {
 		logger.Error("Error dequeuing history sync", logger.Fields{
 			"error": err,
 		})
 		return nil, err
 	}
-	if result == nil {
+	if job == nil {
 		return nil, nil
 	}
 
 	var data HistorySyncQueueData
-	err = json.Unmarshal(result, &data)
+	err = json.Unmarshal(job.Data, &data)
 	if err != nil {
 		logger.Error("Error unmarshal history sync.", logger.Fields{
 			"error": err,
 		})
+		if nackErr := q.app.Queue.Nack(job.Queue, job); nackErr != nil {
+			return nil, nackErr
+		}
 		return nil, err
 	}
 
+	data.queueName = job.Queue
+	data.job = job
 	return &data, nil
 }
+
+func (q *historySyncQueue) Ack(item *HistorySyncQueueData) error {
+	return q.app.Queue.Ack(item.queueName, item.job)
+}
+
+// Nack returns a history sync whose import failed, to be delivered again
+// before the next history syncs of its partition.
+func (q *historySyncQueue) Nack(item *HistorySyncQueueData) error {
+	return q.app.Queue.Nack(item.queueName, item.job)
+}
+
+// makePartition spreads instances over the partitions, each consumed by a
+// single worker, so the history syncs of an instance are imported in order.
+func (q *historySyncQueue) makePartition(instanceID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(instanceID))
+	return int(hash.Sum32() % HistorySyncPartitions)
+}
+
+// makeQueueName keeps the first partition on the unsuffixed queue, which
+// holds the history syncs enqueued before partitioning.
+func (q *historySyncQueue) makeQueueName(partition int) string {
+	if partition == 0 {
+		return q.app.Config.HistorySyncQueueName
+	}
+	return fmt.Sprintf("%s:%d", q.app.Config.HistorySyncQueueName, partition)
+}
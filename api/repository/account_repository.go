@@ -12,6 +12,8 @@ type AccountRepository interface {
 	GetConnectedAccounts() ([]model.Account, error)
 	GetAccountByInstanceID(instanceID string) (*model.Account, error)
 	UpdateAccount(instanceID string, data map[string]interface{}) error
+	GetAccounts(tenant string) ([]model.Account, error)
+	DeleteAccount(instanceID string) error
 }
 
 type accountRepository struct {
@@ -23,12 +25,25 @@ func NewAccountRepository(database database.Database) *accountRepository {
 }
 
 func (repo *accountRepository) CreateAccount(account *model.Account) error {
+	proxyURL := account.ProxyURL
+	defer func() {
+		account.ProxyURL = proxyURL
+	}()
+
+	encrypted, err := encryptProxyURL(account.InstanceID, account.ProxyURL)
+	if err != nil {
+		return err
+	}
+	account.ProxyURL = encrypted
 	return repo.database.Client().Create(account).Error
 }
 
 func (repo *accountRepository) GetConnectedAccounts() ([]model.Account, error) {
 	var accounts []model.Account
 	repo.database.Client().Where("status = ?", "CONNECTED").Find(&accounts)
+	if err := decryptAccounts(accounts); err != nil {
+		return nil, err
+	}
 	return accounts, nil
 }
 
@@ -41,6 +56,10 @@ func (repo *accountRepository) GetAccountByInstanceID(instanceID string) (*model
 		}
 		return nil, nil
 	}
+
+	if err := decryptAccount(&account); err != nil {
+		return nil, err
+	}
 	return &account, nil
 }
 
@@ -50,9 +69,60 @@ func (repo *accountRepository) UpdateAccount(instanceID string, data map[string]
 		return result.Error
 	}
 
+	if proxyURL, ok := data["ProxyURL"].(string); ok {
+		encrypted, err := encryptProxyURL(instanceID, proxyURL)
+		if err != nil {
+			return err
+		}
+		data["ProxyURL"] = encrypted
+	}
+
 	if err := repo.database.Client().Model(&account).Updates(data).Error; err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// GetAccounts returns the accounts of a tenant, or all of them when the
+// tenant is empty.
+func (repo *accountRepository) GetAccounts(tenant string) ([]model.Account, error) {
+	var accounts []model.Account
+	query := repo.database.Client().Order("created_at")
+	if tenant != "" {
+		query = query.Where("tenant = ?", tenant)
+	}
+	if result := query.Find(&accounts); result.Error != nil {
+		return nil, result.Error
+	}
+	if err := decryptAccounts(accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// DeleteAccount deletes the account along with every row of the instance, in
+// one transaction.
+func (repo *accountRepository) DeleteAccount(instanceID string) error {
+	return repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		for _, value := range []interface{}{
+			&model.Message{},
+			&model.Chat{},
+			&model.ChatSettings{},
+			&model.Contact{},
+			&model.MediaBlob{},
+			&model.HistorySyncProgress{},
+			&model.SyncSettings{},
+			&model.RetentionPolicy{},
+			&model.ApiToken{},
+			&model.RateLimits{},
+			&model.SendJob{},
+			&model.Account{},
+		} {
+			if err := tx.Where("instance_id = ?", instanceID).Unscoped().Delete(value).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type ApiTokenRepository interface {
+	CreateToken(token *model.ApiToken) error
+	GetTokenByHash(tokenHash string) (*model.ApiToken, error)
+	GetToken(instanceID string, id uint) (*model.ApiToken, error)
+	GetTokens(instanceID string) ([]model.ApiToken, error)
+	UpdateToken(id uint, data map[string]interface{}) error
+	DeleteToken(id uint) error
+}
+
+type apiTokenRepository struct {
+	database database.Database
+}
+
+func NewApiTokenRepository(database database.Database) *apiTokenRepository {
+	return &apiTokenRepository{database: database}
+}
+
+func (repo *apiTokenRepository) CreateToken(token *model.ApiToken) error {
+	return repo.database.Client().Create(token).Error
+}
+
+func (repo *apiTokenRepository) GetTokenByHash(tokenHash string) (*model.ApiToken, error) {
+	var token model.ApiToken
+	result := repo.database.Client().Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (repo *apiTokenRepository) GetToken(instanceID string, id uint) (*model.ApiToken, error) {
+	var token model.ApiToken
+	result := repo.database.Client().Where("instance_id = ? AND id = ?", instanceID, id).First(&token)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (repo *apiTokenRepository) GetTokens(instanceID string) ([]model.ApiToken, error) {
+	var tokens []model.ApiToken
+	result := repo.database.Client().Where("instance_id = ?", instanceID).Order("created_at").Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+func (repo *apiTokenRepository) UpdateToken(id uint, data map[string]interface{}) error {
+	return repo.database.Client().Model(&model.ApiToken{}).Where("id = ?", id).Updates(data).Error
+}
+
+// DeleteToken removes the token for good, so its hash can't match anymore.
+func (repo *apiTokenRepository) DeleteToken(id uint) error {
+	return repo.database.Client().Unscoped().Delete(&model.ApiToken{}, id).Error
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+	"zapmeow/pkg/encryption"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ChatRepository interface {
+	UpsertChat(chat *model.Chat, unreadIncrement int) error
+	UpsertChatMetadata(chat *model.Chat) error
+	CreateChatsFromMessages() error
+	GetChat(instanceID string, chatJID string) (*model.Chat, error)
+	GetChats(instanceID string, limit int, offset int) ([]model.Chat, error)
+	CountChats(instanceID string) (int64, error)
+	UpdateChat(instanceID string, chatJID string, data map[string]interface{}) error
+	DeleteChat(instanceID string, chatJID string) error
+	DeleteChatsByInstanceID(instanceID string) error
+	UpdateChatSettings(settings *model.ChatSettings, columns ...string) error
+	GetChatSettings(instanceID string, chatJIDs []string) ([]model.ChatSettings, error)
+}
+
+type chatRepository struct {
+	database database.Database
+}
+
+func NewChatRepository(database database.Database) *chatRepository {
+	return &chatRepository{database: database}
+}
+
+// UpsertChat creates the chat or moves its last message forward. Older
+// messages (e.g. from history sync) never replace a newer preview, unless the
+// chat has no message yet, and a newer message sent by us resets the unread
+// count.
+func (repo *chatRepository) UpsertChat(chat *model.Chat, unreadIncrement int) error {
+	preview, err := encryptChatPreview(chat)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return repo.database.Client().Exec(`
+		INSERT INTO chats (
+			created_at, updated_at, instance_id, chat_jid, name, is_group,
+			last_message_id, last_message_body, last_message_from_me, last_message_at, unread_count
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (instance_id, chat_jid) DO UPDATE SET
+			updated_at = excluded.updated_at,
+			deleted_at = NULL,
+			is_group = excluded.is_group,
+			last_message_id = CASE WHEN excluded.last_message_at >= chats.last_message_at OR chats.last_message_id = ''
+				THEN excluded.last_message_id ELSE chats.last_message_id END,
+			last_message_body = CASE WHEN excluded.last_message_at >= chats.last_message_at OR chats.last_message_id = ''
+				THEN excluded.last_message_body ELSE chats.last_message_body END,
+			last_message_from_me = CASE WHEN excluded.last_message_at >= chats.last_message_at OR chats.last_message_id = ''
+				THEN excluded.last_message_from_me ELSE chats.last_message_from_me END,
+			unread_count = CASE WHEN excluded.last_message_from_me AND excluded.last_message_at >= chats.last_message_at
+				THEN 0 ELSE chats.unread_count + excluded.unread_count END,
+			last_message_at = CASE WHEN chats.last_message_id = ''
+				THEN excluded.last_message_at ELSE MAX(chats.last_message_at, excluded.last_message_at) END`,
+		now, now, chat.InstanceID, chat.ChatJID, chat.Name, chat.IsGroup,
+		chat.LastMessageID, preview, chat.LastMessageFromMe, chat.LastMessageAt, unreadIncrement,
+	).Error
+}
+
+// UpsertChatMetadata creates the chat without a last message, or updates its
+// name, description and unread count, e.g. from the conversations of a
+// history sync. The unread count never goes back, as live messages received
+// in the meantime were already counted.
+func (repo *chatRepository) UpsertChatMetadata(chat *model.Chat) error {
+	now := time.Now()
+	return repo.database.Client().Exec(`
+		INSERT INTO chats (
+			created_at, updated_at, instance_id, chat_jid, name, description, is_group,
+			last_message_id, last_message_body, last_message_from_me, last_message_at, unread_count
+		) VALUES (?, ?, ?, ?, ?, ?, ?, '', '', false, ?, ?)
+		ON CONFLICT (instance_id, chat_jid) DO UPDATE SET
+			updated_at = excluded.updated_at,
+			deleted_at = NULL,
+			is_group = excluded.is_group,
+			name = CASE WHEN excluded.name != '' THEN excluded.name ELSE chats.name END,
+			description = CASE WHEN excluded.description != '' THEN excluded.description ELSE chats.description END,
+			unread_count = MAX(chats.unread_count, excluded.unread_count)`,
+		now, now, chat.InstanceID, chat.ChatJID, chat.Name, chat.Description, chat.IsGroup,
+		chat.LastMessageAt, chat.UnreadCount,
+	).Error
+}
+
+// CreateChatsFromMessages backfills the chats of instances that have stored
+// messages but no chats yet, e.g. databases created before chats existed.
+// Only the messages of those instances are read, so it's cheap once every
+// instance has chats. Messages only keep the user part of the chat JID, so
+// groups are recognized by the shape of their IDs, and encrypted text can't
+// be used as a preview.
+func (repo *chatRepository) CreateChatsFromMessages() error {
+	now := time.Now()
+	encrypted := encryption.StringPrefix + "%"
+	// with MAX, SQLite takes the other columns from the newest message. The
+	// index is forced, as the planner otherwise scans every message through
+	// the one on deleted_at.
+	return repo.database.Client().Exec(`
+		INSERT INTO chats (
+			created_at, updated_at, instance_id, chat_jid, name, is_group,
+			last_message_id, last_message_body, last_message_from_me, last_message_at, unread_count
+		)
+		SELECT ?, ?, m.instance_id, m.chat_jid, '',
+			m.chat_jid LIKE '%-%' OR (LENGTH(m.chat_jid) >= 18 AND m.chat_jid LIKE '120363%'),
+			m.message_id,
+			SUBSTR(CASE
+				WHEN m.body != '' AND m.body NOT LIKE ? THEN m.body
+				WHEN m.caption != '' AND m.caption NOT LIKE ? THEN m.caption
+				WHEN m.filename != '' AND m.filename NOT LIKE ? THEN m.filename
+				ELSE m.media_type END, 1, ?),
+			m.from_me, MAX(m.timestamp), 0
+		FROM messages m INDEXED BY idx_messages_instance_chat_timestamp
+		WHERE m.instance_id IN (
+				SELECT a.instance_id FROM accounts a
+				WHERE NOT EXISTS (SELECT 1 FROM chats c WHERE c.instance_id = a.instance_id)
+			)
+			AND m.deleted_at IS NULL
+			AND m.chat_jid != 'status'
+		GROUP BY m.instance_id, m.chat_jid
+		ON CONFLICT (instance_id, chat_jid) DO NOTHING`,
+		now, now, encrypted, encrypted, encrypted, model.ChatPreviewLength,
+	).Error
+}
+
+func (repo *chatRepository) GetChat(instanceID string, chatJID string) (*model.Chat, error) {
+	var chat model.Chat
+	result := repo.database.Client().Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID).First(&chat)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	chats := []model.Chat{chat}
+	if err := decryptChats(chats); err != nil {
+		return nil, err
+	}
+	return &chats[0], nil
+}
+
+func (repo *chatRepository) GetChats(instanceID string, limit int, offset int) ([]model.Chat, error) {
+	var chats []model.Chat
+	if result := repo.database.Client().
+		Where("instance_id = ?", instanceID).
+		Order("last_message_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&chats); result.Error != nil {
+		return nil, result.Error
+	}
+	if err := decryptChats(chats); err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+func (repo *chatRepository) CountChats(instanceID string) (int64, error) {
+	var count int64
+	if result := repo.database.Client().Model(&model.Chat{}).Where("instance_id = ?", instanceID).Count(&count); result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+func (repo *chatRepository) UpdateChat(instanceID string, chatJID string, data map[string]interface{}) error {
+	return repo.database.Client().
+		Model(&model.Chat{}).
+		Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID).
+		Updates(data).Error
+}
+
+func (repo *chatRepository) DeleteChat(instanceID string, chatJID string) error {
+	return repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID).Unscoped().Delete(&model.Chat{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID).Unscoped().Delete(&model.ChatSettings{}).Error
+	})
+}
+
+func (repo *chatRepository) DeleteChatsByInstanceID(instanceID string) error {
+	return repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("instance_id = ?", instanceID).Unscoped().Delete(&model.Chat{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("instance_id = ?", instanceID).Unscoped().Delete(&model.ChatSettings{}).Error
+	})
+}
+
+// UpdateChatSettings creates the settings of a chat or updates only the given
+// columns, so concurrent changes to other settings are kept.
+func (repo *chatRepository) UpdateChatSettings(settings *model.ChatSettings, columns ...string) error {
+	return repo.database.Client().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instance_id"}, {Name: "chat_jid"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at", "deleted_at")),
+	}).Create(settings).Error
+}
+
+func (repo *chatRepository) GetChatSettings(instanceID string, chatJIDs []string) ([]model.ChatSettings, error) {
+	var settings []model.ChatSettings
+	if result := repo.database.Client().Where("instance_id = ? AND chat_jid IN ?", instanceID, chatJIDs).Find(&settings); result.Error != nil {
+		return nil, result.Error
+	}
+	return settings, nil
+}
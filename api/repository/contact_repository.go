@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// contactsBatchSize keeps inserts below the SQLite host parameter limit.
+const contactsBatchSize = 500
+
+type ContactRepository interface {
+	UpsertContacts(contacts []model.Contact, column string) error
+	GetContact(instanceID string, jid string) (*model.Contact, error)
+	DeleteContactsByInstanceID(instanceID string) error
+}
+
+type contactRepository struct {
+	database database.Database
+}
+
+func NewContactRepository(database database.Database) *contactRepository {
+	return &contactRepository{database: database}
+}
+
+// UpsertContacts creates the contacts or updates only the given column, so
+// names learned from different sources don't overwrite each other.
+func (repo *contactRepository) UpsertContacts(contacts []model.Contact, column string) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	return repo.database.Client().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instance_id"}, {Name: "jid"}},
+		DoUpdates: clause.AssignmentColumns([]string{column, "updated_at", "deleted_at"}),
+	}).CreateInBatches(&contacts, contactsBatchSize).Error
+}
+
+func (repo *contactRepository) GetContact(instanceID string, jid string) (*model.Contact, error) {
+	var contact model.Contact
+	result := repo.database.Client().Where("instance_id = ? AND jid = ?", instanceID, jid).First(&contact)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &contact, nil
+}
+
+func (repo *contactRepository) DeleteContactsByInstanceID(instanceID string) error {
+	if result := repo.database.Client().Where("instance_id = ?", instanceID).Unscoped().Delete(&model.Contact{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+)
+
+// Message text, media keys, chat previews, proxy URLs and send job payloads
+// are encrypted right before they're written and decrypted right after
+// they're read, so the rest of the code only sees plaintext.
+
+func makeMessageTextFields(message *model.Message) []*string {
+	return []*string{&message.Body, &message.Caption, &message.Filename}
+}
+
+// encryptMessage encrypts the text and media key of the message in place
+// and returns a function restoring the plaintext once the message is written.
+func encryptMessage(message *model.Message) (func(), error) {
+	plaintext := *message
+	restore := func() {
+		message.Body = plaintext.Body
+		message.Caption = plaintext.Caption
+		message.Filename = plaintext.Filename
+		message.MediaKey = plaintext.MediaKey
+	}
+
+	keyring := helper.GetKeyring()
+	for _, field := range makeMessageTextFields(message) {
+		value, err := keyring.EncryptString(message.InstanceID, *field)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		*field = value
+	}
+
+	if len(message.MediaKey) > 0 {
+		mediaKey, err := keyring.Encrypt(message.InstanceID, message.MediaKey)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		message.MediaKey = mediaKey
+	}
+	return restore, nil
+}
+
+func decryptMessage(message *model.Message) error {
+	keyring := helper.GetKeyring()
+	for _, field := range makeMessageTextFields(message) {
+		value, err := keyring.DecryptString(message.InstanceID, *field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+
+	if len(message.MediaKey) > 0 {
+		mediaKey, err := keyring.Decrypt(message.InstanceID, message.MediaKey)
+		if err != nil {
+			return err
+		}
+		message.MediaKey = mediaKey
+	}
+	return nil
+}
+
+func decryptMessages(messages []model.Message) error {
+	for i := range messages {
+		if err := decryptMessage(&messages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encryptChatPreview(chat *model.Chat) (string, error) {
+	return helper.GetKeyring().EncryptString(chat.InstanceID, chat.LastMessageBody)
+}
+
+func decryptChats(chats []model.Chat) error {
+	keyring := helper.GetKeyring()
+	for i := range chats {
+		value, err := keyring.DecryptString(chats[i].InstanceID, chats[i].LastMessageBody)
+		if err != nil {
+			return err
+		}
+		chats[i].LastMessageBody = value
+	}
+	return nil
+}
+
+// encryptProxyURL encrypts the proxy URL of an account, as it may hold the
+// credentials of the proxy.
+func encryptProxyURL(instanceID string, proxyURL string) (string, error) {
+	return helper.GetKeyring().EncryptString(instanceID, proxyURL)
+}
+
+func decryptAccount(account *model.Account) error {
+	value, err := helper.GetKeyring().DecryptString(account.InstanceID, account.ProxyURL)
+	if err != nil {
+		return err
+	}
+	account.ProxyURL = value
+	return nil
+}
+
+func decryptAccounts(accounts []model.Account) error {
+	for i := range accounts {
+		if err := decryptAccount(&accounts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptSendJobPayload encrypts the payload of a send job, as it holds the
+// text and media of the message.
+func encryptSendJobPayload(job *model.SendJob) (string, error) {
+	return helper.GetKeyring().EncryptString(job.InstanceID, job.Payload)
+}
+
+func decryptSendJob(job *model.SendJob) error {
+	value, err := helper.GetKeyring().DecryptString(job.InstanceID, job.Payload)
+	if err != nil {
+		return err
+	}
+	job.Payload = value
+	return nil
+}
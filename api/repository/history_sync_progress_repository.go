@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type HistorySyncProgressRepository interface {
+	GetProgress(instanceID string, syncType string) (*model.HistorySyncProgress, error)
+	GetProgressByInstanceID(instanceID string) ([]model.HistorySyncProgress, error)
+	SaveProgress(progress *model.HistorySyncProgress) error
+	DeleteProgressByInstanceID(instanceID string) error
+}
+
+type historySyncProgressRepository struct {
+	database database.Database
+}
+
+func NewHistorySyncProgressRepository(database database.Database) *historySyncProgressRepository {
+	return &historySyncProgressRepository{database: database}
+}
+
+func (repo *historySyncProgressRepository) GetProgress(instanceID string, syncType string) (*model.HistorySyncProgress, error) {
+	var progress model.HistorySyncProgress
+	result := repo.database.Client().Where("instance_id = ? AND sync_type = ?", instanceID, syncType).First(&progress)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &progress, nil
+}
+
+func (repo *historySyncProgressRepository) GetProgressByInstanceID(instanceID string) ([]model.HistorySyncProgress, error) {
+	var progress []model.HistorySyncProgress
+	if result := repo.database.Client().Where("instance_id = ?", instanceID).Order("created_at").Find(&progress); result.Error != nil {
+		return nil, result.Error
+	}
+	return progress, nil
+}
+
+func (repo *historySyncProgressRepository) SaveProgress(progress *model.HistorySyncProgress) error {
+	return repo.database.Client().Save(progress).Error
+}
+
+func (repo *historySyncProgressRepository) DeleteProgressByInstanceID(instanceID string) error {
+	if result := repo.database.Client().Where("instance_id = ?", instanceID).Unscoped().Delete(&model.HistorySyncProgress{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"time"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// releaseBatchSize bounds the hashes released per query, below the SQLite
+// host parameter limit.
+const releaseBatchSize = 500
+
+// mediaReturning returns the media columns of the messages a query changed,
+// so only their references are released.
+var mediaReturning = clause.Returning{Columns: []clause.Column{
+	{Name: "instance_id"},
+	{Name: "media_path"},
+	{Name: "media_sha256"},
+	{Name: "media_expired"},
+}}
+
+type MediaBlobRepository interface {
+	AcquireBlob(blob *model.MediaBlob) error
+	ReleaseBlobs(instanceID string, refs map[string]int) ([]model.MediaBlob, error)
+	ReleaseMessagesMedia(messages []model.Message) ([]string, error)
+	GetBlob(instanceID string, sha256 string) (*model.MediaBlob, error)
+}
+
+type mediaBlobRepository struct {
+	database database.Database
+}
+
+func NewMediaBlobRepository(database database.Database) *mediaBlobRepository {
+	return &mediaBlobRepository{database: database}
+}
+
+// AcquireBlob creates the blob with one reference or adds a reference to the
+// existing one, whose path is loaded back into blob.
+func (repo *mediaBlobRepository) AcquireBlob(blob *model.MediaBlob) error {
+	now := time.Now()
+	return repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO media_blobs (created_at, updated_at, instance_id, sha256, path, size, ref_count)
+			VALUES (?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT (instance_id, sha256) DO UPDATE SET
+				updated_at = excluded.updated_at,
+				ref_count = media_blobs.ref_count + 1`,
+			now, now, blob.InstanceID, blob.SHA256, blob.Path, blob.Size,
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("instance_id = ? AND sha256 = ?", blob.InstanceID, blob.SHA256).First(blob).Error
+	})
+}
+
+// ReleaseBlobs drops refs[sha256] references from each blob and deletes the
+// rows left without references, which are returned so their files can go.
+func (repo *mediaBlobRepository) ReleaseBlobs(instanceID string, refs map[string]int) ([]model.MediaBlob, error) {
+	var released []model.MediaBlob
+	err := repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		var err error
+		released, err = releaseBlobs(tx, instanceID, refs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// ReleaseMessagesMedia drops the media references of the messages and
+// returns the files no message uses anymore.
+func (repo *mediaBlobRepository) ReleaseMessagesMedia(messages []model.Message) ([]string, error) {
+	var paths []string
+	err := repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		var err error
+		paths, err = releaseMessagesMedia(tx, messages)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func (repo *mediaBlobRepository) GetBlob(instanceID string, sha256 string) (*model.MediaBlob, error) {
+	var blob model.MediaBlob
+	result := repo.database.Client().Where("instance_id = ? AND sha256 = ?", instanceID, sha256).First(&blob)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &blob, nil
+}
+
+func releaseBlobs(tx *gorm.DB, instanceID string, refs map[string]int) ([]model.MediaBlob, error) {
+	hashes := make([]string, 0, len(refs))
+	for hash, count := range refs {
+		err := tx.Model(&model.MediaBlob{}).
+			Where("instance_id = ? AND sha256 = ?", instanceID, hash).
+			Update("ref_count", gorm.Expr("ref_count - ?", count)).Error
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	var released []model.MediaBlob
+	for start := 0; start < len(hashes); start += releaseBatchSize {
+		end := helper.Min(start+releaseBatchSize, len(hashes))
+		var batch []model.MediaBlob
+		err := tx.Where("instance_id = ? AND sha256 IN ? AND ref_count <= 0", instanceID, hashes[start:end]).
+			Find(&batch).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err := tx.Unscoped().Delete(&batch).Error; err != nil {
+			return nil, err
+		}
+		released = append(released, batch...)
+	}
+	return released, nil
+}
+
+// releaseMessagesMedia drops the blob references of the messages within tx
+// and returns the files left without references. Files saved before
+// deduplication have no blob and are always returned.
+func releaseMessagesMedia(tx *gorm.DB, messages []model.Message) ([]string, error) {
+	var paths []string
+	refs := make(map[string]map[string]int)
+	for _, message := range messages {
+		if message.MediaPath == "" {
+			continue
+		}
+
+		if message.MediaSHA256 == "" {
+			paths = append(paths, message.MediaPath)
+			continue
+		}
+
+		if refs[message.InstanceID] == nil {
+			refs[message.InstanceID] = make(map[string]int)
+		}
+		refs[message.InstanceID][message.MediaSHA256]++
+	}
+
+	for instanceID, instanceRefs := range refs {
+		released, err := releaseBlobs(tx, instanceID, instanceRefs)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range released {
+			paths = append(paths, blob.Path)
+		}
+	}
+	return paths, nil
+}
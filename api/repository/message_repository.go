@@ -1,20 +1,33 @@
 package repository
 
 import (
+	"time"
 	"zapmeow/api/model"
 	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
 )
 
 type MessageRepository interface {
 	CreateMessage(message *model.Message) error
 	CreateMessages(messages *[]model.Message) error
 	GetChatMessages(instanceID string, chatJID string) (*[]model.Message, error)
+	GetChatMessagesAfter(instanceID string, chatJID string, after *model.Message, limit int) ([]model.Message, error)
 	CountChatMessages(instanceID string, chatJID string) (int64, error)
-	DeleteMessagesByInstanceID(instanceID string) error
+	DeleteMessagesByInstanceID(instanceID string) ([]string, error)
+	DeleteChatMessages(instanceID string, chatJID string, until time.Time) ([]string, error)
+	SearchMessages(instanceID string, filter model.MessageSearchFilter) ([]model.MessageSearchResult, error)
+	GetMediaMessages(instanceID string, mediaType string, before time.Time) ([]model.Message, error)
+	ExpireMessagesMedia(ids []uint) ([]string, error)
+	GetStoredMessageIDs(instanceID string, messageIDs []string) ([]string, error)
+	GetMessage(instanceID string, messageID string) (*model.Message, error)
+	UpdateMessage(id uint, data map[string]interface{}) error
+	SetMessageMedia(id uint, mediaPath string, mediaSHA256 string) (bool, error)
 }
 
 type messageRepository struct {
-	database database.Database
+	database       database.Database
+	fullTextSearch bool
 }
 
 func NewMessageRepository(database database.Database) *messageRepository {
@@ -22,10 +35,24 @@ func NewMessageRepository(database database.Database) *messageRepository {
 }
 
 func (repo *messageRepository) CreateMessage(message *model.Message) error {
+	restore, err := encryptMessage(message)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
 	return repo.database.Client().Create(message).Error
 }
 
 func (repo *messageRepository) CreateMessages(messages *[]model.Message) error {
+	for i := range *messages {
+		restore, err := encryptMessage(&(*messages)[i])
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
 	return repo.database.Client().Create(messages).Error
 }
 
@@ -42,12 +69,169 @@ func (repo *messageRepository) GetChatMessages(instanceID string, chatJID string
 	if result := repo.database.Client().Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID).Order("timestamp DESC").Find(&messages); result.Error != nil {
 		return nil, result.Error
 	}
+	if err := decryptMessages(messages); err != nil {
+		return nil, err
+	}
 	return &messages, nil
 }
 
-func (repo *messageRepository) DeleteMessagesByInstanceID(instanceID string) error {
-	if result := repo.database.Client().Where("instance_id = ?", instanceID).Unscoped().Delete(&model.Message{}); result.Error != nil {
-		return result.Error
+// GetChatMessagesAfter pages through a chat in chronological order, starting
+// right after the given message (or at the beginning when it's nil).
+func (repo *messageRepository) GetChatMessagesAfter(instanceID string, chatJID string, after *model.Message, limit int) ([]model.Message, error) {
+	query := repo.database.Client().Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID)
+	if after != nil {
+		query = query.Where("timestamp > ? OR (timestamp = ? AND id > ?)", after.Timestamp, after.Timestamp, after.ID)
+	}
+
+	var messages []model.Message
+	if result := query.Order("timestamp ASC, id ASC").Limit(limit).Find(&messages); result.Error != nil {
+		return nil, result.Error
+	}
+	if err := decryptMessages(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DeleteMessagesByInstanceID deletes the messages of the instance and drops
+// their media references, returning the files no message uses anymore.
+func (repo *messageRepository) DeleteMessagesByInstanceID(instanceID string) ([]string, error) {
+	return repo.deleteMessages(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("instance_id = ?", instanceID)
+	})
+}
+
+// DeleteChatMessages deletes the messages of a chat sent up to until, or all
+// of them when until is zero, and drops their media references, returning
+// the files no message uses anymore.
+func (repo *messageRepository) DeleteChatMessages(instanceID string, chatJID string, until time.Time) ([]string, error) {
+	return repo.deleteMessages(func(tx *gorm.DB) *gorm.DB {
+		query := tx.Where("instance_id = ? AND chat_jid = ?", instanceID, chatJID)
+		if !until.IsZero() {
+			query = query.Where("timestamp <= ?", until)
+		}
+		return query
+	})
+}
+
+// deleteMessages deletes the messages matched by scope and releases the
+// media of the rows it actually deleted, in the same transaction.
+func (repo *messageRepository) deleteMessages(scope func(tx *gorm.DB) *gorm.DB) ([]string, error) {
+	var paths []string
+	err := repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		var deleted []model.Message
+		if err := tx.Scopes(scope).Clauses(mediaReturning).Unscoped().Delete(&deleted).Error; err != nil {
+			return err
+		}
+
+		stored := make([]model.Message, 0, len(deleted))
+		for _, message := range deleted {
+			if message.MediaPath != "" && !message.MediaExpired {
+				stored = append(stored, message)
+			}
+		}
+
+		var err error
+		paths, err = releaseMessagesMedia(tx, stored)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// GetMediaMessages returns the messages whose media is still stored, newest
+// first. An empty mediaType matches all types and a zero before all dates.
+func (repo *messageRepository) GetMediaMessages(instanceID string, mediaType string, before time.Time) ([]model.Message, error) {
+	query := repo.database.Client().
+		Select("id", "instance_id", "media_type", "media_path", "media_sha256", "timestamp").
+		Where("instance_id = ? AND media_path != '' AND media_expired = ?", instanceID, false)
+	if mediaType != "" {
+		query = query.Where("media_type = ?", mediaType)
 	}
-	return nil
+	if !before.IsZero() {
+		query = query.Where("timestamp < ?", before)
+	}
+
+	var messages []model.Message
+	if result := query.Order("timestamp DESC").Find(&messages); result.Error != nil {
+		return nil, result.Error
+	}
+	return messages, nil
+}
+
+// ExpireMessagesMedia flags the media of the messages as expired and drops
+// the references of the rows it actually expired, in the same transaction,
+// returning the files no message uses anymore.
+func (repo *messageRepository) ExpireMessagesMedia(ids []uint) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var paths []string
+	err := repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		var expired []model.Message
+		err := tx.Model(&expired).
+			Clauses(mediaReturning).
+			Where("id IN ? AND media_path != '' AND media_expired = ?", ids, false).
+			Update("media_expired", true).Error
+		if err != nil {
+			return err
+		}
+
+		paths, err = releaseMessagesMedia(tx, expired)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// GetStoredMessageIDs returns which of the WhatsApp message IDs are stored.
+func (repo *messageRepository) GetStoredMessageIDs(instanceID string, messageIDs []string) ([]string, error) {
+	var stored []string
+	if result := repo.database.Client().
+		Model(&model.Message{}).
+		Where("instance_id = ? AND message_id IN ?", instanceID, messageIDs).
+		Pluck("message_id", &stored); result.Error != nil {
+		return nil, result.Error
+	}
+	return stored, nil
+}
+
+func (repo *messageRepository) GetMessage(instanceID string, messageID string) (*model.Message, error) {
+	var message model.Message
+	result := repo.database.Client().Where("instance_id = ? AND message_id = ?", instanceID, messageID).First(&message)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	if err := decryptMessage(&message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (repo *messageRepository) UpdateMessage(id uint, data map[string]interface{}) error {
+	return repo.database.Client().
+		Model(&model.Message{}).
+		Where("id = ?", id).
+		Updates(data).Error
+}
+
+// SetMessageMedia stores the media of a message downloaded after the message,
+// unless it was stored in the meantime, and tells whether it was set.
+func (repo *messageRepository) SetMessageMedia(id uint, mediaPath string, mediaSHA256 string) (bool, error) {
+	result := repo.database.Client().
+		Model(&model.Message{}).
+		Where("id = ? AND media_path = '' AND media_expired = ?", id, false).
+		Updates(map[string]interface{}{
+			"media_path":   mediaPath,
+			"media_sha256": mediaSHA256,
+		})
+	return result.RowsAffected > 0, result.Error
 }
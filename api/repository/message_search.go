@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	snippetOpen     = "<mark>"
+	snippetClose    = "</mark>"
+	snippetEllipsis = "…"
+	snippetTokens   = 16
+	snippetRadius   = 60
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// The FTS5 table uses the messages table as external content, so the
+// triggers below keep the index in sync with every writer.
+var searchIndexStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		body, filename, caption,
+		content='messages', content_rowid='id'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, body, filename, caption)
+		VALUES (new.id, new.body, new.filename, new.caption);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, body, filename, caption)
+		VALUES ('delete', old.id, old.body, old.filename, old.caption);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, body, filename, caption)
+		VALUES ('delete', old.id, old.body, old.filename, old.caption);
+		INSERT INTO messages_fts(rowid, body, filename, caption)
+		VALUES (new.id, new.body, new.filename, new.caption);
+	END`,
+}
+
+var dropSearchIndexStatements = []string{
+	"DROP TRIGGER IF EXISTS messages_fts_ai",
+	"DROP TRIGGER IF EXISTS messages_fts_ad",
+	"DROP TRIGGER IF EXISTS messages_fts_au",
+	"DROP TABLE IF EXISTS messages_fts",
+}
+
+// SetupSearchIndex creates the FTS5 index over the messages table. When the
+// sqlite driver was built without FTS5 (the sqlite_fts5 build tag), the error
+// is returned and searches fall back to LIKE queries. With encryption at rest
+// the index is dropped instead, as it would keep a plaintext copy of messages.
+func (repo *messageRepository) SetupSearchIndex() error {
+	client := repo.database.Client()
+	if helper.GetKeyring().Enabled() {
+		return client.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range dropSearchIndexStatements {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	exists := client.Migrator().HasTable("messages_fts")
+	err := client.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range searchIndexStatements {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		if !exists {
+			return tx.Exec("INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')").Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	repo.fullTextSearch = true
+	return nil
+}
+
+func (repo *messageRepository) SearchMessages(instanceID string, filter model.MessageSearchFilter) ([]model.MessageSearchResult, error) {
+	terms := strings.Fields(filter.Query)
+	if len(terms) == 0 {
+		return []model.MessageSearchResult{}, nil
+	}
+
+	if repo.fullTextSearch {
+		return repo.searchFullText(instanceID, terms, filter)
+	}
+	return repo.searchLike(instanceID, terms, filter)
+}
+
+func (repo *messageRepository) searchFullText(instanceID string, terms []string, filter model.MessageSearchFilter) ([]model.MessageSearchResult, error) {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	query := repo.database.Client().
+		Table("messages_fts").
+		Select(
+			"messages.*, snippet(messages_fts, -1, ?, ?, ?, ?) AS snippet, -bm25(messages_fts) AS score",
+			snippetOpen, snippetClose, snippetEllipsis, snippetTokens,
+		).
+		Joins("JOIN messages ON messages.id = messages_fts.rowid").
+		Where("messages_fts MATCH ?", strings.Join(quoted, " "))
+	query = applySearchFilter(query, instanceID, filter).Order("score DESC")
+
+	var results []model.MessageSearchResult
+	if err := query.Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (repo *messageRepository) searchLike(instanceID string, terms []string, filter model.MessageSearchFilter) ([]model.MessageSearchResult, error) {
+	query := repo.database.Client().Table("messages").Select("messages.*")
+	for _, term := range terms {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		query = query.Where(
+			`messages.body LIKE ? ESCAPE '\' OR messages.filename LIKE ? ESCAPE '\' OR messages.caption LIKE ? ESCAPE '\'`,
+			pattern, pattern, pattern,
+		)
+	}
+	query = applySearchFilter(query, instanceID, filter).Order("messages.timestamp DESC")
+
+	var results []model.MessageSearchResult
+	if err := query.Scan(&results).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Snippet = makeSnippet(results[i].Message, terms)
+	}
+	return results, nil
+}
+
+func applySearchFilter(query *gorm.DB, instanceID string, filter model.MessageSearchFilter) *gorm.DB {
+	query = query.Where("messages.instance_id = ? AND messages.deleted_at IS NULL", instanceID)
+	if filter.Chat != "" {
+		query = query.Where("messages.chat_jid = ?", filter.Chat)
+	}
+	if filter.From != nil {
+		query = query.Where("messages.timestamp >= ?", filter.From.Local())
+	}
+	if filter.To != nil {
+		query = query.Where("messages.timestamp <= ?", filter.To.Local())
+	}
+	return query.Limit(filter.Limit).Offset(filter.Offset)
+}
+
+// makeSnippet approximates the FTS5 snippet() output for LIKE searches by
+// highlighting the first matching term in the first matching column.
+func makeSnippet(message model.Message, terms []string) string {
+	for _, text := range []string{message.Body, message.Caption, message.Filename} {
+		for _, term := range terms {
+			loc := regexp.MustCompile("(?i)" + regexp.QuoteMeta(term)).FindStringIndex(text)
+			if loc == nil {
+				continue
+			}
+
+			start := snippetBoundary(text, loc[0]-snippetRadius)
+			end := snippetBoundary(text, loc[1]+snippetRadius)
+			snippet := text[start:loc[0]] + snippetOpen + text[loc[0]:loc[1]] + snippetClose + text[loc[1]:end]
+			if start > 0 {
+				snippet = snippetEllipsis + snippet
+			}
+			if end < len(text) {
+				snippet += snippetEllipsis
+			}
+			return snippet
+		}
+	}
+	return ""
+}
+
+func snippetBoundary(text string, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= len(text) {
+		return len(text)
+	}
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RateLimitsRepository interface {
+	GetLimits(instanceID string) (*model.RateLimits, error)
+	SaveLimits(limits *model.RateLimits) error
+	DeleteLimits(instanceID string) error
+}
+
+type rateLimitsRepository struct {
+	database database.Database
+}
+
+func NewRateLimitsRepository(database database.Database) *rateLimitsRepository {
+	return &rateLimitsRepository{database: database}
+}
+
+func (repo *rateLimitsRepository) GetLimits(instanceID string) (*model.RateLimits, error) {
+	var limits model.RateLimits
+	result := repo.database.Client().Where("instance_id = ?", instanceID).First(&limits)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &limits, nil
+}
+
+func (repo *rateLimitsRepository) SaveLimits(limits *model.RateLimits) error {
+	return repo.database.Client().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"messages_per_second",
+			"messages_per_minute",
+			"new_chats_per_day",
+			"min_interval_ms",
+			"max_interval_ms",
+			"updated_at",
+			"deleted_at",
+		}),
+	}).Create(limits).Error
+}
+
+func (repo *rateLimitsRepository) DeleteLimits(instanceID string) error {
+	return repo.database.Client().Where("instance_id = ?", instanceID).Unscoped().Delete(&model.RateLimits{}).Error
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type RetentionPolicyRepository interface {
+	GetPolicies() ([]model.RetentionPolicy, error)
+	GetPoliciesByInstanceID(instanceID string) ([]model.RetentionPolicy, error)
+	ReplacePolicies(instanceID string, policies []model.RetentionPolicy) error
+}
+
+type retentionPolicyRepository struct {
+	database database.Database
+}
+
+func NewRetentionPolicyRepository(database database.Database) *retentionPolicyRepository {
+	return &retentionPolicyRepository{database: database}
+}
+
+func (repo *retentionPolicyRepository) GetPolicies() ([]model.RetentionPolicy, error) {
+	var policies []model.RetentionPolicy
+	if result := repo.database.Client().Find(&policies); result.Error != nil {
+		return nil, result.Error
+	}
+	return policies, nil
+}
+
+func (repo *retentionPolicyRepository) GetPoliciesByInstanceID(instanceID string) ([]model.RetentionPolicy, error) {
+	var policies []model.RetentionPolicy
+	if result := repo.database.Client().Where("instance_id = ?", instanceID).Order("media_type").Find(&policies); result.Error != nil {
+		return nil, result.Error
+	}
+	return policies, nil
+}
+
+func (repo *retentionPolicyRepository) ReplacePolicies(instanceID string, policies []model.RetentionPolicy) error {
+	return repo.database.Client().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("instance_id = ?", instanceID).Unscoped().Delete(&model.RetentionPolicy{}).Error; err != nil {
+			return err
+		}
+		if len(policies) == 0 {
+			return nil
+		}
+		return tx.Create(&policies).Error
+	})
+}
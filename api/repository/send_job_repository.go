@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type SendJobRepository interface {
+	CreateJob(job *model.SendJob) error
+	GetJob(instanceID string, id uint) (*model.SendJob, error)
+	// GetNextJobs returns the ID, instance and due time of the oldest
+	// unfinished job of each instance.
+	GetNextJobs() ([]model.SendJob, error)
+	// GetNextJob returns the oldest unfinished job of the instance with its
+	// payload as stored, to be decrypted by DecryptPayload once it's sent.
+	GetNextJob(instanceID string) (*model.SendJob, error)
+	DecryptPayload(job *model.SendJob) error
+	// ClaimJob marks a due job as processing until the given time, failing
+	// when another worker claimed it first.
+	ClaimJob(job *model.SendJob, until time.Time) (bool, error)
+	UpdateJob(id uint, data map[string]interface{}) error
+}
+
+type sendJobRepository struct {
+	database database.Database
+}
+
+func NewSendJobRepository(database database.Database) *sendJobRepository {
+	return &sendJobRepository{database: database}
+}
+
+func (repo *sendJobRepository) CreateJob(job *model.SendJob) error {
+	payload := job.Payload
+	defer func() {
+		job.Payload = payload
+	}()
+
+	encrypted, err := encryptSendJobPayload(job)
+	if err != nil {
+		return err
+	}
+	job.Payload = encrypted
+	return repo.database.Client().Create(job).Error
+}
+
+func (repo *sendJobRepository) GetJob(instanceID string, id uint) (*model.SendJob, error) {
+	var job model.SendJob
+	result := repo.database.Client().Where("instance_id = ? AND id = ?", instanceID, id).First(&job)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	if err := decryptSendJob(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (repo *sendJobRepository) GetNextJobs() ([]model.SendJob, error) {
+	var jobs []model.SendJob
+	next := repo.database.Client().
+		Model(&model.SendJob{}).
+		Select("MIN(id)").
+		Where("status IN ?", []string{model.SendJobPending, model.SendJobProcessing}).
+		Group("instance_id")
+	result := repo.database.Client().
+		Select("id", "instance_id", "next_attempt_at").
+		Where("id IN (?)", next).
+		Order("id").
+		Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+func (repo *sendJobRepository) GetNextJob(instanceID string) (*model.SendJob, error) {
+	var job model.SendJob
+	result := repo.database.Client().
+		Where("instance_id = ? AND status IN ?", instanceID, []string{model.SendJobPending, model.SendJobProcessing}).
+		Order("id").
+		First(&job)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (repo *sendJobRepository) DecryptPayload(job *model.SendJob) error {
+	return decryptSendJob(job)
+}
+
+func (repo *sendJobRepository) ClaimJob(job *model.SendJob, until time.Time) (bool, error) {
+	result := repo.database.Client().
+		Model(&model.SendJob{}).
+		Where(
+			"id = ? AND status IN ? AND next_attempt_at <= ?",
+			job.ID,
+			[]string{model.SendJobPending, model.SendJobProcessing},
+			time.Now(),
+		).
+		Updates(map[string]interface{}{
+			"Status":        model.SendJobProcessing,
+			"NextAttemptAt": until,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	job.Status = model.SendJobProcessing
+	job.NextAttemptAt = until
+	return true, nil
+}
+
+func (repo *sendJobRepository) UpdateJob(id uint, data map[string]interface{}) error {
+	return repo.database.Client().Model(&model.SendJob{}).Where("id = ?", id).Updates(data).Error
+}
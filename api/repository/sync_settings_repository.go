@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/pkg/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SyncSettingsRepository interface {
+	GetSettings(instanceID string) (*model.SyncSettings, error)
+	SaveSettings(settings *model.SyncSettings) error
+}
+
+type syncSettingsRepository struct {
+	database database.Database
+}
+
+func NewSyncSettingsRepository(database database.Database) *syncSettingsRepository {
+	return &syncSettingsRepository{database: database}
+}
+
+func (repo *syncSettingsRepository) GetSettings(instanceID string) (*model.SyncSettings, error) {
+	var settings model.SyncSettings
+	result := repo.database.Client().Where("instance_id = ?", instanceID).First(&settings)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, nil
+	}
+	return &settings, nil
+}
+
+func (repo *syncSettingsRepository) SaveSettings(settings *model.SyncSettings) error {
+	return repo.database.Client().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"enabled",
+			"max_messages_per_chat",
+			"max_age_days",
+			"include_groups",
+			"download_media",
+			"updated_at",
+			"deleted_at",
+		}),
+	}).Create(settings).Error
+}
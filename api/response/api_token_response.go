@@ -0,0 +1,49 @@
+package response
+
+import (
+	"strings"
+	"time"
+	"zapmeow/api/model"
+)
+
+type ApiToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ApiTokenSecret is returned when a token is created or rotated, the only
+// times the token itself is known.
+type ApiTokenSecret struct {
+	ApiToken
+	Token string `json:"token"`
+}
+
+func NewApiTokenResponse(token model.ApiToken) ApiToken {
+	return ApiToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     strings.Split(token.Scopes, ","),
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+func NewApiTokensResponse(tokens []model.ApiToken) []ApiToken {
+	data := make([]ApiToken, 0, len(tokens))
+	for _, token := range tokens {
+		data = append(data, NewApiTokenResponse(token))
+	}
+	return data
+}
+
+func NewApiTokenSecretResponse(token model.ApiToken, secret string) ApiTokenSecret {
+	return ApiTokenSecret{
+		ApiToken: NewApiTokenResponse(token),
+		Token:    secret,
+	}
+}
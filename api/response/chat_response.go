@@ -0,0 +1,51 @@
+package response
+
+import (
+	"time"
+	"zapmeow/api/model"
+)
+
+type Chat struct {
+	Chat              string     `json:"chat"`
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	IsGroup           bool       `json:"is_group"`
+	LastMessageID     string     `json:"last_message_id"`
+	LastMessageBody   string     `json:"last_message_body"`
+	LastMessageFromMe bool       `json:"last_message_from_me"`
+	LastMessageAt     time.Time  `json:"last_message_at"`
+	UnreadCount       int        `json:"unread_count"`
+	Archived          bool       `json:"archived"`
+	Pinned            bool       `json:"pinned"`
+	Muted             bool       `json:"muted"`
+	MutedUntil        *time.Time `json:"muted_until"`
+	MarkedUnread      bool       `json:"marked_unread"`
+}
+
+func NewChatResponse(chat model.Chat, settings model.ChatSettings) Chat {
+	return Chat{
+		Chat:              chat.ChatJID,
+		Name:              chat.Name,
+		Description:       chat.Description,
+		IsGroup:           chat.IsGroup,
+		LastMessageID:     chat.LastMessageID,
+		LastMessageBody:   chat.LastMessageBody,
+		LastMessageFromMe: chat.LastMessageFromMe,
+		LastMessageAt:     chat.LastMessageAt,
+		UnreadCount:       chat.UnreadCount,
+		Archived:          settings.Archived,
+		Pinned:            settings.Pinned,
+		Muted:             settings.Muted,
+		MutedUntil:        settings.MutedUntil,
+		MarkedUnread:      settings.MarkedUnread,
+	}
+}
+
+func NewChatsResponse(chats []model.Chat, settings map[string]model.ChatSettings) []Chat {
+	data := []Chat{}
+	for _, chat := range chats {
+		data = append(data, NewChatResponse(chat, settings[chat.ChatJID]))
+	}
+
+	return data
+}
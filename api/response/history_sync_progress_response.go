@@ -0,0 +1,42 @@
+package response
+
+import (
+	"time"
+	"zapmeow/api/model"
+)
+
+type HistorySyncProgress struct {
+	SyncType              string     `json:"sync_type"`
+	Chunks                int        `json:"chunks"`
+	LastChunkOrder        uint32     `json:"last_chunk_order"`
+	Progress              uint32     `json:"progress"`
+	ConversationsImported int        `json:"conversations_imported"`
+	MessagesImported      int        `json:"messages_imported"`
+	Completed             bool       `json:"completed"`
+	RequestedAt           *time.Time `json:"requested_at"`
+	LastChunkAt           *time.Time `json:"last_chunk_at"`
+	CompletedAt           *time.Time `json:"completed_at"`
+}
+
+func NewHistorySyncProgressResponse(progress model.HistorySyncProgress) HistorySyncProgress {
+	return HistorySyncProgress{
+		SyncType:              progress.SyncType,
+		Chunks:                progress.Chunks,
+		LastChunkOrder:        progress.LastChunkOrder,
+		Progress:              progress.Progress,
+		ConversationsImported: progress.ConversationsImported,
+		MessagesImported:      progress.MessagesImported,
+		Completed:             progress.Completed,
+		RequestedAt:           progress.RequestedAt,
+		LastChunkAt:           progress.LastChunkAt,
+		CompletedAt:           progress.CompletedAt,
+	}
+}
+
+func NewHistorySyncProgressesResponse(progress []model.HistorySyncProgress) []HistorySyncProgress {
+	data := make([]HistorySyncProgress, 0, len(progress))
+	for _, syncProgress := range progress {
+		data = append(data, NewHistorySyncProgressResponse(syncProgress))
+	}
+	return data
+}
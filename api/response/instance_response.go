@@ -0,0 +1,58 @@
+package response
+
+import (
+	"net/url"
+	"time"
+	"zapmeow/api/model"
+)
+
+type Instance struct {
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	Tenant             string     `json:"tenant"`
+	WebhookURL         string     `json:"webhook_url"`
+	ProxyURL           string     `json:"proxy_url"`
+	DeviceName         string     `json:"device_name"`
+	DevicePlatform     string     `json:"device_platform"`
+	DeviceBrowserLabel string     `json:"device_browser_label"`
+	Status             string     `json:"status"`
+	Phone              string     `json:"phone"`
+	ConnectionState    string     `json:"connection_state"`
+	ConnectionError    string     `json:"connection_error"`
+	ReconnectAttempts  int        `json:"reconnect_attempts"`
+	LastConnectedAt    *time.Time `json:"last_connected_at"`
+	LastDisconnectedAt *time.Time `json:"last_disconnected_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func NewInstanceResponse(account model.Account, status string) Instance {
+	return Instance{
+		ID:                 account.InstanceID,
+		Name:               account.Name,
+		Tenant:             account.Tenant,
+		WebhookURL:         account.WebhookURL,
+		ProxyURL:           makeProxyURL(account.ProxyURL),
+		DeviceName:         account.DeviceName,
+		DevicePlatform:     account.DevicePlatform,
+		DeviceBrowserLabel: account.DeviceBrowserLabel,
+		Status:             status,
+		Phone:              account.User,
+		ConnectionState:    account.ConnectionState,
+		ConnectionError:    account.ConnectionError,
+		ReconnectAttempts:  account.ReconnectAttempts,
+		LastConnectedAt:    account.LastConnectedAt,
+		LastDisconnectedAt: account.LastDisconnectedAt,
+		CreatedAt:          account.CreatedAt,
+		UpdatedAt:          account.UpdatedAt,
+	}
+}
+
+// makeProxyURL hides the password of the proxy.
+func makeProxyURL(proxyURL string) string {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Redacted()
+}
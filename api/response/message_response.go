@@ -3,9 +3,9 @@ package response
 import (
 	"encoding/base64"
 	"mime"
-	"os"
 	"path/filepath"
 	"time"
+	"zapmeow/api/helper"
 	"zapmeow/api/model"
 )
 
@@ -17,9 +17,12 @@ type Message struct {
 	FromMe        bool      `json:"from_me"`
 	Timestamp     time.Time `json:"timestamp"`
 	Body          string    `json:"body"`
+	Caption       string    `json:"caption"`
+	Filename      string    `json:"filename"`
 	MediaType     string    `json:"media_type"`
 	MediaMimeType string    `json:"media_mimetype"`
 	MediaBase64   string    `json:"media_base64"`
+	MediaError    string    `json:"media_error"`
 }
 
 func NewMessageResponse(msg model.Message) Message {
@@ -31,13 +34,17 @@ func NewMessageResponse(msg model.Message) Message {
 		FromMe:    msg.FromMe,
 		Timestamp: msg.Timestamp,
 		Body:      msg.Body,
+		Caption:   msg.Caption,
+		Filename:  msg.Filename,
 		MediaType: msg.MediaType,
 	}
 
-	if msg.MediaType != "" {
-		media, err := os.ReadFile(msg.MediaPath)
+	if msg.MediaExpired {
+		data.MediaError = "media expired"
+	} else if msg.MediaType != "" {
+		media, err := helper.ReadMedia(msg.InstanceID, msg.MediaPath)
 		if err != nil {
-			// logger.Error("Error reading the file. ", err)
+			data.MediaError = "media unavailable"
 		} else {
 			mimetype := mime.TypeByExtension(filepath.Ext(msg.MediaPath))
 			base64 := base64.StdEncoding.EncodeToString(media)
@@ -57,3 +64,22 @@ func NewMessagesResponse(msgs *[]model.Message) []Message {
 
 	return data
 }
+
+type SearchResult struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+func NewSearchResultsResponse(results []model.MessageSearchResult) []SearchResult {
+	data := []SearchResult{}
+	for _, result := range results {
+		data = append(data, SearchResult{
+			Message: NewMessageResponse(result.Message),
+			Snippet: result.Snippet,
+			Score:   result.Score,
+		})
+	}
+
+	return data
+}
@@ -0,0 +1,21 @@
+package response
+
+import "zapmeow/api/model"
+
+type RateLimits struct {
+	MessagesPerSecond int `json:"messages_per_second"`
+	MessagesPerMinute int `json:"messages_per_minute"`
+	NewChatsPerDay    int `json:"new_chats_per_day"`
+	MinIntervalMs     int `json:"min_interval_ms"`
+	MaxIntervalMs     int `json:"max_interval_ms"`
+}
+
+func NewRateLimitsResponse(limits *model.RateLimits) RateLimits {
+	return RateLimits{
+		MessagesPerSecond: limits.MessagesPerSecond,
+		MessagesPerMinute: limits.MessagesPerMinute,
+		NewChatsPerDay:    limits.NewChatsPerDay,
+		MinIntervalMs:     limits.MinIntervalMs,
+		MaxIntervalMs:     limits.MaxIntervalMs,
+	}
+}
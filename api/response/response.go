@@ -1,6 +1,13 @@
 package response
 
-import "github.com/gin-gonic/gin"
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"zapmeow/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
 
 type Error struct {
 	Code  int    `json:"code"`
@@ -30,3 +37,14 @@ func ErrorResponse(c *gin.Context, statusCode int, message string) {
 	})
 	c.Abort()
 }
+
+// RateLimitResponse tells the client when the rate limit of an instance allows
+// sending again.
+func RateLimitResponse(c *gin.Context, err *ratelimit.Error) {
+	retryAfter := int(math.Ceil(err.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	ErrorResponse(c, http.StatusTooManyRequests, err.Error())
+}
@@ -0,0 +1,21 @@
+package response
+
+import "zapmeow/api/model"
+
+type RetentionPolicy struct {
+	MediaType    string `json:"media_type"`
+	MaxAgeDays   int    `json:"max_age_days"`
+	MaxSizeBytes int64  `json:"max_size_bytes"`
+}
+
+func NewRetentionPoliciesResponse(policies []model.RetentionPolicy) []RetentionPolicy {
+	data := make([]RetentionPolicy, 0, len(policies))
+	for _, policy := range policies {
+		data = append(data, RetentionPolicy{
+			MediaType:    policy.MediaType,
+			MaxAgeDays:   policy.MaxAgeDays,
+			MaxSizeBytes: policy.MaxSizeBytes,
+		})
+	}
+	return data
+}
@@ -0,0 +1,39 @@
+package response
+
+import (
+	"time"
+	"zapmeow/api/model"
+)
+
+type SendJob struct {
+	ID            uint       `json:"id"`
+	Type          string     `json:"type"`
+	Phone         string     `json:"phone"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	Error         string     `json:"error"`
+	MessageID     string     `json:"message_id"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at"`
+}
+
+func NewSendJobResponse(job model.SendJob) SendJob {
+	var nextAttemptAt *time.Time
+	if job.Status == model.SendJobPending {
+		nextAttemptAt = &job.NextAttemptAt
+	}
+
+	return SendJob{
+		ID:            job.ID,
+		Type:          job.Type,
+		Phone:         job.Phone,
+		Status:        job.Status,
+		Attempts:      job.Attempts,
+		Error:         job.Error,
+		MessageID:     job.MessageID,
+		NextAttemptAt: nextAttemptAt,
+		CreatedAt:     job.CreatedAt,
+		CompletedAt:   job.CompletedAt,
+	}
+}
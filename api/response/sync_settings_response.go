@@ -0,0 +1,21 @@
+package response
+
+import "zapmeow/api/model"
+
+type SyncSettings struct {
+	Enabled            bool `json:"enabled"`
+	MaxMessagesPerChat int  `json:"max_messages_per_chat"`
+	MaxAgeDays         int  `json:"max_age_days"`
+	IncludeGroups      bool `json:"include_groups"`
+	DownloadMedia      bool `json:"download_media"`
+}
+
+func NewSyncSettingsResponse(settings *model.SyncSettings) SyncSettings {
+	return SyncSettings{
+		Enabled:            settings.Enabled,
+		MaxMessagesPerChat: settings.MaxMessagesPerChat,
+		MaxAgeDays:         settings.MaxAgeDays,
+		IncludeGroups:      settings.IncludeGroups,
+		DownloadMedia:      settings.DownloadMedia,
+	}
+}
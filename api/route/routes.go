@@ -2,6 +2,8 @@ package route
 
 import (
 	"zapmeow/api/handler"
+	"zapmeow/api/middleware"
+	"zapmeow/api/model"
 	"zapmeow/api/service"
 	"zapmeow/config"
 	"zapmeow/pkg/zapmeow"
@@ -23,15 +25,70 @@ func SetupRouter(
 	whatsAppService service.WhatsAppService,
 	messageService service.MessageService,
 	accountService service.AccountService,
+	chatService service.ChatService,
+	exportService service.ExportService,
+	retentionPolicyService service.RetentionPolicyService,
+	mediaService service.MediaService,
+	historySyncProgressService service.HistorySyncProgressService,
+	syncSettingsService service.SyncSettingsService,
+	apiTokenService service.ApiTokenService,
+	rateLimitService service.RateLimitService,
+	sendService service.SendService,
+	sendJobService service.SendJobService,
 ) *gin.Engine {
 	router := makeEngine(app.Config)
 
+	createInstanceHandler := handler.NewCreateInstanceHandler(
+		app,
+		whatsAppService,
+		accountService,
+	)
+	getInstancesHandler := handler.NewGetInstancesHandler(
+		whatsAppService,
+		accountService,
+	)
+	getInstanceHandler := handler.NewGetInstanceHandler(
+		whatsAppService,
+		accountService,
+	)
+	deleteInstanceHandler := handler.NewDeleteInstanceHandler(
+		app,
+		whatsAppService,
+		accountService,
+	)
 	getQrCodeHandler := handler.NewGetQrCodeHandler(
 		app,
 		whatsAppService,
 		messageService,
 		accountService,
 	)
+	getQrCodePNGHandler := handler.NewGetQrCodeImageHandler(
+		app,
+		whatsAppService,
+		accountService,
+		handler.QrCodePNG,
+	)
+	getQrCodeSVGHandler := handler.NewGetQrCodeImageHandler(
+		app,
+		whatsAppService,
+		accountService,
+		handler.QrCodeSVG,
+	)
+	streamQrCodeHandler := handler.NewStreamQrCodeHandler(
+		app,
+		whatsAppService,
+		accountService,
+	)
+	pairPhoneHandler := handler.NewPairPhoneHandler(
+		whatsAppService,
+	)
+	updateProxyHandler := handler.NewUpdateProxyHandler(
+		whatsAppService,
+		accountService,
+	)
+	reconnectHandler := handler.NewReconnectHandler(
+		whatsAppService,
+	)
 	logoutHandler := handler.NewLogoutHandler(
 		app,
 		whatsAppService,
@@ -55,37 +112,184 @@ func SetupRouter(
 		whatsAppService,
 		messageService,
 	)
-	sendTextMessageHandler := handler.NewSendTextMessageHandler(
+	getChatsHandler := handler.NewGetChatsHandler(
+		whatsAppService,
+		chatService,
+	)
+	getChatHandler := handler.NewGetChatHandler(
+		whatsAppService,
+		chatService,
+	)
+	archiveChatHandler := handler.NewArchiveChatHandler(
+		whatsAppService,
+		chatService,
+	)
+	pinChatHandler := handler.NewPinChatHandler(
+		whatsAppService,
+		chatService,
+	)
+	muteChatHandler := handler.NewMuteChatHandler(
+		whatsAppService,
+		chatService,
+	)
+	markChatUnreadHandler := handler.NewMarkChatUnreadHandler(
+		whatsAppService,
+		chatService,
+	)
+	clearChatHandler := handler.NewClearChatHandler(
+		whatsAppService,
+		chatService,
+	)
+	deleteChatHandler := handler.NewDeleteChatHandler(
+		whatsAppService,
+		chatService,
+	)
+	exportChatHandler := handler.NewExportChatHandler(
+		whatsAppService,
+		chatService,
+		exportService,
+	)
+	searchMessagesHandler := handler.NewSearchMessagesHandler(
 		whatsAppService,
 		messageService,
 	)
-	sendImageMessageHandler := handler.NewSendImageMessageHandler(
+	getRetentionPoliciesHandler := handler.NewGetRetentionPoliciesHandler(
+		accountService,
+		retentionPolicyService,
+	)
+	updateRetentionPoliciesHandler := handler.NewUpdateRetentionPoliciesHandler(
+		accountService,
+		retentionPolicyService,
+	)
+	getHistorySyncProgressHandler := handler.NewGetHistorySyncProgressHandler(
+		accountService,
+		historySyncProgressService,
+	)
+	requestHistorySyncHandler := handler.NewRequestHistorySyncHandler(
+		whatsAppService,
+		chatService,
+		historySyncProgressService,
+	)
+	getSyncSettingsHandler := handler.NewGetSyncSettingsHandler(
+		accountService,
+		syncSettingsService,
+	)
+	updateSyncSettingsHandler := handler.NewUpdateSyncSettingsHandler(
+		accountService,
+		syncSettingsService,
+	)
+	getRateLimitsHandler := handler.NewGetRateLimitsHandler(
+		rateLimitService,
+	)
+	updateRateLimitsHandler := handler.NewUpdateRateLimitsHandler(
+		rateLimitService,
+	)
+	createApiTokenHandler := handler.NewCreateApiTokenHandler(
+		apiTokenService,
+	)
+	getApiTokensHandler := handler.NewGetApiTokensHandler(
+		apiTokenService,
+	)
+	rotateApiTokenHandler := handler.NewRotateApiTokenHandler(
+		apiTokenService,
+	)
+	revokeApiTokenHandler := handler.NewRevokeApiTokenHandler(
+		apiTokenService,
+	)
+	retryMediaHandler := handler.NewRetryMediaHandler(
 		whatsAppService,
 		messageService,
 	)
+	sendTextMessageHandler := handler.NewSendTextMessageHandler(
+		whatsAppService,
+		sendService,
+		sendJobService,
+	)
+	sendImageMessageHandler := handler.NewSendImageMessageHandler(
+		whatsAppService,
+		sendService,
+		sendJobService,
+	)
 	sendAudioMessageHandler := handler.NewSendAudioMessageHandler(
 		whatsAppService,
-		messageService,
+		sendService,
+		sendJobService,
 	)
 	sendDocumentMessageHandler := handler.NewSendDocumentMessageHandler(
 		whatsAppService,
-		messageService,
+		sendService,
+		sendJobService,
+	)
+	getSendJobHandler := handler.NewGetSendJobHandler(
+		sendJobService,
 	)
 
 	group := router.Group("/api")
-
-	group.GET("/:instanceId/qrcode", getQrCodeHandler.Handler)
-	group.GET("/:instanceId/status", getStatusHandler.Handler)
-	group.GET("/:instanceId/profile", getProfileInfoHandler.Handler)
-	group.GET("/:instanceId/contact/info", getContactInfoHandler.Handler)
-	group.POST("/:instanceId/logout", logoutHandler.Handler)
-	group.POST("/:instanceId/check/phones", checkPhonesHandler.Handler)
-	group.POST("/:instanceId/chat/messages", getMessagesHandler.Handler)
-	group.POST("/:instanceId/chat/send/text", sendTextMessageHandler.Handler)
-	group.POST("/:instanceId/chat/send/image", sendImageMessageHandler.Handler)
-	group.POST("/:instanceId/chat/send/audio", sendAudioMessageHandler.Handler)
-	group.POST("/:instanceId/chat/send/document", sendDocumentMessageHandler.Handler)
 	group.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
+	// instance tokens only reach the routes of their own instance, so the
+	// routes without one need the master key
+	api := group.Group("", middleware.Authenticate(app.Config.ApiKey, apiTokenService))
+
+	read := middleware.RequireScope(model.ScopeRead)
+	send := middleware.RequireScope(model.ScopeSend)
+	admin := middleware.RequireScope(model.ScopeAdmin)
+	tokens := middleware.RequireApiKey(app.Config.ApiKey)
+
+	api.POST("/instances", createInstanceHandler.Handler)
+	api.GET("/instances", getInstancesHandler.Handler)
+	api.GET("/instances/:id", read, middleware.RouteInstance(app.Cluster, "id"), getInstanceHandler.Handler)
+	api.DELETE("/instances/:id", admin, middleware.RouteInstance(app.Cluster, "id"), deleteInstanceHandler.Handler)
+
+	// instances are only created through the routes above, and their
+	// requests are served by the node that loaded them
+	instance := api.Group(
+		"",
+		middleware.RequireInstance(accountService),
+		middleware.RouteInstance(app.Cluster, "instanceId"),
+	)
+
+	instance.GET("/:instanceId/qrcode", admin, getQrCodeHandler.Handler)
+	instance.GET("/:instanceId/qrcode.png", admin, getQrCodePNGHandler.Handler)
+	instance.GET("/:instanceId/qrcode.svg", admin, getQrCodeSVGHandler.Handler)
+	instance.GET("/:instanceId/qrcode/stream", admin, streamQrCodeHandler.Handler)
+	instance.POST("/:instanceId/pair/phone", admin, pairPhoneHandler.Handler)
+	instance.GET("/:instanceId/status", read, getStatusHandler.Handler)
+	instance.GET("/:instanceId/profile", read, getProfileInfoHandler.Handler)
+	instance.GET("/:instanceId/contact/info", read, getContactInfoHandler.Handler)
+	instance.POST("/:instanceId/reconnect", admin, reconnectHandler.Handler)
+	instance.PUT("/:instanceId/proxy", admin, updateProxyHandler.Handler)
+	instance.POST("/:instanceId/logout", admin, logoutHandler.Handler)
+	instance.POST("/:instanceId/check/phones", read, checkPhonesHandler.Handler)
+	instance.POST("/:instanceId/chat/messages", read, getMessagesHandler.Handler)
+	instance.GET("/:instanceId/chats", read, getChatsHandler.Handler)
+	instance.GET("/:instanceId/chats/:jid", read, getChatHandler.Handler)
+	instance.DELETE("/:instanceId/chats/:jid", send, deleteChatHandler.Handler)
+	instance.POST("/:instanceId/chats/:jid/archive", send, archiveChatHandler.Handler)
+	instance.POST("/:instanceId/chats/:jid/pin", send, pinChatHandler.Handler)
+	instance.POST("/:instanceId/chats/:jid/mute", send, muteChatHandler.Handler)
+	instance.POST("/:instanceId/chats/:jid/unread", send, markChatUnreadHandler.Handler)
+	instance.POST("/:instanceId/chats/:jid/clear", send, clearChatHandler.Handler)
+	instance.GET("/:instanceId/chats/:jid/export", read, exportChatHandler.Handler)
+	instance.GET("/:instanceId/messages/search", read, searchMessagesHandler.Handler)
+	instance.POST("/:instanceId/media/:messageId/retry", send, retryMediaHandler.Handler)
+	instance.GET("/:instanceId/retention", read, getRetentionPoliciesHandler.Handler)
+	instance.PUT("/:instanceId/retention", admin, updateRetentionPoliciesHandler.Handler)
+	instance.GET("/:instanceId/sync", read, getHistorySyncProgressHandler.Handler)
+	instance.POST("/:instanceId/sync", send, requestHistorySyncHandler.Handler)
+	instance.GET("/:instanceId/sync/settings", read, getSyncSettingsHandler.Handler)
+	instance.PUT("/:instanceId/sync/settings", admin, updateSyncSettingsHandler.Handler)
+	instance.GET("/:instanceId/rate-limits", read, getRateLimitsHandler.Handler)
+	instance.PUT("/:instanceId/rate-limits", admin, updateRateLimitsHandler.Handler)
+	instance.GET("/:instanceId/tokens", admin, tokens, getApiTokensHandler.Handler)
+	instance.POST("/:instanceId/tokens", admin, tokens, createApiTokenHandler.Handler)
+	instance.POST("/:instanceId/tokens/:tokenId/rotate", admin, tokens, rotateApiTokenHandler.Handler)
+	instance.DELETE("/:instanceId/tokens/:tokenId", admin, tokens, revokeApiTokenHandler.Handler)
+	instance.POST("/:instanceId/chat/send/text", send, sendTextMessageHandler.Handler)
+	instance.POST("/:instanceId/chat/send/image", send, sendImageMessageHandler.Handler)
+	instance.POST("/:instanceId/chat/send/audio", send, sendAudioMessageHandler.Handler)
+	instance.POST("/:instanceId/chat/send/document", send, sendDocumentMessageHandler.Handler)
+	instance.GET("/:instanceId/jobs/:jobId", send, getSendJobHandler.Handler)
+
 	return router
 }
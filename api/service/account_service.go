@@ -6,6 +6,7 @@ import (
 	"zapmeow/api/helper"
 	"zapmeow/api/model"
 	"zapmeow/api/repository"
+	"zapmeow/pkg/logger"
 )
 
 type AccountService interface {
@@ -14,17 +15,40 @@ type AccountService interface {
 	GetAccountByInstanceID(instanceID string) (*model.Account, error)
 	UpdateAccount(instanceID string, data map[string]interface{}) error
 	DeleteAccountMessages(instanceID string) error
+	GetAccounts(tenant string) ([]model.Account, error)
+	DeleteAccount(instanceID string) error
+	GetWebhookURL(instanceID string) string
 }
 
 type accountService struct {
 	accountRepo    repository.AccountRepository
 	messageService MessageService
+	chatService    ChatService
+	mediaService   MediaService
+	contactService ContactService
+
+	historySyncProgressService HistorySyncProgressService
+	// webhookURL is the default for instances without their own webhook
+	webhookURL string
 }
 
-func NewAccountService(accountRepo repository.AccountRepository, messageService MessageService) *accountService {
+func NewAccountService(
+	accountRepo repository.AccountRepository,
+	messageService MessageService,
+	chatService ChatService,
+	mediaService MediaService,
+	contactService ContactService,
+	historySyncProgressService HistorySyncProgressService,
+	webhookURL string,
+) *accountService {
 	return &accountService{
-		accountRepo:    accountRepo,
-		messageService: messageService,
+		accountRepo:                accountRepo,
+		messageService:             messageService,
+		chatService:                chatService,
+		mediaService:               mediaService,
+		contactService:             contactService,
+		historySyncProgressService: historySyncProgressService,
+		webhookURL:                 webhookURL,
 	}
 }
 
@@ -44,11 +68,55 @@ func (a *accountService) UpdateAccount(instanceID string, data map[string]interf
 	return a.accountRepo.UpdateAccount(instanceID, data)
 }
 
+func (a *accountService) GetAccounts(tenant string) ([]model.Account, error) {
+	return a.accountRepo.GetAccounts(tenant)
+}
+
+// DeleteAccount deletes the account and all the data of its instance, then
+// its files.
+func (a *accountService) DeleteAccount(instanceID string) error {
+	if err := a.accountRepo.DeleteAccount(instanceID); err != nil {
+		return err
+	}
+	return a.deleteAccountDirectory(instanceID)
+}
+
+// GetWebhookURL returns the webhook of the instance, or the default one when
+// it has none.
+func (a *accountService) GetWebhookURL(instanceID string) string {
+	account, err := a.accountRepo.GetAccountByInstanceID(instanceID)
+	if err != nil {
+		logger.Error("Failed to get account. ", err)
+	}
+	if account != nil && account.WebhookURL != "" {
+		return account.WebhookURL
+	}
+	return a.webhookURL
+}
+
+// DeleteAccountMessages deletes the data synced from the phone, including
+// the history sync progress, so the history is imported again from scratch
+// after the next pairing.
 func (a *accountService) DeleteAccountMessages(instanceID string) error {
 	err := a.messageService.DeleteMessagesByInstanceID(instanceID)
 	if err != nil {
 		return err
 	}
+
+	err = a.chatService.DeleteChatsByInstanceID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	err = a.contactService.DeleteContactsByInstanceID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	err = a.historySyncProgressService.DeleteProgressByInstanceID(instanceID)
+	if err != nil {
+		return err
+	}
 	return a.deleteAccountDirectory(instanceID)
 }
 
@@ -63,13 +131,16 @@ func (a *accountService) deleteAccountDirectory(instanceID string) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			err = os.Remove(path)
-			if err != nil {
-				return err
-			}
+		if info.IsDir() {
+			return nil
 		}
-		return nil
+
+		// blobs may still be referenced if releasing them failed
+		referenced, err := a.mediaService.IsBlobReferenced(instanceID, path)
+		if err != nil || referenced {
+			return err
+		}
+		return os.Remove(path)
 	})
 	return err
 }
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+	"zapmeow/pkg/logger"
+	"zapmeow/pkg/whatsapp"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+type ChatService interface {
+	RecordMessage(message *model.Message, isGroup bool) error
+	RecordHistoryMessage(message *model.Message, isGroup bool) error
+	RecordHistoryMetadata(chat *model.Chat, settings *model.ChatSettings) error
+	CreateChatsFromMessages() error
+	GetChat(instanceID string, chatJID string) (*model.Chat, error)
+	GetChats(instanceID string, limit int, offset int) ([]model.Chat, error)
+	CountChats(instanceID string) (int64, error)
+	ResolveChatJID(instanceID string, chat string) (whatsapp.JID, bool)
+	UpdateChat(instanceID string, chatJID string, data map[string]interface{}) error
+	MarkChatAsRead(instanceID string, chatJID string) error
+	ClearChat(instanceID string, chatJID string) error
+	DeleteChat(instanceID string, chatJID string) error
+	DeleteChatsByInstanceID(instanceID string) error
+	UpdateChatSettings(settings *model.ChatSettings, columns ...string) error
+	GetChatSettings(instanceID string, chatJIDs []string) (map[string]model.ChatSettings, error)
+}
+
+type chatService struct {
+	chatRepo repository.ChatRepository
+}
+
+func NewChatService(chatRepo repository.ChatRepository) *chatService {
+	return &chatService{
+		chatRepo: chatRepo,
+	}
+}
+
+// RecordMessage updates the chat of a live message, counting it as unread
+// when it was not sent by us.
+func (c *chatService) RecordMessage(message *model.Message, isGroup bool) error {
+	unread := 0
+	if !message.FromMe {
+		unread = 1
+	}
+	return c.chatRepo.UpsertChat(c.makeChat(message, isGroup), unread)
+}
+
+// RecordHistoryMessage updates the chat of a message imported by history
+// sync, which never counts as unread.
+func (c *chatService) RecordHistoryMessage(message *model.Message, isGroup bool) error {
+	return c.chatRepo.UpsertChat(c.makeChat(message, isGroup), 0)
+}
+
+// RecordHistoryMetadata stores the state of a chat sent by history sync,
+// for chats whose messages weren't imported too.
+func (c *chatService) RecordHistoryMetadata(chat *model.Chat, settings *model.ChatSettings) error {
+	if err := c.chatRepo.UpsertChatMetadata(chat); err != nil {
+		return err
+	}
+	return c.chatRepo.UpdateChatSettings(settings, "archived", "pinned", "muted", "muted_until", "marked_unread")
+}
+
+func (c *chatService) CreateChatsFromMessages() error {
+	return c.chatRepo.CreateChatsFromMessages()
+}
+
+func (c *chatService) GetChat(instanceID string, chatJID string) (*model.Chat, error) {
+	return c.chatRepo.GetChat(instanceID, chatJID)
+}
+
+func (c *chatService) GetChats(instanceID string, limit int, offset int) ([]model.Chat, error) {
+	return c.chatRepo.GetChats(instanceID, limit, offset)
+}
+
+func (c *chatService) CountChats(instanceID string) (int64, error) {
+	return c.chatRepo.CountChats(instanceID)
+}
+
+// ResolveChatJID parses a phone or JID from the API. Stored chats only keep
+// the user part of their JID, so a bare group ID is matched against them.
+func (c *chatService) ResolveChatJID(instanceID string, chat string) (whatsapp.JID, bool) {
+	jid, ok := helper.MakeJID(chat)
+	if !ok || jid.Server != types.DefaultUserServer {
+		return jid, ok
+	}
+
+	stored, err := c.chatRepo.GetChat(instanceID, jid.User)
+	if err != nil {
+		logger.Error("Failed to get chat. ", err)
+	}
+	if stored != nil && stored.IsGroup {
+		jid.Server = types.GroupServer
+	}
+	return jid, true
+}
+
+func (c *chatService) UpdateChat(instanceID string, chatJID string, data map[string]interface{}) error {
+	return c.chatRepo.UpdateChat(instanceID, chatJID, data)
+}
+
+func (c *chatService) MarkChatAsRead(instanceID string, chatJID string) error {
+	return c.chatRepo.UpdateChat(instanceID, chatJID, map[string]interface{}{
+		"UnreadCount": 0,
+	})
+}
+
+// ClearChat keeps the chat in the list but forgets its last message.
+func (c *chatService) ClearChat(instanceID string, chatJID string) error {
+	return c.chatRepo.UpdateChat(instanceID, chatJID, map[string]interface{}{
+		"LastMessageID":     "",
+		"LastMessageBody":   "",
+		"LastMessageFromMe": false,
+		"UnreadCount":       0,
+	})
+}
+
+func (c *chatService) DeleteChat(instanceID string, chatJID string) error {
+	return c.chatRepo.DeleteChat(instanceID, chatJID)
+}
+
+func (c *chatService) DeleteChatsByInstanceID(instanceID string) error {
+	return c.chatRepo.DeleteChatsByInstanceID(instanceID)
+}
+
+func (c *chatService) UpdateChatSettings(settings *model.ChatSettings, columns ...string) error {
+	return c.chatRepo.UpdateChatSettings(settings, columns...)
+}
+
+func (c *chatService) GetChatSettings(instanceID string, chatJIDs []string) (map[string]model.ChatSettings, error) {
+	settings, err := c.chatRepo.GetChatSettings(instanceID, chatJIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]model.ChatSettings, len(settings))
+	for _, s := range settings {
+		data[s.ChatJID] = s
+	}
+	return data, nil
+}
+
+func (c *chatService) makeChat(message *model.Message, isGroup bool) *model.Chat {
+	return &model.Chat{
+		InstanceID:        message.InstanceID,
+		ChatJID:           message.ChatJID,
+		IsGroup:           isGroup,
+		LastMessageID:     message.MessageID,
+		LastMessageBody:   c.makePreview(message),
+		LastMessageFromMe: message.FromMe,
+		LastMessageAt:     message.Timestamp,
+	}
+}
+
+func (c *chatService) makePreview(message *model.Message) string {
+	preview := message.Body
+	if preview == "" {
+		preview = message.Caption
+	}
+	if preview == "" {
+		preview = message.Filename
+	}
+	if preview == "" {
+		preview = message.MediaType
+	}
+
+	runes := []rune(preview)
+	if len(runes) > model.ChatPreviewLength {
+		return string(runes[:model.ChatPreviewLength])
+	}
+	return preview
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+)
+
+type ContactService interface {
+	RecordNames(instanceID string, names map[string]string) error
+	RecordPushNames(instanceID string, pushNames map[string]string) error
+	GetContact(instanceID string, jid string) (*model.Contact, error)
+	DeleteContactsByInstanceID(instanceID string) error
+}
+
+type contactService struct {
+	contactRepo repository.ContactRepository
+}
+
+func NewContactService(contactRepo repository.ContactRepository) *contactService {
+	return &contactService{
+		contactRepo: contactRepo,
+	}
+}
+
+// RecordNames stores the names the account saved its contacts with, keyed
+// by the user part of their JID.
+func (c *contactService) RecordNames(instanceID string, names map[string]string) error {
+	contacts := make([]model.Contact, 0, len(names))
+	for jid, name := range names {
+		contacts = append(contacts, model.Contact{
+			InstanceID: instanceID,
+			JID:        jid,
+			Name:       name,
+		})
+	}
+	return c.contactRepo.UpsertContacts(contacts, "name")
+}
+
+// RecordPushNames stores the names users chose for themselves, keyed by the
+// user part of their JID.
+func (c *contactService) RecordPushNames(instanceID string, pushNames map[string]string) error {
+	contacts := make([]model.Contact, 0, len(pushNames))
+	for jid, pushName := range pushNames {
+		contacts = append(contacts, model.Contact{
+			InstanceID: instanceID,
+			JID:        jid,
+			PushName:   pushName,
+		})
+	}
+	return c.contactRepo.UpsertContacts(contacts, "push_name")
+}
+
+func (c *contactService) GetContact(instanceID string, jid string) (*model.Contact, error) {
+	return c.contactRepo.GetContact(instanceID, jid)
+}
+
+func (c *contactService) DeleteContactsByInstanceID(instanceID string) error {
+	return c.contactRepo.DeleteContactsByInstanceID(instanceID)
+}
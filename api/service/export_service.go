@@ -0,0 +1,351 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/pkg/logger"
+)
+
+const (
+	exportBatchSize = 500
+	// exportErrorsFile lists the media missing from an export and the error
+	// that cut it short, if any
+	exportErrorsFile = "errors.txt"
+)
+
+type ExportFormat string
+
+const (
+	ExportJSON ExportFormat = "json"
+	ExportCSV  ExportFormat = "csv"
+	ExportTXT  ExportFormat = "txt"
+)
+
+func (f ExportFormat) IsValid() bool {
+	switch f {
+	case ExportJSON, ExportCSV, ExportTXT:
+		return true
+	}
+	return false
+}
+
+type ExportService interface {
+	ExportChat(writer io.Writer, instanceID string, chatJID string, format ExportFormat) error
+}
+
+type exportService struct {
+	messageService MessageService
+}
+
+type exportedMessage struct {
+	MessageID string    `json:"message_id"`
+	Sender    string    `json:"sender"`
+	FromMe    bool      `json:"from_me"`
+	Timestamp time.Time `json:"timestamp"`
+	Body      string    `json:"body"`
+	Caption   string    `json:"caption"`
+	Filename  string    `json:"filename"`
+	MediaType string    `json:"media_type"`
+	MediaFile string    `json:"media_file"`
+	// MediaExpired is set when retention removed the media, and
+	// MediaUnavailable when it was never downloaded or its file is gone
+	MediaExpired     bool `json:"media_expired"`
+	MediaUnavailable bool `json:"media_unavailable"`
+}
+
+// transcriptWriter writes one transcript format. Messages are passed in
+// chronological order, in batches, between a single begin and end call.
+type transcriptWriter interface {
+	begin() error
+	write(message exportedMessage) error
+	end() error
+}
+
+func NewExportService(messageService MessageService) *exportService {
+	return &exportService{
+		messageService: messageService,
+	}
+}
+
+// ExportChat streams a zip archive with the chat transcript followed by the
+// media files it references. Messages are read in batches, so memory use
+// doesn't grow with the size of the chat. The archive ends with an
+// errors.txt entry when media went missing or the export failed midway, so
+// an incomplete archive can be told apart. An error is only returned when
+// the archive couldn't be completed.
+func (e *exportService) ExportChat(writer io.Writer, instanceID string, chatJID string, format ExportFormat) error {
+	if !format.IsValid() {
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+
+	archive := zip.NewWriter(writer)
+
+	problems, err := e.writeArchive(archive, instanceID, chatJID, format)
+	if err != nil {
+		logger.Error("Failed to export chat. ", err)
+		problems = append(problems, fmt.Sprintf("export incomplete: %s", err))
+	}
+
+	if len(problems) > 0 {
+		if err := e.writeErrors(archive, problems); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeArchive writes the transcript and the media, returning the media
+// files that went missing since the transcript was written.
+func (e *exportService) writeArchive(archive *zip.Writer, instanceID string, chatJID string, format ExportFormat) ([]string, error) {
+	file, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     "chat." + string(format),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := e.makeTranscriptWriter(file, format)
+	if err := transcript.begin(); err != nil {
+		return nil, err
+	}
+	err = e.eachMessage(instanceID, chatJID, func(message model.Message) error {
+		return transcript.write(e.makeExportedMessage(message))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := transcript.end(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	written := make(map[string]bool)
+	err = e.eachMessage(instanceID, chatJID, func(message model.Message) error {
+		name := e.makeMediaFile(message)
+		if name == "" || written[name] {
+			return nil
+		}
+		written[name] = true
+
+		err := e.writeMedia(archive, name, message)
+		if errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, fmt.Sprintf("%s: file is missing", name))
+			return nil
+		}
+		return err
+	})
+	return missing, err
+}
+
+func (e *exportService) writeErrors(archive *zip.Writer, problems []string) error {
+	file, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     exportErrorsFile,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(file, strings.Join(problems, "\n")+"\n")
+	return err
+}
+
+func (e *exportService) eachMessage(instanceID string, chatJID string, fn func(message model.Message) error) error {
+	var last *model.Message
+	for {
+		messages, err := e.messageService.GetChatMessagesAfter(instanceID, chatJID, last, exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			if err := fn(message); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < exportBatchSize {
+			return nil
+		}
+		last = &messages[len(messages)-1]
+	}
+}
+
+func (e *exportService) writeMedia(archive *zip.Writer, name string, message model.Message) error {
+	media, err := helper.ReadMedia(message.InstanceID, message.MediaPath)
+	if err != nil {
+		return err
+	}
+
+	// media is already compressed, so it's stored as is
+	file, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: message.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(media)
+	return err
+}
+
+// makeMediaFile returns the archive path of the media of the message, or an
+// empty string when its file isn't stored.
+func (e *exportService) makeMediaFile(message model.Message) string {
+	if message.MediaType == "" || message.MediaPath == "" || message.MediaExpired {
+		return ""
+	}
+	if _, err := os.Stat(message.MediaPath); err != nil {
+		return ""
+	}
+	return "media/" + filepath.Base(message.MediaPath)
+}
+
+func (e *exportService) makeExportedMessage(message model.Message) exportedMessage {
+	mediaFile := e.makeMediaFile(message)
+	hasMedia := message.MediaType != ""
+	return exportedMessage{
+		MessageID: message.MessageID,
+		Sender:    message.SenderJID,
+		FromMe:    message.FromMe,
+		Timestamp: message.Timestamp,
+		Body:      message.Body,
+		Caption:   message.Caption,
+		Filename:  message.Filename,
+		MediaType: message.MediaType,
+		MediaFile: mediaFile,
+
+		MediaExpired:     hasMedia && message.MediaExpired,
+		MediaUnavailable: hasMedia && !message.MediaExpired && mediaFile == "",
+	}
+}
+
+func (e *exportService) makeTranscriptWriter(writer io.Writer, format ExportFormat) transcriptWriter {
+	switch format {
+	case ExportCSV:
+		return &csvTranscriptWriter{writer: csv.NewWriter(writer)}
+	case ExportTXT:
+		return &txtTranscriptWriter{writer: writer}
+	default:
+		return &jsonTranscriptWriter{writer: writer}
+	}
+}
+
+type jsonTranscriptWriter struct {
+	writer io.Writer
+	count  int
+}
+
+func (t *jsonTranscriptWriter) begin() error {
+	_, err := io.WriteString(t.writer, "[\n")
+	return err
+}
+
+func (t *jsonTranscriptWriter) write(message exportedMessage) error {
+	if t.count > 0 {
+		if _, err := io.WriteString(t.writer, ",\n"); err != nil {
+			return err
+		}
+	}
+	t.count++
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = t.writer.Write(data)
+	return err
+}
+
+func (t *jsonTranscriptWriter) end() error {
+	_, err := io.WriteString(t.writer, "\n]\n")
+	return err
+}
+
+type csvTranscriptWriter struct {
+	writer *csv.Writer
+}
+
+func (t *csvTranscriptWriter) begin() error {
+	return t.writer.Write([]string{
+		"timestamp", "message_id", "sender", "from_me", "body", "caption", "filename", "media_type", "media_file",
+		"media_expired", "media_unavailable",
+	})
+}
+
+func (t *csvTranscriptWriter) write(message exportedMessage) error {
+	return t.writer.Write([]string{
+		message.Timestamp.Format(time.RFC3339),
+		message.MessageID,
+		message.Sender,
+		strconv.FormatBool(message.FromMe),
+		message.Body,
+		message.Caption,
+		message.Filename,
+		message.MediaType,
+		message.MediaFile,
+		strconv.FormatBool(message.MediaExpired),
+		strconv.FormatBool(message.MediaUnavailable),
+	})
+}
+
+func (t *csvTranscriptWriter) end() error {
+	t.writer.Flush()
+	return t.writer.Error()
+}
+
+// txtTranscriptWriter mimics the "Export chat" text file of WhatsApp for
+// Android, e.g. "19/10/2023, 14:05 - 5511999999999: Hello".
+type txtTranscriptWriter struct {
+	writer io.Writer
+}
+
+func (t *txtTranscriptWriter) begin() error {
+	return nil
+}
+
+func (t *txtTranscriptWriter) write(message exportedMessage) error {
+	text := message.Body
+	if message.MediaType != "" {
+		attachment := filepath.Base(message.MediaFile) + " (file attached)"
+		if message.MediaExpired {
+			attachment = "<Media expired>"
+		} else if message.MediaFile == "" {
+			attachment = "<Media omitted>"
+		}
+
+		text = attachment
+		if message.Caption != "" {
+			text += "\n" + message.Caption
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		t.writer,
+		"%s - %s: %s\n",
+		message.Timestamp.Format("02/01/2006, 15:04"),
+		message.Sender,
+		text,
+	)
+	return err
+}
+
+func (t *txtTranscriptWriter) end() error {
+	return nil
+}
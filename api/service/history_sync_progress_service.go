@@ -0,0 +1,102 @@
+package service
+
+import (
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+)
+
+// HistorySyncOnDemand is the sync type of the history WhatsApp sends back
+// for a resync request. It has no progress, so each chunk completes it.
+const HistorySyncOnDemand = "on_demand"
+
+type HistorySyncProgressService interface {
+	GetProgressByInstanceID(instanceID string) ([]model.HistorySyncProgress, error)
+	RecordChunk(instanceID string, syncType string, chunkOrder uint32, progress uint32, conversations int, messages int) (*model.HistorySyncProgress, bool, error)
+	RecordRequest(instanceID string, syncType string) error
+	DeleteProgressByInstanceID(instanceID string) error
+}
+
+type historySyncProgressService struct {
+	historySyncProgressRepo repository.HistorySyncProgressRepository
+}
+
+func NewHistorySyncProgressService(historySyncProgressRepo repository.HistorySyncProgressRepository) *historySyncProgressService {
+	return &historySyncProgressService{
+		historySyncProgressRepo: historySyncProgressRepo,
+	}
+}
+
+func (h *historySyncProgressService) GetProgressByInstanceID(instanceID string) ([]model.HistorySyncProgress, error) {
+	return h.historySyncProgressRepo.GetProgressByInstanceID(instanceID)
+}
+
+// RecordChunk adds an imported chunk to the progress of its sync type and
+// tells whether the sync was completed by it.
+func (h *historySyncProgressService) RecordChunk(
+	instanceID string,
+	syncType string,
+	chunkOrder uint32,
+	progress uint32,
+	conversations int,
+	messages int,
+) (*model.HistorySyncProgress, bool, error) {
+	syncProgress, err := h.historySyncProgressRepo.GetProgress(instanceID, syncType)
+	if err != nil {
+		return nil, false, err
+	}
+	if syncProgress == nil {
+		syncProgress = &model.HistorySyncProgress{
+			InstanceID: instanceID,
+			SyncType:   syncType,
+		}
+	}
+
+	now := time.Now()
+	syncProgress.Chunks++
+	syncProgress.LastChunkOrder = chunkOrder
+	syncProgress.ConversationsImported += conversations
+	syncProgress.MessagesImported += messages
+	syncProgress.LastChunkAt = &now
+	// chunks may be delivered again, so progress never goes back
+	if progress > syncProgress.Progress {
+		syncProgress.Progress = progress
+	}
+
+	completed := false
+	if !syncProgress.Completed && (syncType == HistorySyncOnDemand || syncProgress.Progress >= 100) {
+		syncProgress.Completed = true
+		syncProgress.CompletedAt = &now
+		completed = true
+	}
+
+	if err := h.historySyncProgressRepo.SaveProgress(syncProgress); err != nil {
+		return nil, false, err
+	}
+	return syncProgress, completed, nil
+}
+
+// RecordRequest starts the progress of a requested sync over, so its
+// completion is reported again.
+func (h *historySyncProgressService) RecordRequest(instanceID string, syncType string) error {
+	syncProgress, err := h.historySyncProgressRepo.GetProgress(instanceID, syncType)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if syncProgress == nil {
+		syncProgress = &model.HistorySyncProgress{}
+	}
+	*syncProgress = model.HistorySyncProgress{
+		Model:       syncProgress.Model,
+		InstanceID:  instanceID,
+		SyncType:    syncType,
+		RequestedAt: &now,
+	}
+	return h.historySyncProgressRepo.SaveProgress(syncProgress)
+}
+
+func (h *historySyncProgressService) DeleteProgressByInstanceID(instanceID string) error {
+	return h.historySyncProgressRepo.DeleteProgressByInstanceID(instanceID)
+}
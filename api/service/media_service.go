@@ -0,0 +1,163 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+)
+
+type MediaService interface {
+	SaveMedia(instanceID string, data []byte, mimetype string) (*model.MediaBlob, error)
+	ReleaseMedia(messages []model.Message) error
+	ReleaseStoredMedia(release func() ([]string, error)) error
+	IsBlobReferenced(instanceID string, path string) (bool, error)
+}
+
+type mediaService struct {
+	mediaBlobRepo repository.MediaBlobRepository
+	// mutex keeps a blob from being removed while it gains a reference
+	mutex sync.Mutex
+}
+
+func NewMediaService(mediaBlobRepo repository.MediaBlobRepository) *mediaService {
+	return &mediaService{
+		mediaBlobRepo: mediaBlobRepo,
+	}
+}
+
+// SaveMedia stores the media content-addressed by its SHA-256, so identical
+// files of an instance (e.g. a document sent to thousands of chats) are kept
+// once. Every call adds a reference that ReleaseMedia must drop.
+func (m *mediaService) SaveMedia(instanceID string, data []byte, mimetype string) (*model.MediaBlob, error) {
+	exts, err := mime.ExtensionsByType(mimetype)
+	if err != nil {
+		return nil, err
+	}
+	if len(exts) == 0 {
+		return nil, fmt.Errorf("no extension found for MIME type: %s", mimetype)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	blob := &model.MediaBlob{
+		InstanceID: instanceID,
+		SHA256:     hash,
+		Path:       filepath.Join(m.makeBlobsPath(instanceID), hash[:2], hash+exts[0]),
+		Size:       int64(len(data)),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.mediaBlobRepo.AcquireBlob(blob); err != nil {
+		return nil, err
+	}
+
+	// the path of an existing blob is kept, even if its extension differs
+	if _, err := os.Stat(blob.Path); err == nil {
+		return blob, nil
+	}
+
+	encrypted, err := helper.GetKeyring().Encrypt(instanceID, data)
+	if err != nil {
+		if _, releaseErr := m.mediaBlobRepo.ReleaseBlobs(instanceID, map[string]int{hash: 1}); releaseErr != nil {
+			return nil, releaseErr
+		}
+		return nil, err
+	}
+
+	if err := m.writeBlob(blob.Path, encrypted); err != nil {
+		if _, releaseErr := m.mediaBlobRepo.ReleaseBlobs(instanceID, map[string]int{hash: 1}); releaseErr != nil {
+			return nil, releaseErr
+		}
+		return nil, err
+	}
+	return blob, nil
+}
+
+// ReleaseMedia drops the media references of the messages and removes the
+// blobs no other message uses. Files saved before deduplication have no hash
+// and are removed directly.
+func (m *mediaService) ReleaseMedia(messages []model.Message) error {
+	stored := make([]model.Message, 0, len(messages))
+	for _, message := range messages {
+		if message.MediaPath != "" && !message.MediaExpired {
+			stored = append(stored, message)
+		}
+	}
+
+	return m.ReleaseStoredMedia(func() ([]string, error) {
+		return m.mediaBlobRepo.ReleaseMessagesMedia(stored)
+	})
+}
+
+// ReleaseStoredMedia runs release, which drops media references in the
+// database and returns the files left without references, and removes those
+// files. No blob gains a reference in the meantime.
+func (m *mediaService) ReleaseStoredMedia(release func() ([]string, error)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	paths, err := release()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsBlobReferenced tells whether the file at path is a blob still used by a
+// message. Paths outside the blob store are never referenced.
+func (m *mediaService) IsBlobReferenced(instanceID string, path string) (bool, error) {
+	if filepath.Dir(filepath.Dir(path)) != m.makeBlobsPath(instanceID) {
+		return false, nil
+	}
+
+	name := filepath.Base(path)
+	hash := strings.TrimSuffix(name, filepath.Ext(name))
+	blob, err := m.mediaBlobRepo.GetBlob(instanceID, hash)
+	if err != nil {
+		return false, err
+	}
+	return blob != nil && blob.RefCount > 0, nil
+}
+
+// writeBlob writes through a temporary file, so a blob path never holds a
+// partially written file.
+func (m *mediaService) writeBlob(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0751); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (m *mediaService) makeBlobsPath(instanceID string) string {
+	return filepath.Join(helper.MakeAccountStoragePath(instanceID), "blobs")
+}
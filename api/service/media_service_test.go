@@ -0,0 +1,205 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+	"zapmeow/api/service"
+	"zapmeow/pkg/database"
+)
+
+type savedMedia struct {
+	instanceID string
+	data       string
+	// expired marks the media as removed by retention before it's released
+	expired bool
+}
+
+// setupMediaService returns a media service backed by a new SQLite database,
+// storing its blobs in a temporary directory.
+func setupMediaService(t *testing.T) (service.MediaService, repository.MediaBlobRepository) {
+	t.Helper()
+	t.Setenv("STORAGE_PATH", t.TempDir())
+	t.Setenv("HISTORY_SYNC", "false")
+	t.Setenv("ENCRYPTION_KEY", "")
+	t.Setenv("QUEUE_DRIVER", "memory")
+
+	db := database.NewDatabase(filepath.Join(t.TempDir(), "zapmeow.db"))
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if err := db.RunMigrate(&model.MediaBlob{}, &model.Message{}); err != nil {
+		t.Fatalf("RunMigrate: %v", err)
+	}
+
+	mediaBlobRepo := repository.NewMediaBlobRepository(db)
+	return service.NewMediaService(mediaBlobRepo), mediaBlobRepo
+}
+
+func TestMediaServiceAcquireRelease(t *testing.T) {
+	tests := []struct {
+		name  string
+		saves []savedMedia
+		// releases are the indexes of the saved media released by each
+		// ReleaseMedia call
+		releases [][]int
+		// wantRefs is the reference count left on the blob of each saved
+		// media, whose file exists while it's referenced
+		wantRefs []int
+	}{
+		{
+			name: "distinct media",
+			saves: []savedMedia{
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "b"},
+			},
+			releases: [][]int{{0}},
+			wantRefs: []int{0, 1},
+		},
+		{
+			name: "identical media shares a blob",
+			saves: []savedMedia{
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "a"},
+			},
+			releases: [][]int{{0}},
+			wantRefs: []int{2, 2, 2},
+		},
+		{
+			name: "releasing every reference removes the blob",
+			saves: []savedMedia{
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "a"},
+			},
+			releases: [][]int{{0}, {1}},
+			wantRefs: []int{0, 0},
+		},
+		{
+			name: "references released together",
+			saves: []savedMedia{
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "a"},
+				{instanceID: "1", data: "b"},
+			},
+			releases: [][]int{{0, 1, 3}},
+			wantRefs: []int{1, 1, 1, 0},
+		},
+		{
+			name: "instances don't share blobs",
+			saves: []savedMedia{
+				{instanceID: "1", data: "a"},
+				{instanceID: "2", data: "a"},
+			},
+			releases: [][]int{{0}},
+			wantRefs: []int{0, 1},
+		},
+		{
+			name: "expired media isn't released again",
+			saves: []savedMedia{
+				{instanceID: "1", data: "a", expired: true},
+				{instanceID: "1", data: "a"},
+			},
+			releases: [][]int{{0}},
+			wantRefs: []int{2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaService, mediaBlobRepo := setupMediaService(t)
+
+			messages := make([]model.Message, len(tt.saves))
+			for i, saved := range tt.saves {
+				blob, err := mediaService.SaveMedia(saved.instanceID, []byte(saved.data), "image/png")
+				if err != nil {
+					t.Fatalf("SaveMedia: %v", err)
+				}
+				messages[i] = model.Message{
+					InstanceID:   saved.instanceID,
+					MediaPath:    blob.Path,
+					MediaSHA256:  blob.SHA256,
+					MediaExpired: saved.expired,
+				}
+			}
+
+			for _, release := range tt.releases {
+				released := make([]model.Message, 0, len(release))
+				for _, i := range release {
+					released = append(released, messages[i])
+				}
+				if err := mediaService.ReleaseMedia(released); err != nil {
+					t.Fatalf("ReleaseMedia: %v", err)
+				}
+			}
+
+			for i, message := range messages {
+				refs := 0
+				blob, err := mediaBlobRepo.GetBlob(message.InstanceID, message.MediaSHA256)
+				if err != nil {
+					t.Fatalf("GetBlob: %v", err)
+				}
+				if blob != nil {
+					refs = blob.RefCount
+				}
+				if refs != tt.wantRefs[i] {
+					t.Errorf("media %d: got %d references, want %d", i, refs, tt.wantRefs[i])
+				}
+
+				_, err = os.Stat(message.MediaPath)
+				if exists := err == nil; exists != (tt.wantRefs[i] > 0) {
+					t.Errorf("media %d: got file exists %v, want %v", i, exists, tt.wantRefs[i] > 0)
+				}
+			}
+		})
+	}
+}
+
+func TestMediaServiceSaveMedia(t *testing.T) {
+	mediaService, _ := setupMediaService(t)
+
+	first, err := mediaService.SaveMedia("1", []byte("a"), "image/png")
+	if err != nil {
+		t.Fatalf("SaveMedia: %v", err)
+	}
+	second, err := mediaService.SaveMedia("1", []byte("a"), "image/png")
+	if err != nil {
+		t.Fatalf("SaveMedia: %v", err)
+	}
+
+	if first.Path != second.Path {
+		t.Errorf("got paths %q and %q, want the same blob", first.Path, second.Path)
+	}
+	data, err := os.ReadFile(first.Path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != "a" {
+		t.Errorf("got blob contents %q, want %q", data, "a")
+	}
+
+	if _, err := mediaService.SaveMedia("1", []byte("a"), "unknown/type"); err == nil {
+		t.Error("expected an error for an unknown MIME type")
+	}
+}
+
+func TestMediaServiceReleaseLegacyMedia(t *testing.T) {
+	mediaService, _ := setupMediaService(t)
+
+	// files saved before deduplication have no blob
+	path := filepath.Join(t.TempDir(), "legacy.png")
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	err := mediaService.ReleaseMedia([]model.Message{{InstanceID: "1", MediaPath: path}})
+	if err != nil {
+		t.Fatalf("ReleaseMedia: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the legacy file removed", err)
+	}
+}
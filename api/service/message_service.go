@@ -1,25 +1,46 @@
 package service
 
 import (
+	"errors"
+	"time"
+	"zapmeow/api/helper"
 	"zapmeow/api/model"
 	"zapmeow/api/repository"
 )
 
+// storedMessageIDsBatchSize keeps lookups below the SQLite host parameter limit.
+const storedMessageIDsBatchSize = 500
+
+// ErrSearchUnavailable is returned by message search while encryption at
+// rest is enabled, as there's no plaintext to search.
+var ErrSearchUnavailable = errors.New("message search is unavailable while encryption at rest is enabled")
+
 type MessageService interface {
 	CreateMessage(message *model.Message) error
 	CreateMessages(messages *[]model.Message) error
 	GetChatMessages(instanceID string, chatJID string) (*[]model.Message, error)
+	GetChatMessagesAfter(instanceID string, chatJID string, after *model.Message, limit int) ([]model.Message, error)
 	CountChatMessages(instanceID string, chatJID string) (int64, error)
 	DeleteMessagesByInstanceID(instanceID string) error
+	DeleteChatMessages(instanceID string, chatJID string, until time.Time) error
+	SearchMessages(instanceID string, filter model.MessageSearchFilter) ([]model.MessageSearchResult, error)
+	GetMediaMessages(instanceID string, mediaType string, before time.Time) ([]model.Message, error)
+	ExpireMessagesMedia(messages []model.Message) error
+	GetStoredMessageIDs(instanceID string, messageIDs []string) (map[string]bool, error)
+	GetMessage(instanceID string, messageID string) (*model.Message, error)
+	UpdateMessage(id uint, data map[string]interface{}) error
+	SetMessageMedia(message *model.Message, blob *model.MediaBlob) error
 }
 
 type messageService struct {
-	messageRep repository.MessageRepository
+	messageRep   repository.MessageRepository
+	mediaService MediaService
 }
 
-func NewMessageService(messageRep repository.MessageRepository) *messageService {
+func NewMessageService(messageRep repository.MessageRepository, mediaService MediaService) *messageService {
 	return &messageService{
-		messageRep: messageRep,
+		messageRep:   messageRep,
+		mediaService: mediaService,
 	}
 }
 
@@ -35,10 +56,92 @@ func (m *messageService) GetChatMessages(instanceID string, chatJID string) (*[]
 	return m.messageRep.GetChatMessages(instanceID, chatJID)
 }
 
+func (m *messageService) GetChatMessagesAfter(instanceID string, chatJID string, after *model.Message, limit int) ([]model.Message, error) {
+	return m.messageRep.GetChatMessagesAfter(instanceID, chatJID, after, limit)
+}
+
 func (m *messageService) CountChatMessages(instanceID string, chatJID string) (int64, error) {
 	return m.messageRep.CountChatMessages(instanceID, chatJID)
 }
 
 func (m *messageService) DeleteMessagesByInstanceID(instanceID string) error {
-	return m.messageRep.DeleteMessagesByInstanceID(instanceID)
+	return m.mediaService.ReleaseStoredMedia(func() ([]string, error) {
+		return m.messageRep.DeleteMessagesByInstanceID(instanceID)
+	})
+}
+
+func (m *messageService) SearchMessages(instanceID string, filter model.MessageSearchFilter) ([]model.MessageSearchResult, error) {
+	if helper.GetKeyring().Enabled() {
+		return nil, ErrSearchUnavailable
+	}
+	return m.messageRep.SearchMessages(instanceID, filter)
+}
+
+func (m *messageService) DeleteChatMessages(instanceID string, chatJID string, until time.Time) error {
+	return m.mediaService.ReleaseStoredMedia(func() ([]string, error) {
+		return m.messageRep.DeleteChatMessages(instanceID, chatJID, until)
+	})
+}
+
+func (m *messageService) GetMediaMessages(instanceID string, mediaType string, before time.Time) ([]model.Message, error) {
+	return m.messageRep.GetMediaMessages(instanceID, mediaType, before)
+}
+
+// ExpireMessagesMedia releases the media of the messages and flags them, so
+// responses can tell expired media apart from missing files. Media another
+// call already expired isn't released again.
+func (m *messageService) ExpireMessagesMedia(messages []model.Message) error {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	return m.mediaService.ReleaseStoredMedia(func() ([]string, error) {
+		return m.messageRep.ExpireMessagesMedia(ids)
+	})
+}
+
+func (m *messageService) GetStoredMessageIDs(instanceID string, messageIDs []string) (map[string]bool, error) {
+	stored := make(map[string]bool)
+	for start := 0; start < len(messageIDs); start += storedMessageIDsBatchSize {
+		end := helper.Min(start+storedMessageIDsBatchSize, len(messageIDs))
+		ids, err := m.messageRep.GetStoredMessageIDs(instanceID, messageIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			stored[id] = true
+		}
+	}
+	return stored, nil
+}
+
+func (m *messageService) GetMessage(instanceID string, messageID string) (*model.Message, error) {
+	return m.messageRep.GetMessage(instanceID, messageID)
+}
+
+func (m *messageService) UpdateMessage(id uint, data map[string]interface{}) error {
+	return m.messageRep.UpdateMessage(id, data)
+}
+
+// SetMessageMedia stores media downloaded after the message was stored. When
+// the message got its media in the meantime, or was deleted or expired, the
+// reference to the blob is released again.
+func (m *messageService) SetMessageMedia(message *model.Message, blob *model.MediaBlob) error {
+	set, err := m.messageRep.SetMessageMedia(message.ID, blob.Path, blob.SHA256)
+	if err != nil || !set {
+		releaseErr := m.mediaService.ReleaseMedia([]model.Message{{
+			InstanceID:  message.InstanceID,
+			MediaPath:   blob.Path,
+			MediaSHA256: blob.SHA256,
+		}})
+		if err != nil {
+			return err
+		}
+		return releaseErr
+	}
+
+	message.MediaPath = blob.Path
+	message.MediaSHA256 = blob.SHA256
+	return nil
 }
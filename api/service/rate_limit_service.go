@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sync"
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+	"zapmeow/pkg/ratelimit"
+)
+
+type RateLimitService interface {
+	GetLimits(instanceID string) (*model.RateLimits, error)
+	SaveLimits(limits *model.RateLimits) error
+	DeleteLimits(instanceID string) error
+	// Reserve schedules a message of the instance, returning how long to
+	// wait before sending it, or a *ratelimit.Error when it would exceed the
+	// limits of the instance.
+	Reserve(instanceID string, newChat bool) (time.Duration, error)
+}
+
+type rateLimitService struct {
+	rateLimitsRepo repository.RateLimitsRepository
+	// defaults are the limits of instances without limits
+	defaults model.RateLimits
+	// limiters are kept in memory, as each instance sends from a single node
+	limiters sync.Map
+}
+
+func NewRateLimitService(rateLimitsRepo repository.RateLimitsRepository, defaults model.RateLimits) *rateLimitService {
+	return &rateLimitService{
+		rateLimitsRepo: rateLimitsRepo,
+		defaults:       defaults,
+	}
+}
+
+// GetLimits returns the rate limits of the instance, or the defaults when
+// none were saved.
+func (s *rateLimitService) GetLimits(instanceID string) (*model.RateLimits, error) {
+	limits, err := s.rateLimitsRepo.GetLimits(instanceID)
+	if err != nil || limits != nil {
+		return limits, err
+	}
+
+	defaults := s.defaults
+	defaults.InstanceID = instanceID
+	return &defaults, nil
+}
+
+func (s *rateLimitService) SaveLimits(limits *model.RateLimits) error {
+	return s.rateLimitsRepo.SaveLimits(limits)
+}
+
+func (s *rateLimitService) DeleteLimits(instanceID string) error {
+	s.limiters.Delete(instanceID)
+	return s.rateLimitsRepo.DeleteLimits(instanceID)
+}
+
+func (s *rateLimitService) Reserve(instanceID string, newChat bool) (time.Duration, error) {
+	limits, err := s.GetLimits(instanceID)
+	if err != nil {
+		return 0, err
+	}
+
+	limiter, _ := s.limiters.LoadOrStore(instanceID, ratelimit.NewLimiter())
+	return limiter.(*ratelimit.Limiter).Reserve(ratelimit.Limits{
+		PerSecond:      limits.MessagesPerSecond,
+		PerMinute:      limits.MessagesPerMinute,
+		NewChatsPerDay: limits.NewChatsPerDay,
+		MinInterval:    time.Duration(limits.MinIntervalMs) * time.Millisecond,
+		MaxInterval:    time.Duration(limits.MaxIntervalMs) * time.Millisecond,
+	}, newChat)
+}
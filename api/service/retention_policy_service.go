@@ -0,0 +1,37 @@
+package service
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+)
+
+type RetentionPolicyService interface {
+	GetPolicies() ([]model.RetentionPolicy, error)
+	GetPoliciesByInstanceID(instanceID string) ([]model.RetentionPolicy, error)
+	ReplacePolicies(instanceID string, policies []model.RetentionPolicy) error
+}
+
+type retentionPolicyService struct {
+	retentionPolicyRepo repository.RetentionPolicyRepository
+}
+
+func NewRetentionPolicyService(retentionPolicyRepo repository.RetentionPolicyRepository) *retentionPolicyService {
+	return &retentionPolicyService{
+		retentionPolicyRepo: retentionPolicyRepo,
+	}
+}
+
+func (r *retentionPolicyService) GetPolicies() ([]model.RetentionPolicy, error) {
+	return r.retentionPolicyRepo.GetPolicies()
+}
+
+func (r *retentionPolicyService) GetPoliciesByInstanceID(instanceID string) ([]model.RetentionPolicy, error) {
+	return r.retentionPolicyRepo.GetPoliciesByInstanceID(instanceID)
+}
+
+func (r *retentionPolicyService) ReplacePolicies(instanceID string, policies []model.RetentionPolicy) error {
+	for i := range policies {
+		policies[i].InstanceID = instanceID
+	}
+	return r.retentionPolicyRepo.ReplacePolicies(instanceID, policies)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+)
+
+type SendJobService interface {
+	CreateJob(instanceID string, message OutgoingMessage) (*model.SendJob, error)
+	GetJob(instanceID string, id uint) (*model.SendJob, error)
+	// GetNextJobs returns the oldest unfinished job of each instance, as
+	// the jobs of an instance are sent in order. Only their ID, instance and
+	// due time are loaded.
+	GetNextJobs() ([]model.SendJob, error)
+	// GetNextJob returns the oldest unfinished job of the instance, whose
+	// payload is read by ParseMessage.
+	GetNextJob(instanceID string) (*model.SendJob, error)
+	// ClaimJob reserves a due job until the given time, when it's delivered
+	// again unless it was finished. It fails when the job was claimed
+	// already.
+	ClaimJob(job *model.SendJob, until time.Time) (bool, error)
+	// ParseMessage decrypts the payload of the job and parses its message.
+	// A payload that can't be decrypted, e.g. after its key was lost, is an
+	// ErrInvalidMessage, as retrying the job wouldn't read it either.
+	ParseMessage(job *model.SendJob) (OutgoingMessage, error)
+	CompleteJob(job *model.SendJob, message *model.Message) error
+	// RetryJob schedules the job again at the given time, counting the
+	// failed attempt when attempted is true.
+	RetryJob(job *model.SendJob, at time.Time, attempted bool, reason error) error
+	FailJob(job *model.SendJob, reason error) error
+}
+
+type sendJobService struct {
+	sendJobRepo repository.SendJobRepository
+}
+
+func NewSendJobService(sendJobRepo repository.SendJobRepository) *sendJobService {
+	return &sendJobService{
+		sendJobRepo: sendJobRepo,
+	}
+}
+
+func (s *sendJobService) CreateJob(instanceID string, message OutgoingMessage) (*model.SendJob, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &model.SendJob{
+		InstanceID:    instanceID,
+		Type:          message.Type,
+		Phone:         message.Phone,
+		Payload:       string(payload),
+		Status:        model.SendJobPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := s.sendJobRepo.CreateJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *sendJobService) GetJob(instanceID string, id uint) (*model.SendJob, error) {
+	return s.sendJobRepo.GetJob(instanceID, id)
+}
+
+func (s *sendJobService) GetNextJobs() ([]model.SendJob, error) {
+	return s.sendJobRepo.GetNextJobs()
+}
+
+func (s *sendJobService) GetNextJob(instanceID string) (*model.SendJob, error) {
+	return s.sendJobRepo.GetNextJob(instanceID)
+}
+
+func (s *sendJobService) ClaimJob(job *model.SendJob, until time.Time) (bool, error) {
+	return s.sendJobRepo.ClaimJob(job, until)
+}
+
+func (s *sendJobService) ParseMessage(job *model.SendJob) (OutgoingMessage, error) {
+	var message OutgoingMessage
+	if err := s.sendJobRepo.DecryptPayload(job); err != nil {
+		return message, fmt.Errorf("%w: can't decrypt payload: %s", ErrInvalidMessage, err)
+	}
+	if err := json.Unmarshal([]byte(job.Payload), &message); err != nil {
+		return message, fmt.Errorf("%w: %s", ErrInvalidMessage, err)
+	}
+	return message, nil
+}
+
+// CompleteJob drops the payload of the job, which isn't needed anymore.
+func (s *sendJobService) CompleteJob(job *model.SendJob, message *model.Message) error {
+	now := time.Now()
+	job.Status = model.SendJobSucceeded
+	job.Attempts++
+	job.Error = ""
+	job.MessageID = message.MessageID
+	job.CompletedAt = &now
+	return s.sendJobRepo.UpdateJob(job.ID, map[string]interface{}{
+		"Status":      job.Status,
+		"Attempts":    job.Attempts,
+		"Error":       job.Error,
+		"MessageID":   job.MessageID,
+		"CompletedAt": now,
+		"Payload":     "",
+	})
+}
+
+func (s *sendJobService) RetryJob(job *model.SendJob, at time.Time, attempted bool, reason error) error {
+	job.Status = model.SendJobPending
+	job.NextAttemptAt = at
+	job.Error = reason.Error()
+	if attempted {
+		job.Attempts++
+	}
+	return s.sendJobRepo.UpdateJob(job.ID, map[string]interface{}{
+		"Status":        job.Status,
+		"NextAttemptAt": job.NextAttemptAt,
+		"Error":         job.Error,
+		"Attempts":      job.Attempts,
+	})
+}
+
+// FailJob drops the payload of the job, which won't be sent anymore.
+func (s *sendJobService) FailJob(job *model.SendJob, reason error) error {
+	now := time.Now()
+	job.Status = model.SendJobFailed
+	job.Attempts++
+	job.Error = reason.Error()
+	job.CompletedAt = &now
+	return s.sendJobRepo.UpdateJob(job.ID, map[string]interface{}{
+		"Status":      job.Status,
+		"Attempts":    job.Attempts,
+		"Error":       job.Error,
+		"CompletedAt": now,
+		"Payload":     "",
+	})
+}
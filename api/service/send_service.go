@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"zapmeow/api/helper"
+	"zapmeow/api/model"
+	"zapmeow/pkg/logger"
+	"zapmeow/pkg/whatsapp"
+
+	"github.com/vincent-petithory/dataurl"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// types of outgoing messages
+const (
+	TextMessage     = "text"
+	ImageMessage    = "image"
+	AudioMessage    = "audio"
+	DocumentMessage = "document"
+)
+
+// OutgoingMessage is a message as received by the send endpoints. Media is
+// given as a data URI in Base64.
+type OutgoingMessage struct {
+	Type     string `json:"type"`
+	Phone    string `json:"phone"`
+	Text     string `json:"text,omitempty"`
+	Base64   string `json:"base64,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// ErrInvalidMessage is returned for messages that can't be sent, however
+// many times they're retried.
+var ErrInvalidMessage = errors.New("invalid message")
+
+type SendService interface {
+	// Send sends the message through the instance and stores it, returning
+	// a *ratelimit.Error when it would exceed the rate limits of the
+	// instance. Waiting for its send slot ends early when ctx is done. Once
+	// the message is sent, failing to store it is logged instead of returned.
+	Send(ctx context.Context, instance *whatsapp.Instance, message OutgoingMessage) (*model.Message, error)
+}
+
+type sendService struct {
+	whatsAppService WhatsAppService
+	messageService  MessageService
+	chatService     ChatService
+	mediaService    MediaService
+}
+
+func NewSendService(
+	whatsAppService WhatsAppService,
+	messageService MessageService,
+	chatService ChatService,
+	mediaService MediaService,
+) *sendService {
+	return &sendService{
+		whatsAppService: whatsAppService,
+		messageService:  messageService,
+		chatService:     chatService,
+		mediaService:    mediaService,
+	}
+}
+
+func (s *sendService) Send(ctx context.Context, instance *whatsapp.Instance, message OutgoingMessage) (*model.Message, error) {
+	jid, ok := helper.MakeJID(message.Phone)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid phone", ErrInvalidMessage)
+	}
+
+	var sent *model.Message
+	var err error
+	if message.Type == TextMessage {
+		sent, err = s.sendText(ctx, instance, jid, message)
+	} else {
+		sent, err = s.sendMedia(ctx, instance, jid, message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the message was sent, so failing to store it is only logged, as
+	// returning an error would get it sent again
+	if err := s.messageService.CreateMessage(sent); err != nil {
+		logger.Error("Failed to create message. ", err)
+		if err := s.mediaService.ReleaseMedia([]model.Message{*sent}); err != nil {
+			logger.Error("Failed to release media. ", err)
+		}
+		return sent, nil
+	}
+
+	if err := s.chatService.RecordMessage(sent, jid.Server == types.GroupServer); err != nil {
+		logger.Error("Failed to update chat. ", err)
+	}
+	return sent, nil
+}
+
+func (s *sendService) sendText(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID, message OutgoingMessage) (*model.Message, error) {
+	resp, err := s.whatsAppService.SendTextMessage(ctx, instance, jid, message.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Message{
+		MessageID:  resp.ID,
+		ChatJID:    jid.User,
+		SenderJID:  resp.Sender.User,
+		InstanceID: instance.ID,
+		Body:       message.Text,
+		Timestamp:  resp.Timestamp,
+		FromMe:     true,
+	}, nil
+}
+
+func (s *sendService) sendMedia(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID, message OutgoingMessage) (*model.Message, error) {
+	mimitype, err := helper.GetMimeTypeFromDataURI(message.Base64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMessage, err)
+	}
+
+	mediaURL, err := dataurl.DecodeString(message.Base64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMessage, err)
+	}
+
+	var resp whatsapp.MessageResponse
+	switch message.Type {
+	case ImageMessage:
+		resp, err = s.whatsAppService.SendImageMessage(ctx, instance, jid, mediaURL, mimitype)
+	case AudioMessage:
+		resp, err = s.whatsAppService.SendAudioMessage(ctx, instance, jid, mediaURL, mimitype)
+	case DocumentMessage:
+		resp, err = s.whatsAppService.SendDocumentMessage(ctx, instance, jid, mediaURL, mimitype, message.Filename)
+	default:
+		return nil, fmt.Errorf("%w: unknown type %s", ErrInvalidMessage, message.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sent := &model.Message{
+		FromMe:     true,
+		ChatJID:    jid.User,
+		SenderJID:  resp.Sender.User,
+		InstanceID: instance.ID,
+		Timestamp:  resp.Timestamp,
+		MessageID:  resp.ID,
+		Filename:   message.Filename,
+		MediaType:  message.Type,
+	}
+
+	// the message is stored without its media when saving it fails
+	blob, err := s.mediaService.SaveMedia(instance.ID, mediaURL.Data, mimitype)
+	if err != nil {
+		logger.Error("Failed to save media. ", err)
+		return sent, nil
+	}
+
+	sent.MediaPath = blob.Path
+	sent.MediaSHA256 = blob.SHA256
+	return sent, nil
+}
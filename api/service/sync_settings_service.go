@@ -0,0 +1,45 @@
+package service
+
+import (
+	"zapmeow/api/model"
+	"zapmeow/api/repository"
+)
+
+type SyncSettingsService interface {
+	GetSettings(instanceID string) (*model.SyncSettings, error)
+	SaveSettings(settings *model.SyncSettings) error
+}
+
+type syncSettingsService struct {
+	syncSettingsRepo repository.SyncSettingsRepository
+	// maxMessagesPerChat is the default for instances without settings
+	maxMessagesPerChat int
+}
+
+func NewSyncSettingsService(syncSettingsRepo repository.SyncSettingsRepository, maxMessagesPerChat int) *syncSettingsService {
+	return &syncSettingsService{
+		syncSettingsRepo:   syncSettingsRepo,
+		maxMessagesPerChat: maxMessagesPerChat,
+	}
+}
+
+// GetSettings returns the sync settings of the instance, or the defaults when
+// none were saved.
+func (s *syncSettingsService) GetSettings(instanceID string) (*model.SyncSettings, error) {
+	settings, err := s.syncSettingsRepo.GetSettings(instanceID)
+	if err != nil || settings != nil {
+		return settings, err
+	}
+
+	return &model.SyncSettings{
+		InstanceID:         instanceID,
+		Enabled:            true,
+		MaxMessagesPerChat: s.maxMessagesPerChat,
+		IncludeGroups:      true,
+		DownloadMedia:      true,
+	}, nil
+}
+
+func (s *syncSettingsService) SaveSettings(settings *model.SyncSettings) error {
+	return s.syncSettingsRepo.SaveSettings(settings)
+}
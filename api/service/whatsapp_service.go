@@ -1,6 +1,10 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"time"
 	"zapmeow/api/helper"
 	"zapmeow/api/model"
 	"zapmeow/api/queue"
@@ -11,103 +15,481 @@ import (
 	"zapmeow/pkg/zapmeow"
 
 	"github.com/vincent-petithory/dataurl"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	"google.golang.org/protobuf/proto"
 )
 
 type whatsAppService struct {
-	app            *zapmeow.ZapMeow
-	messageService MessageService
-	accountService AccountService
-	whatsApp       whatsapp.WhatsApp
+	app              *zapmeow.ZapMeow
+	messageService   MessageService
+	accountService   AccountService
+	chatService      ChatService
+	mediaService     MediaService
+	contactService   ContactService
+	rateLimitService RateLimitService
+	whatsApp         whatsapp.WhatsApp
+
+	pairingMutex       sync.Mutex
+	pairingSubscribers map[string]map[chan PairingEvent]struct{}
+
+	// downloads holds the messages whose media is being downloaded, and
+	// downloadSlots bounds the reads downloading media at the same time
+	downloadsMutex sync.Mutex
+	downloads      map[uint]bool
+	downloadSlots  chan struct{}
+
+	// handlers tracks the events being handled, until shutdown starts
+	handlersMutex sync.Mutex
+	handlers      sync.WaitGroup
+	shuttingDown  bool
 }
 
 type WhatsAppService interface {
 	GetInstance(instanceID string) (*whatsapp.Instance, error)
+	GetStoredInstance(instanceID string) (*whatsapp.Instance, error)
+	UnloadInstance(instanceID string)
+	GetInstanceStatus(account model.Account) string
+	Reconnect(instance *whatsapp.Instance) error
+	SetInstanceProxy(instanceID string, proxyURL string) error
+	RecordConnectionState(instanceID string, state string, reason string, attempts int)
+	DeleteInstance(instanceID string) error
 	IsAuthenticated(instance *whatsapp.Instance) bool
+	PairPhone(instance *whatsapp.Instance, phone string) (string, error)
+	SubscribePairing(instanceID string) (<-chan PairingEvent, func())
 	Logout(instance *whatsapp.Instance) error
-	SendTextMessage(instance *whatsapp.Instance, jid whatsapp.JID, text string) (whatsapp.MessageResponse, error)
-	SendAudioMessage(instance *whatsapp.Instance, jid whatsapp.JID, audioURL *dataurl.DataURL, mimitype string) (whatsapp.MessageResponse, error)
-	SendDocumentMessage(instance *whatsapp.Instance, jid whatsapp.JID, documentURL *dataurl.DataURL, mimitype string, filename string) (whatsapp.MessageResponse, error)
-	SendImageMessage(instance *whatsapp.Instance, jid whatsapp.JID, imageURL *dataurl.DataURL, mimitype string) (whatsapp.MessageResponse, error)
+	SendTextMessage(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID, text string) (whatsapp.MessageResponse, error)
+	SendAudioMessage(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID, audioURL *dataurl.DataURL, mimitype string) (whatsapp.MessageResponse, error)
+	SendDocumentMessage(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID, documentURL *dataurl.DataURL, mimitype string, filename string) (whatsapp.MessageResponse, error)
+	SendImageMessage(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID, imageURL *dataurl.DataURL, mimitype string) (whatsapp.MessageResponse, error)
 	GetContactInfo(instance *whatsapp.Instance, jid whatsapp.JID) (*whatsapp.ContactInfo, error)
+	GetChatName(instance *whatsapp.Instance, chat model.Chat) string
 	ParseEventMessage(instance *whatsapp.Instance, message *events.Message) (whatsapp.Message, error)
+	ParseEventMessageWithoutMedia(instance *whatsapp.Instance, message *events.Message) whatsapp.Message
 	IsOnWhatsApp(instance *whatsapp.Instance, phones []string) ([]whatsapp.IsOnWhatsAppResponse, error)
+	ArchiveChat(instance *whatsapp.Instance, jid whatsapp.JID, archived bool) error
+	PinChat(instance *whatsapp.Instance, jid whatsapp.JID, pinned bool) error
+	MuteChat(instance *whatsapp.Instance, jid whatsapp.JID, muted bool, duration time.Duration) error
+	MarkChatAsUnread(instance *whatsapp.Instance, jid whatsapp.JID, unread bool) error
+	ClearChat(instance *whatsapp.Instance, jid whatsapp.JID) error
+	DeleteChat(instance *whatsapp.Instance, jid whatsapp.JID) error
+	RequestHistorySync(instance *whatsapp.Instance, jid whatsapp.JID, count int) error
+	DownloadMessagesMedia(instance *whatsapp.Instance, messages []model.Message)
+	RetryMessageMedia(instance *whatsapp.Instance, message *model.Message) error
+	Shutdown(ctx context.Context) error
+}
+
+const (
+	PairingCode        = "code"
+	PairingSuccess     = "success"
+	PairingTimeout     = "timeout"
+	PairingRateLimited = "rate-limit"
+	PairingError       = "error"
+)
+
+// PairingEvent is a new QR code of an instance, or the outcome of its pairing.
+type PairingEvent struct {
+	Event string `json:"event"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
+// ErrInstanceNotFound is returned for instances that weren't created through
+// the instance API.
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// ErrInstanceOwnedByAnotherNode is returned in cluster mode for instances
+// loaded by another node.
+var ErrInstanceOwnedByAnotherNode = errors.New("instance is owned by another node")
+
+// logoutConnectTimeout bounds how long an instance that isn't loaded takes
+// to connect, to log out before it's deleted
+const logoutConnectTimeout = 10 * time.Second
+
+// mediaDownloadSlots is how many reads may download their media in the
+// background at the same time
+const mediaDownloadSlots = 4
+
+// ErrShuttingDown is returned when a message waiting for its send slot is
+// interrupted by the shutdown of the server.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// ErrNoStoredMessages is returned when a chat has no message to request
+// older history from.
+var ErrNoStoredMessages = errors.New("chat has no stored messages")
+
 func NewWhatsAppService(
 	app *zapmeow.ZapMeow,
 	messageService MessageService,
 	accountService AccountService,
+	chatService ChatService,
+	mediaService MediaService,
+	contactService ContactService,
+	rateLimitService RateLimitService,
 	whatsApp whatsapp.WhatsApp,
 ) *whatsAppService {
 	return &whatsAppService{
-		app:            app,
-		messageService: messageService,
-		accountService: accountService,
-		whatsApp:       whatsApp,
+		app:              app,
+		messageService:   messageService,
+		accountService:   accountService,
+		chatService:      chatService,
+		mediaService:     mediaService,
+		contactService:   contactService,
+		rateLimitService: rateLimitService,
+		whatsApp:         whatsApp,
+
+		pairingSubscribers: make(map[string]map[chan PairingEvent]struct{}),
+		downloads:          make(map[uint]bool),
+		downloadSlots:      make(chan struct{}, mediaDownloadSlots),
 	}
 }
 
 func (w *whatsAppService) SendTextMessage(
+	ctx context.Context,
 	instance *whatsapp.Instance,
 	jid whatsapp.JID,
 	text string,
 ) (whatsapp.MessageResponse, error) {
+	if err := w.throttle(ctx, instance, jid); err != nil {
+		return whatsapp.MessageResponse{}, err
+	}
 	return w.whatsApp.SendTextMessage(instance, jid, text)
 }
 
 func (w *whatsAppService) SendDocumentMessage(
+	ctx context.Context,
 	instance *whatsapp.Instance,
 	jid whatsapp.JID,
 	documentURL *dataurl.DataURL,
 	mimitype string,
 	filename string,
 ) (whatsapp.MessageResponse, error) {
+	if err := w.throttle(ctx, instance, jid); err != nil {
+		return whatsapp.MessageResponse{}, err
+	}
 	return w.whatsApp.SendDocumentMessage(instance, jid, documentURL, mimitype, filename)
 }
 
 func (w *whatsAppService) SendAudioMessage(
+	ctx context.Context,
 	instance *whatsapp.Instance,
 	jid whatsapp.JID,
 	audioURL *dataurl.DataURL,
 	mimitype string,
 ) (whatsapp.MessageResponse, error) {
+	if err := w.throttle(ctx, instance, jid); err != nil {
+		return whatsapp.MessageResponse{}, err
+	}
 	return w.whatsApp.SendAudioMessage(instance, jid, audioURL, mimitype)
 }
 
 func (w *whatsAppService) SendImageMessage(
+	ctx context.Context,
 	instance *whatsapp.Instance,
 	jid whatsapp.JID,
 	imageURL *dataurl.DataURL,
 	mimitype string,
 ) (whatsapp.MessageResponse, error) {
+	if err := w.throttle(ctx, instance, jid); err != nil {
+		return whatsapp.MessageResponse{}, err
+	}
 	return w.whatsApp.SendImageMessage(instance, jid, imageURL, mimitype)
 }
 
+// throttle waits for the next send slot of the instance, failing with a
+// *ratelimit.Error when sending now would exceed its rate limits. Messages to
+// users without a chat count as new chats. The wait ends early when ctx is
+// done or the server stops, and the slot is lost.
+func (w *whatsAppService) throttle(ctx context.Context, instance *whatsapp.Instance, jid whatsapp.JID) error {
+	newChat := false
+	if jid.Server == types.DefaultUserServer {
+		chat, err := w.chatService.GetChat(instance.ID, jid.User)
+		if err != nil {
+			return err
+		}
+		newChat = chat == nil
+	}
+
+	delay, err := w.rateLimitService.Reserve(instance.ID, newChat)
+	if err != nil {
+		return err
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-*w.app.StopCh:
+		return ErrShuttingDown
+	}
+}
+
 func (w *whatsAppService) GetContactInfo(instance *whatsapp.Instance, jid whatsapp.JID) (*whatsapp.ContactInfo, error) {
 	return w.whatsApp.GetContactInfo(instance, jid)
 }
 
+// GetChatName returns the stored chat name or resolves it from the contact
+// store, falling back to the names imported by history sync. Group names
+// need a request to WhatsApp, so they are persisted.
+func (w *whatsAppService) GetChatName(instance *whatsapp.Instance, chat model.Chat) string {
+	if chat.Name != "" {
+		return chat.Name
+	}
+
+	var contact *model.Contact
+	if !chat.IsGroup {
+		var err error
+		contact, err = w.contactService.GetContact(chat.InstanceID, chat.ChatJID)
+		if err != nil {
+			logger.Error("Failed to get contact. ", err)
+		}
+		if contact != nil && contact.Name != "" {
+			return contact.Name
+		}
+	}
+
+	server := types.DefaultUserServer
+	if chat.IsGroup {
+		server = types.GroupServer
+	}
+
+	name, err := w.whatsApp.GetChatName(instance, types.NewJID(chat.ChatJID, server))
+	if err != nil {
+		logger.Error("Failed to get chat name. ", err)
+	}
+
+	if name == "" && contact != nil {
+		return contact.PushName
+	}
+
+	if chat.IsGroup && name != "" {
+		err = w.chatService.UpdateChat(chat.InstanceID, chat.ChatJID, map[string]interface{}{
+			"Name": name,
+		})
+		if err != nil {
+			logger.Error("Failed to update chat. ", err)
+		}
+	}
+	return name
+}
+
 func (w *whatsAppService) ParseEventMessage(instance *whatsapp.Instance, message *events.Message) (whatsapp.Message, error) {
 	return w.whatsApp.ParseEventMessage(instance, message)
 }
 
+func (w *whatsAppService) ParseEventMessageWithoutMedia(instance *whatsapp.Instance, message *events.Message) whatsapp.Message {
+	return w.whatsApp.ParseEventMessageWithoutMedia(instance, message)
+}
+
 func (w *whatsAppService) IsOnWhatsApp(instance *whatsapp.Instance, phones []string) ([]whatsapp.IsOnWhatsAppResponse, error) {
 	return w.whatsApp.IsOnWhatsApp(instance, phones)
 }
 
+func (w *whatsAppService) ArchiveChat(instance *whatsapp.Instance, jid whatsapp.JID, archived bool) error {
+	lastMessage, err := w.getLastMessage(instance.ID, jid)
+	if err != nil {
+		return err
+	}
+
+	err = w.whatsApp.ArchiveChat(instance, jid, archived, lastMessage)
+	if err != nil {
+		return err
+	}
+	return w.updateArchived(instance.ID, jid, archived)
+}
+
+func (w *whatsAppService) PinChat(instance *whatsapp.Instance, jid whatsapp.JID, pinned bool) error {
+	err := w.whatsApp.PinChat(instance, jid, pinned)
+	if err != nil {
+		return err
+	}
+
+	return w.chatService.UpdateChatSettings(&model.ChatSettings{
+		InstanceID: instance.ID,
+		ChatJID:    jid.User,
+		Pinned:     pinned,
+	}, "pinned")
+}
+
+func (w *whatsAppService) MuteChat(instance *whatsapp.Instance, jid whatsapp.JID, muted bool, duration time.Duration) error {
+	err := w.whatsApp.MuteChat(instance, jid, muted, duration)
+	if err != nil {
+		return err
+	}
+
+	var mutedUntil *time.Time
+	if muted && duration > 0 {
+		until := time.Now().Add(duration)
+		mutedUntil = &until
+	}
+	return w.updateMuted(instance.ID, jid, muted, mutedUntil)
+}
+
+func (w *whatsAppService) MarkChatAsUnread(instance *whatsapp.Instance, jid whatsapp.JID, unread bool) error {
+	lastMessage, err := w.getLastMessage(instance.ID, jid)
+	if err != nil {
+		return err
+	}
+
+	err = w.whatsApp.MarkChatAsRead(instance, jid, !unread, lastMessage)
+	if err != nil {
+		return err
+	}
+	return w.updateMarkedUnread(instance.ID, jid, unread)
+}
+
+func (w *whatsAppService) ClearChat(instance *whatsapp.Instance, jid whatsapp.JID) error {
+	lastMessage, err := w.getLastMessage(instance.ID, jid)
+	if err != nil {
+		return err
+	}
+
+	err = w.whatsApp.ClearChat(instance, jid, lastMessage)
+	if err != nil {
+		return err
+	}
+	return w.clearChat(instance.ID, jid, time.Time{})
+}
+
+func (w *whatsAppService) DeleteChat(instance *whatsapp.Instance, jid whatsapp.JID) error {
+	lastMessage, err := w.getLastMessage(instance.ID, jid)
+	if err != nil {
+		return err
+	}
+
+	err = w.whatsApp.DeleteChat(instance, jid, lastMessage)
+	if err != nil {
+		return err
+	}
+	return w.deleteChat(instance.ID, jid, time.Time{})
+}
+
+// RequestHistorySync asks for the messages of a chat older than the oldest
+// stored one. They arrive later as an on-demand history sync.
+func (w *whatsAppService) RequestHistorySync(instance *whatsapp.Instance, jid whatsapp.JID, count int) error {
+	messages, err := w.messageService.GetChatMessagesAfter(instance.ID, jid.User, nil, 1)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return ErrNoStoredMessages
+	}
+
+	oldest := messages[0]
+	return w.whatsApp.RequestHistorySync(instance, jid, &whatsapp.LastMessage{
+		ID:        oldest.MessageID,
+		FromMe:    oldest.FromMe,
+		Timestamp: oldest.Timestamp,
+	}, count)
+}
+
+// DownloadMessagesMedia downloads, in the background, the media of messages
+// stored without it, e.g. from history sync. Reads don't wait for it, so the
+// media shows up in the following reads. Media that can't be downloaded is
+// left out, so it can be requested again with RetryMessageMedia.
+func (w *whatsAppService) DownloadMessagesMedia(instance *whatsapp.Instance, messages []model.Message) {
+	var downloads []model.Message
+	w.downloadsMutex.Lock()
+	for _, message := range messages {
+		if message.MediaType == "" || message.MediaPath != "" || message.MediaExpired ||
+			message.MediaDirectPath == "" || len(message.MediaKey) == 0 || w.downloads[message.ID] {
+			continue
+		}
+		w.downloads[message.ID] = true
+		downloads = append(downloads, message)
+	}
+	w.downloadsMutex.Unlock()
+
+	if len(downloads) == 0 || !w.startHandling() {
+		w.finishDownloads(downloads)
+		return
+	}
+
+	go func() {
+		defer w.handlers.Done()
+		defer w.finishDownloads(downloads)
+
+		// downloads still waiting for a slot on shutdown are dropped, so
+		// they don't hold it up
+		select {
+		case <-*w.app.StopCh:
+			return
+		case w.downloadSlots <- struct{}{}:
+		}
+		defer func() { <-w.downloadSlots }()
+
+		for i := range downloads {
+			select {
+			case <-*w.app.StopCh:
+				return
+			default:
+			}
+
+			if err := w.downloadMessageMedia(instance, &downloads[i]); err != nil {
+				logger.Error("Failed to download media. ", err)
+			}
+		}
+	}()
+}
+
+func (w *whatsAppService) finishDownloads(messages []model.Message) {
+	w.downloadsMutex.Lock()
+	defer w.downloadsMutex.Unlock()
+
+	for _, message := range messages {
+		delete(w.downloads, message.ID)
+	}
+}
+
+// RetryMessageMedia asks the phone to upload the media of a message again,
+// once it was removed from the WhatsApp servers. The media is downloaded when
+// the phone answers.
+func (w *whatsAppService) RetryMessageMedia(instance *whatsapp.Instance, message *model.Message) error {
+	chat, ok := w.chatService.ResolveChatJID(instance.ID, message.ChatJID)
+	if !ok {
+		return errors.New("invalid chat")
+	}
+
+	return w.whatsApp.RequestMediaRetry(instance, whatsapp.MediaRetryMessage{
+		ID:       message.MessageID,
+		Chat:     chat,
+		Sender:   types.NewJID(message.SenderJID, types.DefaultUserServer),
+		FromMe:   message.FromMe,
+		MediaKey: message.MediaKey,
+	})
+}
+
 func (w *whatsAppService) GetInstance(instanceID string) (*whatsapp.Instance, error) {
 	instance := w.app.LoadInstance(instanceID)
 	if instance != nil {
 		return instance, nil
 	}
 
-	instance, err := w.gerOrCreateInstance(instanceID)
+	acquired, err := w.app.Cluster.Acquire(instanceID)
 	if err != nil {
 		return nil, err
 	}
+	if !acquired {
+		return nil, ErrInstanceOwnedByAnotherNode
+	}
+
+	instance, err = w.gerOrCreateInstance(instanceID)
+	if err != nil {
+		if releaseErr := w.app.Cluster.Release(instanceID); releaseErr != nil {
+			logger.Error("Failed to release instance lease. ", releaseErr)
+		}
+		return nil, err
+	}
 	w.app.StoreInstance(instanceID, instance)
 
 	instance = w.app.LoadInstance(instanceID)
@@ -116,15 +498,23 @@ func (w *whatsAppService) GetInstance(instanceID string) (*whatsapp.Instance, er
 	})
 
 	err = w.whatsApp.InitInstance(instance, func(event string, code string, err error) {
+		w.publishPairing(instanceID, event, code, err)
+
 		switch event {
 		case "code":
 			{
 				instance.QrCodeRateLimit -= 1
-				err = w.accountService.UpdateAccount(instanceID, map[string]interface{}{
-					"QrCode":    code,
-					"Status":    "UNPAIRED",
-					"WasSynced": false,
-				})
+				data := map[string]interface{}{
+					"QrCode": code,
+				}
+
+				// QR codes keep rotating while a pairing code is entered on the phone
+				account, err := w.accountService.GetAccountByInstanceID(instanceID)
+				if err != nil || account == nil || account.PairingCode == "" {
+					data["Status"] = "UNPAIRED"
+				}
+
+				err = w.accountService.UpdateAccount(instanceID, data)
 				if err != nil {
 					logger.Error("Failed to update account. ", err)
 				}
@@ -144,8 +534,9 @@ func (w *whatsAppService) GetInstance(instanceID string) (*whatsapp.Instance, er
 		case "timeout":
 			{
 				err := w.accountService.UpdateAccount(instanceID, map[string]interface{}{
-					"QrCode": "",
-					"Status": "TIMEOUT",
+					"QrCode":      "",
+					"PairingCode": "",
+					"Status":      "TIMEOUT",
 				})
 				if err != nil {
 					logger.Error("Failed to update account. ", err)
@@ -163,6 +554,252 @@ func (w *whatsAppService) GetInstance(instanceID string) (*whatsapp.Instance, er
 	return instance, nil
 }
 
+// GetStoredInstance returns the loaded instance, or creates one from its
+// stored session without connecting it, e.g. to parse the messages of an
+// instance loaded by another node.
+func (w *whatsAppService) GetStoredInstance(instanceID string) (*whatsapp.Instance, error) {
+	instance := w.app.LoadInstance(instanceID)
+	if instance != nil {
+		return instance, nil
+	}
+	return w.gerOrCreateInstance(instanceID)
+}
+
+// UnloadInstance disconnects the instance and releases its lease, keeping its
+// session and data, so another node can load it.
+func (w *whatsAppService) UnloadInstance(instanceID string) {
+	instance := w.app.LoadInstance(instanceID)
+	if instance != nil {
+		w.whatsApp.Disconnect(instance)
+		w.app.DeleteInstance(instanceID)
+	}
+
+	if err := w.app.Cluster.Release(instanceID); err != nil {
+		logger.Error("Failed to release instance lease. ", err)
+	}
+}
+
+// PairPhone links the instance to the account of a phone number. The returned
+// code is entered on the phone, and expires along with the QR codes of the
+// instance.
+func (w *whatsAppService) PairPhone(instance *whatsapp.Instance, phone string) (string, error) {
+	code, err := w.whatsApp.PairPhone(instance, phone)
+	if err != nil {
+		return "", err
+	}
+
+	err = w.accountService.UpdateAccount(instance.ID, map[string]interface{}{
+		"PairingCode": code,
+		"Status":      "PAIRING",
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// SubscribePairing returns the QR codes and pairing outcome of an instance as
+// they happen, until the returned function is called.
+func (w *whatsAppService) SubscribePairing(instanceID string) (<-chan PairingEvent, func()) {
+	ch := make(chan PairingEvent, 8)
+
+	w.pairingMutex.Lock()
+	if w.pairingSubscribers[instanceID] == nil {
+		w.pairingSubscribers[instanceID] = make(map[chan PairingEvent]struct{})
+	}
+	w.pairingSubscribers[instanceID][ch] = struct{}{}
+	w.pairingMutex.Unlock()
+
+	return ch, func() {
+		w.pairingMutex.Lock()
+		defer w.pairingMutex.Unlock()
+		delete(w.pairingSubscribers[instanceID], ch)
+		if len(w.pairingSubscribers[instanceID]) == 0 {
+			delete(w.pairingSubscribers, instanceID)
+		}
+	}
+}
+
+func (w *whatsAppService) publishPairing(instanceID string, event string, code string, err error) {
+	pairingEvent := PairingEvent{Event: event, Code: code}
+	switch event {
+	case PairingCode, PairingSuccess, PairingTimeout, PairingRateLimited:
+	default:
+		// the QR channel reports errors as err-* events
+		pairingEvent.Event = PairingError
+		pairingEvent.Error = event
+		if err != nil {
+			pairingEvent.Error = err.Error()
+		}
+	}
+
+	w.pairingMutex.Lock()
+	defer w.pairingMutex.Unlock()
+	for ch := range w.pairingSubscribers[instanceID] {
+		// slow subscribers miss events rather than block pairing
+		select {
+		case ch <- pairingEvent:
+		default:
+		}
+	}
+}
+
+// GetInstanceStatus tells the status of an instance without loading it, so
+// listing instances doesn't connect them.
+func (w *whatsAppService) GetInstanceStatus(account model.Account) string {
+	instance := w.app.LoadInstance(account.InstanceID)
+	if instance == nil {
+		// in cluster mode it may be loaded by another node, which records
+		// its connection state
+		loadedElsewhere := w.app.Config.ClusterMode && account.ConnectionState == model.ConnectionConnected
+		if account.Status == "CONNECTED" && !loadedElsewhere {
+			return "DISCONNECTED"
+		}
+		return account.Status
+	}
+
+	if !instance.Client.IsConnected() {
+		return "DISCONNECTED"
+	}
+	if account.Status == "CONNECTED" && !instance.Client.IsLoggedIn() {
+		return "UNPAIRED"
+	}
+	return account.Status
+}
+
+// DeleteInstance logs the instance out of WhatsApp when it's paired, and
+// deletes its messages, chats and media.
+// DeleteInstance unlinks the instance from the phone and deletes its account
+// with all its data. An instance that isn't loaded is connected just to log
+// out, and its session is deleted from the device store even when logging
+// out fails, so it can't be used again.
+func (w *whatsAppService) DeleteInstance(instanceID string) error {
+	instance := w.app.LoadInstance(instanceID)
+	if instance == nil {
+		stored, err := w.gerOrCreateInstance(instanceID)
+		if err != nil {
+			return err
+		}
+		w.logoutStoredInstance(stored)
+	} else {
+		if w.IsAuthenticated(instance) {
+			err := w.whatsApp.Logout(instance)
+			if err != nil {
+				logger.Error("Failed to logout. ", err)
+			}
+		}
+
+		w.whatsApp.Disconnect(instance)
+		w.app.DeleteInstance(instanceID)
+		if err := w.app.Cluster.Release(instanceID); err != nil {
+			logger.Error("Failed to release instance lease. ", err)
+		}
+	}
+
+	if err := w.accountService.DeleteAccount(instanceID); err != nil {
+		return err
+	}
+	// the limiter of the instance is kept in memory
+	return w.rateLimitService.DeleteLimits(instanceID)
+}
+
+func (w *whatsAppService) logoutStoredInstance(instance *whatsapp.Instance) {
+	if instance.Client.Store.ID == nil {
+		return
+	}
+
+	err := w.whatsApp.Connect(instance)
+	if err == nil && instance.Client.WaitForConnection(logoutConnectTimeout) {
+		err = w.whatsApp.Logout(instance)
+	} else if err == nil {
+		err = errors.New("websocket didn't connect")
+	}
+	w.whatsApp.Disconnect(instance)
+	if err == nil {
+		return
+	}
+
+	logger.Error("Failed to logout. ", err)
+	if err := w.whatsApp.DeleteDevice(instance); err != nil {
+		logger.Error("Failed to delete device. ", err)
+	}
+}
+
+// Reconnect connects the websocket of a paired instance again. The connection state is
+// recorded once it's logged in again.
+func (w *whatsAppService) Reconnect(instance *whatsapp.Instance) error {
+	return w.whatsApp.Connect(instance)
+}
+
+// SetInstanceProxy stores the outbound proxy of the instance, or removes it
+// when proxyURL is empty. A paired instance is reconnected through it right
+// away, while an unpaired one is unloaded, so pairing starts over through it.
+func (w *whatsAppService) SetInstanceProxy(instanceID string, proxyURL string) error {
+	err := w.accountService.UpdateAccount(instanceID, map[string]interface{}{
+		"ProxyURL": proxyURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	instance := w.app.LoadInstance(instanceID)
+	if instance == nil {
+		return nil
+	}
+
+	if instance.Client.Store.ID == nil {
+		w.UnloadInstance(instanceID)
+		return nil
+	}
+
+	w.whatsApp.Disconnect(instance)
+	if err := w.whatsApp.SetProxy(instance, proxyURL); err != nil {
+		return err
+	}
+
+	// the connection supervisor keeps retrying through the new proxy
+	if err := w.whatsApp.Connect(instance); err != nil {
+		w.RecordConnectionState(instanceID, model.ConnectionDisconnected, "proxy: "+err.Error(), 0)
+		return err
+	}
+	return nil
+}
+
+// RecordConnectionState stores a connection state transition of the instance
+// and sends it to the webhook as a health event.
+func (w *whatsAppService) RecordConnectionState(instanceID string, state string, reason string, attempts int) {
+	data := map[string]interface{}{
+		"ConnectionState":   state,
+		"ConnectionError":   reason,
+		"ReconnectAttempts": attempts,
+	}
+	switch state {
+	case model.ConnectionConnected:
+		data["LastConnectedAt"] = time.Now()
+	case model.ConnectionDisconnected, model.ConnectionConflict:
+		data["LastDisconnectedAt"] = time.Now()
+	}
+
+	err := w.accountService.UpdateAccount(instanceID, data)
+	if err != nil {
+		logger.Error("Failed to update account. ", err)
+		return
+	}
+
+	body := map[string]interface{}{
+		"instanceId": instanceID,
+		"event":      "connection_state",
+		"state":      state,
+		"reason":     reason,
+		"attempts":   attempts,
+	}
+
+	err = http.Request(w.accountService.GetWebhookURL(instanceID), body)
+	if err != nil {
+		logger.Error("Failed to send webhook request. ", err)
+	}
+}
+
 func (w *whatsAppService) IsAuthenticated(instance *whatsapp.Instance) bool {
 	return w.whatsApp.IsConnected(instance) && w.whatsApp.IsLoggedIn(instance)
 }
@@ -189,29 +826,36 @@ func (w *whatsAppService) gerOrCreateInstance(instanceID string) (*whatsapp.Inst
 		return nil, err
 	}
 
-	if account == nil || (account != nil && account.Status != "CONNECTED") {
-		instance := w.whatsApp.CreateInstance(instanceID)
+	if account == nil {
+		return nil, ErrInstanceNotFound
+	}
 
-		err := w.accountService.CreateAccount(&model.Account{
-			InstanceID: instanceID,
-		})
-		if err != nil {
-			return nil, err
+	device := whatsapp.DeviceInfo{
+		Name:         account.DeviceName,
+		Platform:     account.DevicePlatform,
+		BrowserLabel: account.DeviceBrowserLabel,
+	}
+
+	var instance *whatsapp.Instance
+	if account.Status != "CONNECTED" {
+		instance = w.whatsApp.CreateInstance(instanceID, device)
+	} else {
+		jid := types.JID{
+			User:     account.User,
+			RawAgent: account.Agent,
+			Device:   account.Device,
+			Server:   account.Server,
 		}
-		return instance, nil
+		instance = w.whatsApp.CreateInstanceFromDevice(
+			instanceID,
+			jid,
+			device,
+		)
 	}
 
-	jid := types.JID{
-		User:   account.User,
-		Agent:  account.Agent,
-		Device: account.Device,
-		Server: account.Server,
-		AD:     account.AD,
+	if err := w.whatsApp.SetProxy(instance, account.ProxyURL); err != nil {
+		return nil, err
 	}
-	instance := w.whatsApp.CreateInstanceFromDevice(
-		instanceID,
-		jid,
-	)
 	return instance, nil
 }
 
@@ -223,17 +867,90 @@ func (w *whatsAppService) deleteInstance(instance *whatsapp.Instance) error {
 
 	w.whatsApp.Disconnect(instance)
 	w.app.DeleteInstance(instance.ID)
+
+	if err := w.app.Cluster.Release(instance.ID); err != nil {
+		logger.Error("Failed to release instance lease. ", err)
+	}
 	return nil
 }
 
+// Shutdown disconnects every instance and waits for the events being
+// handled, e.g. webhook requests, until the context is done. Their sessions
+// are kept, so they connect again on the next start, and their leases are
+// released for other nodes to load them.
+func (w *whatsAppService) Shutdown(ctx context.Context) error {
+	w.app.Instances.Range(func(key, value interface{}) bool {
+		w.whatsApp.Disconnect(value.(*whatsapp.Instance))
+		if err := w.app.Cluster.Release(key.(string)); err != nil {
+			logger.Error("Failed to release instance lease. ", err)
+		}
+		return true
+	})
+
+	w.handlersMutex.Lock()
+	w.shuttingDown = true
+	w.handlersMutex.Unlock()
+
+	return helper.WaitWithContext(ctx, &w.handlers)
+}
+
+// startHandling tracks an event being handled. Events still queued once
+// shutdown waits for the others are dropped, as their instance disconnected
+// before acknowledging them.
+func (w *whatsAppService) startHandling() bool {
+	w.handlersMutex.Lock()
+	defer w.handlersMutex.Unlock()
+
+	if w.shuttingDown {
+		return false
+	}
+	w.handlers.Add(1)
+	return true
+}
+
 func (w *whatsAppService) eventHandler(instanceID string, rawEvt interface{}) {
+	if !w.startHandling() {
+		return
+	}
+	defer w.handlers.Done()
+
 	switch evt := rawEvt.(type) {
 	case *events.Message:
 		w.handleMessage(instanceID, evt)
 	case *events.HistorySync:
 		w.handleHistorySync(instanceID, evt)
+	case *events.Receipt:
+		w.handleReceipt(instanceID, evt)
+	case *events.Archive:
+		w.handleArchive(instanceID, evt)
+	case *events.Pin:
+		w.handlePin(instanceID, evt)
+	case *events.Mute:
+		w.handleMute(instanceID, evt)
+	case *events.MarkChatAsRead:
+		w.handleMarkChatAsRead(instanceID, evt)
+	case *events.ClearChat:
+		w.handleClearChat(instanceID, evt)
+	case *events.DeleteChat:
+		w.handleDeleteChat(instanceID, evt)
+	case *events.MediaRetry:
+		w.handleMediaRetry(instanceID, evt)
 	case *events.Connected:
 		w.handleConnected(instanceID)
+	case *events.Disconnected:
+		w.handleConnectionLost(instanceID, model.ConnectionDisconnected, "disconnected")
+	case *events.StreamReplaced:
+		w.handleConnectionLost(instanceID, model.ConnectionConflict, "stream_replaced")
+	case *events.ConnectFailure:
+		w.handleConnectionLost(instanceID, model.ConnectionDisconnected, "connect_failure: "+evt.Reason.String())
+	case *events.TemporaryBan:
+		w.handleConnectionLost(instanceID, model.ConnectionDisconnected, "temporary_ban: "+evt.String())
+	case *events.ClientOutdated:
+		w.handleConnectionLost(instanceID, model.ConnectionDisconnected, "client_outdated")
+	case *events.KeepAliveTimeout:
+		w.handleKeepAliveTimeout(instanceID, evt)
+	case *events.KeepAliveRestored:
+		w.RecordConnectionState(instanceID, model.ConnectionConnected, "", 0)
 	case *events.LoggedOut:
 		w.handleLoggedOut(instanceID)
 	}
@@ -256,23 +973,251 @@ func (w *whatsAppService) handleHistorySync(instanceID string, evt *events.Histo
 	}
 }
 
+func (w *whatsAppService) handleReceipt(instanceID string, evt *events.Receipt) {
+	if !evt.IsFromMe || (evt.Type != events.ReceiptTypeRead && evt.Type != events.ReceiptTypeReadSelf) {
+		return
+	}
+
+	// the chat was read on another device of this account
+	err := w.chatService.MarkChatAsRead(instanceID, evt.Chat.User)
+	if err != nil {
+		logger.Error("Failed to mark chat as read. ", err)
+	}
+}
+
+func (w *whatsAppService) handleArchive(instanceID string, evt *events.Archive) {
+	err := w.updateArchived(instanceID, evt.JID, evt.Action.GetArchived())
+	if err != nil {
+		logger.Error("Failed to update chat settings. ", err)
+	}
+}
+
+func (w *whatsAppService) handlePin(instanceID string, evt *events.Pin) {
+	err := w.chatService.UpdateChatSettings(&model.ChatSettings{
+		InstanceID: instanceID,
+		ChatJID:    evt.JID.User,
+		Pinned:     evt.Action.GetPinned(),
+	}, "pinned")
+	if err != nil {
+		logger.Error("Failed to update chat settings. ", err)
+	}
+}
+
+func (w *whatsAppService) handleMute(instanceID string, evt *events.Mute) {
+	var mutedUntil *time.Time
+	if timestamp := evt.Action.GetMuteEndTimestamp(); timestamp > 0 {
+		until := time.UnixMilli(timestamp)
+		mutedUntil = &until
+	}
+
+	err := w.updateMuted(instanceID, evt.JID, evt.Action.GetMuted(), mutedUntil)
+	if err != nil {
+		logger.Error("Failed to update chat settings. ", err)
+	}
+}
+
+func (w *whatsAppService) handleMarkChatAsRead(instanceID string, evt *events.MarkChatAsRead) {
+	err := w.updateMarkedUnread(instanceID, evt.JID, !evt.Action.GetRead())
+	if err != nil {
+		logger.Error("Failed to update chat settings. ", err)
+	}
+}
+
+func (w *whatsAppService) handleClearChat(instanceID string, evt *events.ClearChat) {
+	err := w.clearChat(instanceID, evt.JID, w.getMessageRangeEnd(evt.Action.GetMessageRange()))
+	if err != nil {
+		logger.Error("Failed to clear chat. ", err)
+	}
+}
+
+func (w *whatsAppService) handleDeleteChat(instanceID string, evt *events.DeleteChat) {
+	err := w.deleteChat(instanceID, evt.JID, w.getMessageRangeEnd(evt.Action.GetMessageRange()))
+	if err != nil {
+		logger.Error("Failed to delete chat. ", err)
+	}
+}
+
+func (w *whatsAppService) handleMediaRetry(instanceID string, evt *events.MediaRetry) {
+	message, err := w.messageService.GetMessage(instanceID, evt.MessageID)
+	if err != nil {
+		logger.Error("Failed to get message. ", err)
+		return
+	}
+	if message == nil || len(message.MediaKey) == 0 || message.MediaPath != "" {
+		return
+	}
+
+	directPath, err := w.whatsApp.DecryptMediaRetry(evt, message.MediaKey)
+	if err != nil {
+		logger.Error("Failed to retry media. ", err)
+		return
+	}
+
+	err = w.messageService.UpdateMessage(message.ID, map[string]interface{}{
+		"media_direct_path": directPath,
+	})
+	if err != nil {
+		logger.Error("Failed to update message. ", err)
+		return
+	}
+	message.MediaDirectPath = directPath
+
+	instance := w.app.LoadInstance(instanceID)
+	if instance == nil {
+		return
+	}
+
+	err = w.downloadMessageMedia(instance, message)
+	if err != nil {
+		logger.Error("Failed to download media. ", err)
+	}
+}
+
+func (w *whatsAppService) downloadMessageMedia(instance *whatsapp.Instance, message *model.Message) error {
+	mediaType, ok := whatsapp.ParseMediaType(message.MediaType)
+	if !ok {
+		return errors.New("unknown media type")
+	}
+
+	data, err := w.whatsApp.DownloadMedia(instance, mediaType, whatsapp.MediaInfo{
+		DirectPath:    message.MediaDirectPath,
+		MediaKey:      message.MediaKey,
+		FileSHA256:    message.MediaFileSHA256,
+		FileEncSHA256: message.MediaFileEncSHA256,
+		FileLength:    message.MediaFileLength,
+	})
+	if err != nil {
+		return err
+	}
+
+	blob, err := w.mediaService.SaveMedia(instance.ID, data, message.MediaMimetype)
+	if err != nil {
+		return err
+	}
+	return w.messageService.SetMessageMedia(message, blob)
+}
+
+// handleConnectionLost records why a paired instance lost its connection. The
+// connection supervisor reconnects it, unless it's a conflict.
+func (w *whatsAppService) handleConnectionLost(instanceID string, state string, reason string) {
+	instance := w.app.LoadInstance(instanceID)
+	if instance == nil || instance.Client.Store.ID == nil {
+		return
+	}
+	w.RecordConnectionState(instanceID, state, reason, 0)
+}
+
+// handleKeepAliveTimeout drops connections whose keepalives kept failing, as
+// they won't recover on their own.
+func (w *whatsAppService) handleKeepAliveTimeout(instanceID string, evt *events.KeepAliveTimeout) {
+	if time.Since(evt.LastSuccess) <= whatsmeow.KeepAliveMaxFailTime {
+		return
+	}
+
+	instance := w.app.LoadInstance(instanceID)
+	if instance == nil || instance.Client.Store.ID == nil {
+		return
+	}
+	w.whatsApp.Disconnect(instance)
+	w.RecordConnectionState(instanceID, model.ConnectionDisconnected, "keepalive_timeout", 0)
+}
+
+func (w *whatsAppService) getMessageRangeEnd(messageRange *waProto.SyncActionMessageRange) time.Time {
+	if timestamp := messageRange.GetLastMessageTimestamp(); timestamp > 0 {
+		return time.Unix(timestamp, 0)
+	}
+	return time.Time{}
+}
+
+func (w *whatsAppService) getLastMessage(instanceID string, jid whatsapp.JID) (*whatsapp.LastMessage, error) {
+	chat, err := w.chatService.GetChat(instanceID, jid.User)
+	if err != nil || chat == nil || chat.LastMessageID == "" {
+		return nil, err
+	}
+
+	return &whatsapp.LastMessage{
+		ID:        chat.LastMessageID,
+		FromMe:    chat.LastMessageFromMe,
+		Timestamp: chat.LastMessageAt,
+	}, nil
+}
+
+func (w *whatsAppService) updateArchived(instanceID string, jid whatsapp.JID, archived bool) error {
+	columns := []string{"archived"}
+	if archived {
+		// archiving a chat also unpins it
+		columns = append(columns, "pinned")
+	}
+
+	return w.chatService.UpdateChatSettings(&model.ChatSettings{
+		InstanceID: instanceID,
+		ChatJID:    jid.User,
+		Archived:   archived,
+	}, columns...)
+}
+
+func (w *whatsAppService) updateMuted(instanceID string, jid whatsapp.JID, muted bool, mutedUntil *time.Time) error {
+	if !muted {
+		mutedUntil = nil
+	}
+
+	return w.chatService.UpdateChatSettings(&model.ChatSettings{
+		InstanceID: instanceID,
+		ChatJID:    jid.User,
+		Muted:      muted,
+		MutedUntil: mutedUntil,
+	}, "muted", "muted_until")
+}
+
+func (w *whatsAppService) updateMarkedUnread(instanceID string, jid whatsapp.JID, unread bool) error {
+	if !unread {
+		err := w.chatService.MarkChatAsRead(instanceID, jid.User)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.chatService.UpdateChatSettings(&model.ChatSettings{
+		InstanceID:   instanceID,
+		ChatJID:      jid.User,
+		MarkedUnread: unread,
+	}, "marked_unread")
+}
+
+func (w *whatsAppService) clearChat(instanceID string, jid whatsapp.JID, until time.Time) error {
+	err := w.messageService.DeleteChatMessages(instanceID, jid.User, until)
+	if err != nil {
+		return err
+	}
+	return w.chatService.ClearChat(instanceID, jid.User)
+}
+
+func (w *whatsAppService) deleteChat(instanceID string, jid whatsapp.JID, until time.Time) error {
+	err := w.messageService.DeleteChatMessages(instanceID, jid.User, until)
+	if err != nil {
+		return err
+	}
+	return w.chatService.DeleteChat(instanceID, jid.User)
+}
+
 func (w *whatsAppService) handleConnected(instanceID string) {
 	var instance = w.app.LoadInstance(instanceID)
 	err := w.accountService.UpdateAccount(instanceID, map[string]interface{}{
-		"User":       instance.Client.Store.ID.User,
-		"Agent":      instance.Client.Store.ID.Agent,
-		"Device":     instance.Client.Store.ID.Device,
-		"Server":     instance.Client.Store.ID.Server,
-		"AD":         instance.Client.Store.ID.AD,
-		"InstanceID": instance.ID,
-		"Status":     "CONNECTED",
-		"QrCode":     "",
-		"WasSynced":  false,
+		"User":        instance.Client.Store.ID.User,
+		"Agent":       instance.Client.Store.ID.RawAgent,
+		"Device":      instance.Client.Store.ID.Device,
+		"Server":      instance.Client.Store.ID.Server,
+		"InstanceID":  instance.ID,
+		"Status":      "CONNECTED",
+		"QrCode":      "",
+		"PairingCode": "",
 	})
 
 	if err != nil {
 		logger.Error("Failed to update account. ", err)
 	}
+
+	w.RecordConnectionState(instanceID, model.ConnectionConnected, "", 0)
 }
 
 func (w *whatsAppService) handleLoggedOut(instanceID string) {
@@ -311,37 +1256,55 @@ func (w *whatsAppService) handleMessage(instanceId string, evt *events.Message)
 		MessageID:  parsedEventMessage.MessageID,
 		Timestamp:  parsedEventMessage.Timestamp,
 		Body:       parsedEventMessage.Body,
+		Caption:    parsedEventMessage.Caption,
+		Filename:   parsedEventMessage.Filename,
 		FromMe:     parsedEventMessage.FromMe,
 	}
 
 	if parsedEventMessage.MediaType != nil {
-		path, err := helper.SaveMedia(
+		message.MediaType = parsedEventMessage.MediaType.String()
+		message.MediaMimetype = *parsedEventMessage.Mimetype
+		helper.SetMessageMediaInfo(&message, parsedEventMessage.MediaInfo)
+	}
+
+	if parsedEventMessage.Media != nil {
+		blob, err := w.mediaService.SaveMedia(
 			instance.ID,
-			parsedEventMessage.MessageID,
 			*parsedEventMessage.Media,
 			*parsedEventMessage.Mimetype,
 		)
 
 		if err != nil {
 			logger.Error("Failed to save media. ", err)
+		} else {
+			message.MediaPath = blob.Path
+			message.MediaSHA256 = blob.SHA256
 		}
-
-		message.MediaType = parsedEventMessage.MediaType.String()
-		message.MediaPath = path
 	}
 
 	err = w.messageService.CreateMessage(&message)
 	if err != nil {
 		logger.Error("Failed to create message. ", err)
+		// the blob reference taken for the message isn't used by any row
+		if err := w.mediaService.ReleaseMedia([]model.Message{message}); err != nil {
+			logger.Error("Failed to release media. ", err)
+		}
 		return
 	}
 
+	if evt.Info.Chat.Server != types.BroadcastServer {
+		err = w.chatService.RecordMessage(&message, evt.Info.IsGroup)
+		if err != nil {
+			logger.Error("Failed to update chat. ", err)
+		}
+	}
+
 	body := map[string]interface{}{
 		"instanceId": instanceId,
 		"message":    response.NewMessageResponse(message),
 	}
 
-	err = http.Request(w.app.Config.WebhookURL, body)
+	err = http.Request(w.accountService.GetWebhookURL(instanceId), body)
 	if err != nil {
 		logger.Error("Failed to send webhook request. ", err)
 	}
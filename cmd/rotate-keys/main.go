@@ -0,0 +1,45 @@
+// Command rotate-keys rewraps the per-instance data keys with a new master
+// key. Stop the server first, then run it with the current key in
+// ENCRYPTION_KEY and the new one in NEW_ENCRYPTION_KEY, and finally set
+// ENCRYPTION_KEY to the new key before starting the server again.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"zapmeow/api/helper"
+	"zapmeow/config"
+	"zapmeow/pkg/encryption"
+	"zapmeow/pkg/logger"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatal("Error loading dotfile. ", err)
+	}
+
+	cfg := config.Load()
+	logger.Init()
+	if len(cfg.EncryptionKey) == 0 {
+		logger.Fatal("ENCRYPTION_KEY isn't set, there are no keys to rotate")
+	}
+
+	newKey, err := config.ParseEncryptionKey(os.Getenv("NEW_ENCRYPTION_KEY"))
+	if err != nil {
+		logger.Fatal("Invalid NEW_ENCRYPTION_KEY. ", err)
+	}
+	if len(newKey) == 0 {
+		logger.Fatal("NEW_ENCRYPTION_KEY isn't set")
+	}
+
+	keyring := encryption.NewKeyring(cfg.EncryptionKey, helper.MakeKeysPath())
+	rotated, err := keyring.Rotate(newKey)
+	if err != nil {
+		logger.Fatal("Error rotating keys after ", rotated, " data keys. ", err)
+	}
+
+	fmt.Printf("Rewrapped %d data keys. Set ENCRYPTION_KEY to the new key before starting the server.\n", rotated)
+}
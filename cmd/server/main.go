@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
+	"zapmeow/api/helper"
 	"zapmeow/api/model"
 	"zapmeow/api/repository"
 	"zapmeow/api/route"
 	"zapmeow/api/service"
 	"zapmeow/config"
 	"zapmeow/docs"
+	"zapmeow/pkg/cluster"
 	"zapmeow/pkg/database"
 	"zapmeow/pkg/logger"
 	"zapmeow/pkg/queue"
@@ -25,6 +33,12 @@ import (
 // @description	API to handle multiple WhatsApp instances
 // @host			localhost:8900
 // @BasePath		/api
+// @security		ApiKeyAuth
+//
+// @securityDefinitions.apikey	ApiKeyAuth
+// @in							header
+// @name						X-API-Key
+// @description				Master key set in API_KEY, or an API token of the instance
 func main() {
 	docs.SwaggerInfo.BasePath = "/api"
 
@@ -40,19 +54,33 @@ func main() {
 
 	logger.Init()
 
+	if cfg.ApiKey == "" {
+		logger.Info("API_KEY is empty, the API is served without authentication")
+	}
+
 	var instances sync.Map // whatsmeow instances
 	var mutex sync.Mutex
 	var wg sync.WaitGroup
-	wg.Add(1)
 	stopCh := make(chan struct{})
 
 	whatsApp := whatsapp.NewWhatsApp(cfg.DatabaseURL)
-	queue := queue.NewQueue(cfg.RedisAddr, cfg.RedisPassword)
+	queue := makeQueue(cfg)
+	cluster := makeCluster(cfg)
 
 	database := database.NewDatabase(cfg.DatabaseURL)
 	err = database.RunMigrate(
 		&model.Account{},
 		&model.Message{},
+		&model.Chat{},
+		&model.ChatSettings{},
+		&model.RetentionPolicy{},
+		&model.MediaBlob{},
+		&model.HistorySyncProgress{},
+		&model.SyncSettings{},
+		&model.Contact{},
+		&model.ApiToken{},
+		&model.RateLimits{},
+		&model.SendJob{},
 	)
 	if err != nil {
 		logger.Fatal("Error when running gorm automigrate. ", err)
@@ -61,6 +89,7 @@ func main() {
 	app := zapmeow.NewZapMeow(
 		database,
 		queue,
+		cluster,
 		cfg,
 		&instances,
 		&wg,
@@ -70,23 +99,87 @@ func main() {
 
 	// repository
 	messageRepo := repository.NewMessageRepository(app.Database)
+	if err := messageRepo.SetupSearchIndex(); err != nil {
+		logger.Error("Full-text search index unavailable, falling back to LIKE search. ", err)
+	}
 	accountRepo := repository.NewAccountRepository(app.Database)
+	chatRepo := repository.NewChatRepository(app.Database)
+	retentionPolicyRepo := repository.NewRetentionPolicyRepository(app.Database)
+	mediaBlobRepo := repository.NewMediaBlobRepository(app.Database)
+	historySyncProgressRepo := repository.NewHistorySyncProgressRepository(app.Database)
+	syncSettingsRepo := repository.NewSyncSettingsRepository(app.Database)
+	contactRepo := repository.NewContactRepository(app.Database)
+	apiTokenRepo := repository.NewApiTokenRepository(app.Database)
+	rateLimitsRepo := repository.NewRateLimitsRepository(app.Database)
+	sendJobRepo := repository.NewSendJobRepository(app.Database)
 
 	// service
-	messageService := service.NewMessageService(messageRepo)
-	accountService := service.NewAccountService(accountRepo, messageService)
+	mediaService := service.NewMediaService(mediaBlobRepo)
+	messageService := service.NewMessageService(messageRepo, mediaService)
+	chatService := service.NewChatService(chatRepo)
+	contactService := service.NewContactService(contactRepo)
+	historySyncProgressService := service.NewHistorySyncProgressService(historySyncProgressRepo)
+	accountService := service.NewAccountService(accountRepo, messageService, chatService, mediaService, contactService, historySyncProgressService, cfg.WebhookURL)
+	exportService := service.NewExportService(messageService)
+	retentionPolicyService := service.NewRetentionPolicyService(retentionPolicyRepo)
+	syncSettingsService := service.NewSyncSettingsService(syncSettingsRepo, cfg.MaxMessageSync)
+	apiTokenService := service.NewApiTokenService(apiTokenRepo)
+	rateLimitService := service.NewRateLimitService(rateLimitsRepo, model.RateLimits{
+		MessagesPerSecond: cfg.RateLimitPerSecond,
+		MessagesPerMinute: cfg.RateLimitPerMinute,
+		NewChatsPerDay:    cfg.RateLimitNewChats,
+		MinIntervalMs:     cfg.SendIntervalMinMs,
+		MaxIntervalMs:     cfg.SendIntervalMaxMs,
+	})
 	whatsAppService := service.NewWhatsAppService(
 		app,
 		messageService,
 		accountService,
+		chatService,
+		mediaService,
+		contactService,
+		rateLimitService,
 		whatsApp,
 	)
+	sendService := service.NewSendService(
+		whatsAppService,
+		messageService,
+		chatService,
+		mediaService,
+	)
+	sendJobService := service.NewSendJobService(sendJobRepo)
 
 	// workers
 	historySyncWorker := worker.NewHistorySyncWorker(
 		app,
 		messageService,
 		accountService,
+		chatService,
+		whatsAppService,
+		historySyncProgressService,
+		syncSettingsService,
+		contactService,
+	)
+	mediaRetentionWorker := worker.NewMediaRetentionWorker(
+		app,
+		messageService,
+		retentionPolicyService,
+	)
+	connectionSupervisorWorker := worker.NewConnectionSupervisorWorker(
+		app,
+		accountService,
+		whatsAppService,
+	)
+	sendJobWorker := worker.NewSendJobWorker(
+		app,
+		accountService,
+		whatsAppService,
+		sendService,
+		sendJobService,
+	)
+	clusterWorker := worker.NewClusterWorker(
+		app,
+		accountService,
 		whatsAppService,
 	)
 
@@ -95,34 +188,143 @@ func main() {
 		whatsAppService,
 		messageService,
 		accountService,
+		chatService,
+		exportService,
+		retentionPolicyService,
+		mediaService,
+		historySyncProgressService,
+		syncSettingsService,
+		apiTokenService,
+		rateLimitService,
+		sendService,
+		sendJobService,
 	)
 
-	logger.Info("Loading whatsapp instances")
-	accounts, err := accountService.GetConnectedAccounts()
-	if err != nil {
-		logger.Fatal("Error getting accounts. ", err)
+	if err := chatService.CreateChatsFromMessages(); err != nil {
+		logger.Error("Error creating chats from stored messages. ", err)
 	}
 
-	for _, account := range accounts {
-		logger.Info("Loading instance: ", account.InstanceID)
-		_, err := whatsAppService.GetInstance(account.InstanceID)
+	// in cluster mode, instances are loaded by the node they're assigned to
+	if !cfg.ClusterMode {
+		logger.Info("Loading whatsapp instances")
+		accounts, err := accountService.GetConnectedAccounts()
 		if err != nil {
-			logger.Error("Error getting instance. ", err)
+			logger.Fatal("Error getting accounts. ", err)
 		}
+
+		for _, account := range accounts {
+			logger.Info("Loading instance: ", account.InstanceID)
+			_, err := whatsAppService.GetInstance(account.InstanceID)
+			if err != nil {
+				logger.Error("Error getting instance. ", err)
+			}
+		}
+	}
+
+	server := &http.Server{
+		Addr:    cfg.Port,
+		Handler: r,
 	}
+	// workers and streaming requests stop along with the server
+	server.RegisterOnShutdown(func() {
+		close(*app.StopCh)
+	})
 
 	go func() {
 		fmt.Println("Server is running")
-		if err := r.Run(cfg.Port); err != nil {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Fatal(err)
 		}
 	}()
 
 	if cfg.HistorySync {
+		app.Wg.Add(1)
 		go historySyncWorker.ProcessQueue()
 	}
 
-	<-*app.StopCh
-	app.Wg.Wait()
-	close(*app.StopCh)
+	app.Wg.Add(1)
+	go mediaRetentionWorker.ProcessRetention()
+
+	app.Wg.Add(1)
+	go connectionSupervisorWorker.Supervise()
+
+	app.Wg.Add(1)
+	go sendJobWorker.ProcessJobs()
+
+	if cfg.ClusterMode {
+		app.Wg.Add(1)
+		go clusterWorker.Balance()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	// a second signal stops the server right away
+	stop()
+
+	logger.Info("Shutting down")
+	err = shutdown(app, server, whatsAppService)
+	if err != nil {
+		logger.Error("Shutdown timed out. ", err)
+		os.Exit(1)
+	}
+}
+
+// shutdown stops accepting requests, and waits for the requests, workers and
+// instance events in progress. Each step still runs once the shutdown timeout
+// passed, without waiting, so instances are always disconnected.
+func shutdown(app *zapmeow.ZapMeow, server *http.Server, whatsAppService service.WhatsAppService) error {
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		time.Duration(app.Config.ShutdownTimeout)*time.Second,
+	)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Error waiting for requests. ", err)
+	}
+
+	if err := helper.WaitWithContext(ctx, app.Wg); err != nil {
+		logger.Error("Error waiting for workers. ", err)
+	}
+
+	if err := whatsAppService.Shutdown(ctx); err != nil {
+		logger.Error("Error waiting for instance events. ", err)
+	}
+
+	if err := app.Cluster.Leave(); err != nil {
+		logger.Error("Error leaving cluster. ", err)
+	}
+
+	if err := app.Queue.Close(); err != nil {
+		logger.Error("Error closing queue. ", err)
+	}
+
+	if err := app.Database.Close(); err != nil {
+		logger.Error("Error closing database. ", err)
+	}
+	return ctx.Err()
+}
+
+func makeQueue(cfg config.Config) queue.Queue {
+	options := queue.Options{
+		VisibilityTimeout: time.Duration(cfg.QueueVisibilityTimeout) * time.Second,
+		MaxDeliveries:     cfg.QueueMaxDeliveries,
+	}
+	if cfg.QueueDriver == config.MemoryQueue {
+		return queue.NewMemoryQueue(cfg.QueuePath, options)
+	}
+	return queue.NewQueue(cfg.RedisAddr, cfg.RedisPassword, options)
+}
+
+func makeCluster(cfg config.Config) cluster.Cluster {
+	if !cfg.ClusterMode {
+		return cluster.NewLocalCluster()
+	}
+
+	node := cluster.Node{
+		ID:   cfg.ClusterNodeID,
+		Addr: cfg.ClusterNodeAddr,
+	}
+	leaseTTL := time.Duration(cfg.ClusterLeaseTTL) * time.Second
+	return cluster.NewCluster(cfg.RedisAddr, cfg.RedisPassword, node, leaseTTL)
 }
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
@@ -8,22 +11,64 @@ import (
 
 type Environment = uint
 
+type QueueDriver = string
+
+const (
+	RedisQueue  QueueDriver = "redis"
+	MemoryQueue QueueDriver = "memory"
+)
+
 const (
 	Development Environment = iota
 	Production
 )
 
 type Config struct {
-	Environment          Environment
-	StoragePath          string
-	WebhookURL           string
-	DatabaseURL          string
-	RedisAddr            string
-	RedisPassword        string
-	Port                 string
-	HistorySyncQueueName string
-	HistorySync          bool
-	MaxMessageSync       int
+	Environment            Environment
+	StoragePath            string
+	WebhookURL             string
+	DatabaseURL            string
+	RedisAddr              string
+	RedisPassword          string
+	Port                   string
+	HistorySyncQueueName   string
+	HistorySync            bool
+	HistorySyncWorkers     int
+	MaxMessageSync         int
+	MediaRetentionInterval int
+	EncryptionKey          []byte
+	QueueDriver            QueueDriver
+	QueuePath              string
+	// QueueVisibilityTimeout is the number of seconds a dequeued job stays
+	// reserved before it's delivered again
+	QueueVisibilityTimeout int
+	QueueMaxDeliveries     int
+	// ShutdownTimeout is the number of seconds given to requests, workers
+	// and instances to finish once the server is asked to stop
+	ShutdownTimeout int
+	ClusterMode     bool
+	ClusterNodeID   string
+	// ClusterNodeAddr is the base URL other nodes proxy requests to
+	ClusterNodeAddr string
+	// ClusterLeaseTTL is the number of seconds an instance stays assigned
+	// to a node that stopped renewing its lease
+	ClusterLeaseTTL int
+	// DeviceName, DevicePlatform and DeviceBrowserLabel are how instances
+	// show up in the linked devices of the phone, unless they set their own
+	DeviceName         string
+	DevicePlatform     string
+	DeviceBrowserLabel string
+	// ApiKey is the master key of the API. Authentication is disabled when
+	// it's empty
+	ApiKey string
+	// RateLimitPerSecond, RateLimitPerMinute, RateLimitNewChats (per day),
+	// SendIntervalMinMs and SendIntervalMaxMs are the rate limits of
+	// instances without their own. Zero disables a limit
+	RateLimitPerSecond int
+	RateLimitPerMinute int
+	RateLimitNewChats  int
+	SendIntervalMinMs  int
+	SendIntervalMaxMs  int
 }
 
 func Load() Config {
@@ -35,29 +80,175 @@ func Load() Config {
 	portEnv := os.Getenv("PORT")
 	historySyncEnv := os.Getenv("HISTORY_SYNC")
 	maxMessageSyncEnv := os.Getenv("MAX_MESSAGE_SYNC")
+	historySyncWorkersEnv := os.Getenv("HISTORY_SYNC_WORKERS")
+	mediaRetentionIntervalEnv := os.Getenv("MEDIA_RETENTION_INTERVAL")
+	encryptionKeyEnv := os.Getenv("ENCRYPTION_KEY")
+	queuePathEnv := os.Getenv("QUEUE_PATH")
+	queueVisibilityTimeoutEnv := os.Getenv("QUEUE_VISIBILITY_TIMEOUT")
+	queueMaxDeliveriesEnv := os.Getenv("QUEUE_MAX_DELIVERIES")
+	shutdownTimeoutEnv := os.Getenv("SHUTDOWN_TIMEOUT")
+	clusterModeEnv := os.Getenv("CLUSTER_MODE")
+	clusterNodeIDEnv := os.Getenv("CLUSTER_NODE_ID")
+	clusterNodeAddrEnv := os.Getenv("CLUSTER_NODE_ADDR")
+	clusterLeaseTTLEnv := os.Getenv("CLUSTER_LEASE_TTL")
+	deviceNameEnv := os.Getenv("DEVICE_NAME")
+	devicePlatformEnv := os.Getenv("DEVICE_PLATFORM")
+	deviceBrowserLabelEnv := os.Getenv("DEVICE_BROWSER_LABEL")
+	apiKeyEnv := os.Getenv("API_KEY")
+	rateLimitPerSecondEnv := os.Getenv("RATE_LIMIT_PER_SECOND")
+	rateLimitPerMinuteEnv := os.Getenv("RATE_LIMIT_PER_MINUTE")
+	rateLimitNewChatsPerDayEnv := os.Getenv("RATE_LIMIT_NEW_CHATS_PER_DAY")
+	sendIntervalMinMsEnv := os.Getenv("SEND_INTERVAL_MIN_MS")
+	sendIntervalMaxMsEnv := os.Getenv("SEND_INTERVAL_MAX_MS")
 	environment := getEnvironment()
 
 	maxMessageSync, err := strconv.Atoi(maxMessageSyncEnv)
-	if err != nil {
+	if err != nil || maxMessageSync < 0 {
 		maxMessageSync = 10
 	}
 
+	historySyncWorkers, err := strconv.Atoi(historySyncWorkersEnv)
+	if err != nil || historySyncWorkers <= 0 {
+		historySyncWorkers = 4
+	}
+
+	mediaRetentionInterval, err := strconv.Atoi(mediaRetentionIntervalEnv)
+	if err != nil || mediaRetentionInterval <= 0 {
+		mediaRetentionInterval = 60
+	}
+
+	queueVisibilityTimeout, err := strconv.Atoi(queueVisibilityTimeoutEnv)
+	if err != nil || queueVisibilityTimeout <= 0 {
+		queueVisibilityTimeout = 600
+	}
+
+	queueMaxDeliveries, err := strconv.Atoi(queueMaxDeliveriesEnv)
+	if err != nil || queueMaxDeliveries <= 0 {
+		queueMaxDeliveries = 5
+	}
+
+	shutdownTimeout, err := strconv.Atoi(shutdownTimeoutEnv)
+	if err != nil || shutdownTimeout <= 0 {
+		shutdownTimeout = 30
+	}
+
+	clusterLeaseTTL, err := strconv.Atoi(clusterLeaseTTLEnv)
+	if err != nil || clusterLeaseTTL <= 0 {
+		clusterLeaseTTL = 45
+	}
+
+	rateLimitPerSecond, err := strconv.Atoi(rateLimitPerSecondEnv)
+	if err != nil || rateLimitPerSecond < 0 {
+		rateLimitPerSecond = 0
+	}
+
+	rateLimitPerMinute, err := strconv.Atoi(rateLimitPerMinuteEnv)
+	if err != nil || rateLimitPerMinute < 0 {
+		rateLimitPerMinute = 0
+	}
+
+	rateLimitNewChatsPerDay, err := strconv.Atoi(rateLimitNewChatsPerDayEnv)
+	if err != nil || rateLimitNewChatsPerDay < 0 {
+		rateLimitNewChatsPerDay = 0
+	}
+
+	sendIntervalMinMs, err := strconv.Atoi(sendIntervalMinMsEnv)
+	if err != nil || sendIntervalMinMs < 0 {
+		sendIntervalMinMs = 0
+	}
+
+	sendIntervalMaxMs, err := strconv.Atoi(sendIntervalMaxMsEnv)
+	if err != nil || sendIntervalMaxMs < sendIntervalMinMs {
+		sendIntervalMaxMs = sendIntervalMinMs
+	}
+
 	historySync, err := strconv.ParseBool(historySyncEnv)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	encryptionKey, err := ParseEncryptionKey(encryptionKeyEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	queueDriver, err := getQueueDriver()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clusterMode := false
+	if clusterModeEnv != "" {
+		clusterMode, err = strconv.ParseBool(clusterModeEnv)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if clusterNodeIDEnv == "" {
+		hostname, _ := os.Hostname()
+		clusterNodeIDEnv = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	if clusterMode && clusterNodeAddrEnv == "" {
+		log.Fatal("CLUSTER_NODE_ADDR is required in cluster mode")
+	}
+
+	if deviceNameEnv == "" {
+		deviceNameEnv = "whatsmeow"
+	}
+
+	if devicePlatformEnv == "" {
+		devicePlatformEnv = "UNKNOWN"
+	}
+
+	if deviceBrowserLabelEnv == "" {
+		deviceBrowserLabelEnv = "Chrome (Linux)"
+	}
+
 	return Config{
-		Environment:          environment,
-		StoragePath:          storagePathEnv,
-		WebhookURL:           webhookURLEnv,
-		DatabaseURL:          databaseURLEnv,
-		RedisAddr:            redisAddrEnv,
-		RedisPassword:        redisPasswordEnv,
-		Port:                 portEnv,
-		HistorySyncQueueName: "queue:history-sync",
-		HistorySync:          historySync,
-		MaxMessageSync:       maxMessageSync,
+		Environment:            environment,
+		StoragePath:            storagePathEnv,
+		WebhookURL:             webhookURLEnv,
+		DatabaseURL:            databaseURLEnv,
+		RedisAddr:              redisAddrEnv,
+		RedisPassword:          redisPasswordEnv,
+		Port:                   portEnv,
+		HistorySyncQueueName:   "queue:history-sync",
+		HistorySync:            historySync,
+		HistorySyncWorkers:     historySyncWorkers,
+		MaxMessageSync:         maxMessageSync,
+		MediaRetentionInterval: mediaRetentionInterval,
+		EncryptionKey:          encryptionKey,
+		QueueDriver:            queueDriver,
+		QueuePath:              queuePathEnv,
+		QueueVisibilityTimeout: queueVisibilityTimeout,
+		QueueMaxDeliveries:     queueMaxDeliveries,
+		ShutdownTimeout:        shutdownTimeout,
+		ClusterMode:            clusterMode,
+		ClusterNodeID:          clusterNodeIDEnv,
+		ClusterNodeAddr:        clusterNodeAddrEnv,
+		ClusterLeaseTTL:        clusterLeaseTTL,
+		DeviceName:             deviceNameEnv,
+		DevicePlatform:         devicePlatformEnv,
+		DeviceBrowserLabel:     deviceBrowserLabelEnv,
+		ApiKey:                 apiKeyEnv,
+		RateLimitPerSecond:     rateLimitPerSecond,
+		RateLimitPerMinute:     rateLimitPerMinute,
+		RateLimitNewChats:      rateLimitNewChatsPerDay,
+		SendIntervalMinMs:      sendIntervalMinMs,
+		SendIntervalMaxMs:      sendIntervalMaxMs,
+	}
+}
+
+func getQueueDriver() (QueueDriver, error) {
+	switch driver := os.Getenv("QUEUE_DRIVER"); driver {
+	case "", RedisQueue:
+		return RedisQueue, nil
+	case MemoryQueue:
+		return MemoryQueue, nil
+	default:
+		return "", fmt.Errorf("unknown queue driver: %s", driver)
 	}
 }
 
@@ -68,3 +259,17 @@ func getEnvironment() Environment {
 	}
 	return Development
 }
+
+// ParseEncryptionKey decodes a base64 encoded 32-byte key. An empty value
+// disables encryption at rest.
+func ParseEncryptionKey(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes encoded in base64")
+	}
+	return key, nil
+}
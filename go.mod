@@ -6,11 +6,12 @@ require (
 	github.com/gin-gonic/gin v1.9.1
 	github.com/joho/godotenv v1.5.1
 	github.com/sirupsen/logrus v1.9.3
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/swaggo/files v1.0.1
 	github.com/swaggo/gin-swagger v1.6.0
 	github.com/swaggo/swag v1.16.2
 	github.com/vincent-petithory/dataurl v1.0.0
-	go.mau.fi/whatsmeow v0.0.0-20230628230045-73f143bc9874
+	go.mau.fi/whatsmeow v0.0.0-20230916142552-a743fdc23bf1
 	google.golang.org/protobuf v1.31.0
 	gorm.io/driver/sqlite v1.5.3
 	gorm.io/gorm v1.25.3
@@ -32,6 +33,7 @@ require (
 	github.com/onsi/ginkgo v1.16.5 // indirect
 	github.com/onsi/gomega v1.27.10 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
+	go.mau.fi/util v0.1.0 // indirect
 	golang.org/x/tools v0.12.0 // indirect
 )
 
@@ -58,7 +60,7 @@ require (
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	go.mau.fi/libsignal v0.1.0 // indirect
 	golang.org/x/arch v0.5.0 // indirect
-	golang.org/x/crypto v0.12.0 // indirect
+	golang.org/x/crypto v0.13.0 // indirect
 	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"hash/fnv"
+)
+
+// Cluster assigns instances to the nodes running zapmeow. A node holds the
+// lease of every instance it loaded, so two nodes never connect the same
+// instance, and renews them while it's alive.
+type Cluster interface {
+	NodeID() string
+	// Heartbeat registers the node, which is considered gone when it
+	// doesn't heartbeat within the lease TTL.
+	Heartbeat() error
+	// Leave removes the node, so instances are assigned to the others.
+	Leave() error
+	Nodes() ([]Node, error)
+	// Acquire takes the lease of the instance, or renews it when the node
+	// already holds it. It returns false when another node holds it.
+	Acquire(instanceID string) (bool, error)
+	// Renew extends the lease of the instance, returning false when the
+	// node lost it.
+	Renew(instanceID string) (bool, error)
+	Release(instanceID string) error
+	// Owner returns the node holding the lease of the instance, or the node
+	// it's assigned to when no node holds it.
+	Owner(instanceID string) (*Node, error)
+}
+
+// Node is a zapmeow node, reachable at Addr by the other nodes.
+type Node struct {
+	ID   string
+	Addr string
+}
+
+// Assign picks the node of the instance by rendezvous hashing, so only the
+// instances of a node that joined or left move to another node.
+func Assign(nodes []Node, instanceID string) *Node {
+	var assigned *Node
+	var highest uint64
+	for i := range nodes {
+		hash := fnv.New64a()
+		hash.Write([]byte(nodes[i].ID))
+		hash.Write([]byte{0})
+		hash.Write([]byte(instanceID))
+
+		if score := mix(hash.Sum64()); assigned == nil || score > highest {
+			assigned = &nodes[i]
+			highest = score
+		}
+	}
+	return assigned
+}
+
+// mix spreads the bits of an FNV hash, whose high bits barely change between
+// IDs that only differ in their last characters.
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
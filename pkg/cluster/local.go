@@ -0,0 +1,43 @@
+package cluster
+
+// localCluster is a single node owning every instance, used when cluster mode
+// is disabled.
+type localCluster struct {
+	node Node
+}
+
+func NewLocalCluster() *localCluster {
+	return &localCluster{node: Node{ID: "local"}}
+}
+
+func (c *localCluster) NodeID() string {
+	return c.node.ID
+}
+
+func (c *localCluster) Heartbeat() error {
+	return nil
+}
+
+func (c *localCluster) Leave() error {
+	return nil
+}
+
+func (c *localCluster) Nodes() ([]Node, error) {
+	return []Node{c.node}, nil
+}
+
+func (c *localCluster) Acquire(instanceID string) (bool, error) {
+	return true, nil
+}
+
+func (c *localCluster) Renew(instanceID string) (bool, error) {
+	return true, nil
+}
+
+func (c *localCluster) Release(instanceID string) error {
+	return nil
+}
+
+func (c *localCluster) Owner(instanceID string) (*Node, error) {
+	return &c.node, nil
+}
@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"zapmeow/pkg/logger"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	nodeKeyPrefix  = "cluster:node:"
+	leaseKeyPrefix = "cluster:lease:"
+)
+
+// acquireScript sets the lease when it's free, or extends it when the node
+// already holds it.
+var acquireScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// cluster keeps nodes and leases in Redis, as keys that expire after the
+// lease TTL unless they're renewed.
+type cluster struct {
+	client   *redis.Client
+	node     Node
+	leaseTTL time.Duration
+}
+
+func NewCluster(addr string, password string, node Node, leaseTTL time.Duration) *cluster {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	})
+	if _, err := client.Ping().Result(); err != nil {
+		logger.Fatal(err)
+	}
+
+	return &cluster{
+		client:   client,
+		node:     node,
+		leaseTTL: leaseTTL,
+	}
+}
+
+func (c *cluster) NodeID() string {
+	return c.node.ID
+}
+
+func (c *cluster) Heartbeat() error {
+	return c.client.Set(nodeKeyPrefix+c.node.ID, c.node.Addr, c.leaseTTL).Err()
+}
+
+func (c *cluster) Leave() error {
+	return c.client.Del(nodeKeyPrefix + c.node.ID).Err()
+}
+
+func (c *cluster) Nodes() ([]Node, error) {
+	var keys []string
+	iter := c.client.Scan(0, nodeKeyPrefix+"*", 100).Iterator()
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	addrs, err := c.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []Node
+	for i, key := range keys {
+		// the node expired after it was scanned
+		addr, ok := addrs[i].(string)
+		if !ok {
+			continue
+		}
+		nodes = append(nodes, Node{
+			ID:   strings.TrimPrefix(key, nodeKeyPrefix),
+			Addr: addr,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes, nil
+}
+
+func (c *cluster) Acquire(instanceID string) (bool, error) {
+	return c.runLeaseScript(acquireScript, instanceID)
+}
+
+func (c *cluster) Renew(instanceID string) (bool, error) {
+	return c.runLeaseScript(renewScript, instanceID)
+}
+
+func (c *cluster) Release(instanceID string) error {
+	return releaseScript.Run(c.client, []string{leaseKeyPrefix + instanceID}, c.node.ID).Err()
+}
+
+func (c *cluster) Owner(instanceID string) (*Node, error) {
+	owner, err := c.client.Get(leaseKeyPrefix + instanceID).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if err == redis.Nil {
+		nodes, err := c.Nodes()
+		if err != nil {
+			return nil, err
+		}
+		return Assign(nodes, instanceID), nil
+	}
+
+	if owner == c.node.ID {
+		return &c.node, nil
+	}
+
+	// the address is empty when the owner is gone and its lease didn't
+	// expire yet
+	addr, err := c.client.Get(nodeKeyPrefix + owner).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	return &Node{ID: owner, Addr: addr}, nil
+}
+
+func (c *cluster) runLeaseScript(script *redis.Script, instanceID string) (bool, error) {
+	result, err := script.Run(
+		c.client,
+		[]string{leaseKeyPrefix + instanceID},
+		c.node.ID,
+		c.leaseTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
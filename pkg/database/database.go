@@ -11,6 +11,7 @@ import (
 type Database interface {
 	RunMigrate(dst ...interface{}) error
 	Client() *gorm.DB
+	Close() error
 }
 
 type database struct {
@@ -37,3 +38,11 @@ func (d *database) RunMigrate(dst ...interface{}) error {
 func (d *database) Client() *gorm.DB {
 	return d.client
 }
+
+func (d *database) Close() error {
+	db, err := d.client.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,57 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// KeySize is the size of master and data keys, for AES-256.
+const KeySize = 32
+
+// StringPrefix marks encrypted database values, so rows written before
+// encryption was enabled are still read as plaintext.
+const StringPrefix = "enc:v1:"
+
+// fileMagic marks encrypted files for the same reason.
+var fileMagic = []byte("ZMENC\x01")
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Seal encrypts plaintext with AES-GCM, prepending the random nonce.
+func Seal(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts data sealed by Seal.
+func Open(key []byte, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
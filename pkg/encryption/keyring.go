@@ -0,0 +1,226 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrNoMasterKey = errors.New("data is encrypted but no encryption key is configured")
+
+// Keyring does envelope encryption: every instance has its own data key,
+// stored on disk wrapped by the master key, so rotating the master key only
+// rewraps the data keys. Without a master key, data is stored as is.
+type Keyring struct {
+	masterKey []byte
+	path      string
+	mutex     sync.Mutex
+	dataKeys  map[string][]byte
+}
+
+func NewKeyring(masterKey []byte, path string) *Keyring {
+	return &Keyring{
+		masterKey: masterKey,
+		path:      path,
+		dataKeys:  make(map[string][]byte),
+	}
+}
+
+func (k *Keyring) Enabled() bool {
+	return len(k.masterKey) > 0
+}
+
+func (k *Keyring) Encrypt(instanceID string, plaintext []byte) ([]byte, error) {
+	if !k.Enabled() {
+		return plaintext, nil
+	}
+
+	dataKey, err := k.getDataKey(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := Seal(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, fileMagic...), sealed...), nil
+}
+
+// Decrypt opens data written by Encrypt and returns anything else as is.
+func (k *Keyring) Decrypt(instanceID string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, fileMagic) {
+		return data, nil
+	}
+
+	dataKey, err := k.getDataKey(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	return Open(dataKey, data[len(fileMagic):])
+}
+
+func (k *Keyring) EncryptString(instanceID string, plaintext string) (string, error) {
+	if !k.Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+
+	dataKey, err := k.getDataKey(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := Seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return StringPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString opens values written by EncryptString and returns anything
+// else as is.
+func (k *Keyring) DecryptString(instanceID string, value string) (string, error) {
+	if !strings.HasPrefix(value, StringPrefix) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, StringPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := k.getDataKey(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := Open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rotate rewraps every data key with newMasterKey. Keys already wrapped by
+// it are skipped, so an interrupted rotation can be run again. The server
+// must be stopped, or data keys it creates meanwhile would use the old key.
+func (k *Keyring) Rotate(newMasterKey []byte) (int, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(k.path, "*.key"))
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, file := range files {
+		wrapped, err := os.ReadFile(file)
+		if err != nil {
+			return rotated, err
+		}
+
+		if _, err := Open(newMasterKey, wrapped); err == nil {
+			continue
+		}
+
+		dataKey, err := Open(k.masterKey, wrapped)
+		if err != nil {
+			return rotated, err
+		}
+
+		wrapped, err = Seal(newMasterKey, dataKey)
+		if err != nil {
+			return rotated, err
+		}
+
+		if err := k.writeFile(file, wrapped); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+
+	k.masterKey = newMasterKey
+	return rotated, nil
+}
+
+// getDataKey unwraps the data key of the instance, creating it on first use.
+func (k *Keyring) getDataKey(instanceID string) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if dataKey, ok := k.dataKeys[instanceID]; ok {
+		return dataKey, nil
+	}
+
+	if !k.Enabled() {
+		return nil, ErrNoMasterKey
+	}
+
+	file := k.makeKeyPath(instanceID)
+	wrapped, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var dataKey []byte
+	if err == nil {
+		dataKey, err = Open(k.masterKey, wrapped)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dataKey = make([]byte, KeySize)
+		if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+			return nil, err
+		}
+
+		wrapped, err = Seal(k.masterKey, dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.writeFile(file, wrapped); err != nil {
+			return nil, err
+		}
+	}
+
+	k.dataKeys[instanceID] = dataKey
+	return dataKey, nil
+}
+
+// makeKeyPath hashes the instance ID, which comes from request paths, so it
+// can't reach outside the keys directory.
+func (k *Keyring) makeKeyPath(instanceID string) string {
+	sum := sha256.Sum256([]byte(instanceID))
+	return filepath.Join(k.path, hex.EncodeToString(sum[:])+".key")
+}
+
+func (k *Keyring) writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
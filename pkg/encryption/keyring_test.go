@@ -0,0 +1,299 @@
+package encryption_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"zapmeow/pkg/encryption"
+)
+
+var (
+	masterKey    = bytes.Repeat([]byte{1}, encryption.KeySize)
+	newMasterKey = bytes.Repeat([]byte{2}, encryption.KeySize)
+
+	// errAny matches any error in the test tables
+	errAny = errors.New("any error")
+)
+
+func TestSealOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		plaintext []byte
+		openKey   []byte
+		tamper    func(sealed []byte) []byte
+		wantErr   bool
+	}{
+		{
+			name:      "round trip",
+			plaintext: []byte("hello"),
+			openKey:   masterKey,
+		},
+		{
+			name:      "empty plaintext",
+			plaintext: []byte{},
+			openKey:   masterKey,
+		},
+		{
+			name:      "wrong key",
+			plaintext: []byte("hello"),
+			openKey:   newMasterKey,
+			wantErr:   true,
+		},
+		{
+			name:      "tampered ciphertext",
+			plaintext: []byte("hello"),
+			openKey:   masterKey,
+			tamper: func(sealed []byte) []byte {
+				sealed[len(sealed)-1] ^= 1
+				return sealed
+			},
+			wantErr: true,
+		},
+		{
+			name:      "truncated ciphertext",
+			plaintext: []byte("hello"),
+			openKey:   masterKey,
+			tamper: func(sealed []byte) []byte {
+				return sealed[:10]
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := encryption.Seal(masterKey, tt.plaintext)
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			if tt.tamper != nil {
+				sealed = tt.tamper(sealed)
+			}
+
+			opened, err := encryption.Open(tt.openKey, sealed)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Open: expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(opened, tt.plaintext) {
+				t.Errorf("got %q, want %q", opened, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestKeyringStrings(t *testing.T) {
+	tests := []struct {
+		name      string
+		masterKey []byte
+		plaintext string
+		// encrypted tells whether the stored value is expected to be
+		// encrypted, with the enc:v1: prefix
+		encrypted bool
+	}{
+		{
+			name:      "encrypted",
+			masterKey: masterKey,
+			plaintext: "hello",
+			encrypted: true,
+		},
+		{
+			name:      "prefix in plaintext",
+			masterKey: masterKey,
+			plaintext: encryption.StringPrefix + "hello",
+			encrypted: true,
+		},
+		{
+			name:      "empty value",
+			masterKey: masterKey,
+			plaintext: "",
+		},
+		{
+			name:      "disabled",
+			plaintext: "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := encryption.NewKeyring(tt.masterKey, t.TempDir())
+
+			stored, err := keyring.EncryptString("instance", tt.plaintext)
+			if err != nil {
+				t.Fatalf("EncryptString: %v", err)
+			}
+			if got := strings.HasPrefix(stored, encryption.StringPrefix) && stored != tt.plaintext; got != tt.encrypted {
+				t.Errorf("got stored value %q, want encrypted %v", stored, tt.encrypted)
+			}
+
+			decrypted, err := keyring.DecryptString("instance", stored)
+			if err != nil {
+				t.Fatalf("DecryptString: %v", err)
+			}
+			if decrypted != tt.plaintext {
+				t.Errorf("got %q, want %q", decrypted, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestKeyringDecryptString(t *testing.T) {
+	path := t.TempDir()
+	encrypted, err := encryption.NewKeyring(masterKey, path).EncryptString("instance", "hello")
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		masterKey  []byte
+		instanceID string
+		value      string
+		want       string
+		wantErr    error
+	}{
+		{
+			name:       "new keyring reads the stored data key",
+			masterKey:  masterKey,
+			instanceID: "instance",
+			value:      encrypted,
+			want:       "hello",
+		},
+		{
+			name:       "plaintext is returned as is",
+			masterKey:  masterKey,
+			instanceID: "instance",
+			value:      "hello",
+			want:       "hello",
+		},
+		{
+			name:       "plaintext is returned as is when disabled",
+			instanceID: "instance",
+			value:      "hello",
+			want:       "hello",
+		},
+		{
+			name:       "encrypted value without a master key",
+			instanceID: "instance",
+			value:      encrypted,
+			wantErr:    encryption.ErrNoMasterKey,
+		},
+		{
+			name:       "data key of another instance",
+			masterKey:  masterKey,
+			instanceID: "other",
+			value:      encrypted,
+			wantErr:    errAny,
+		},
+		{
+			name:       "invalid base64",
+			masterKey:  masterKey,
+			instanceID: "instance",
+			value:      encryption.StringPrefix + "!",
+			wantErr:    errAny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := encryption.NewKeyring(tt.masterKey, path)
+
+			decrypted, err := keyring.DecryptString(tt.instanceID, tt.value)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if tt.wantErr != errAny && !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecryptString: %v", err)
+			}
+			if decrypted != tt.want {
+				t.Errorf("got %q, want %q", decrypted, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		masterKey []byte
+		data      []byte
+		encrypted bool
+	}{
+		{
+			name:      "encrypted",
+			masterKey: masterKey,
+			data:      []byte("file contents"),
+			encrypted: true,
+		},
+		{
+			name: "disabled",
+			data: []byte("file contents"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := encryption.NewKeyring(tt.masterKey, t.TempDir())
+
+			stored, err := keyring.Encrypt("instance", tt.data)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if got := !bytes.Equal(stored, tt.data); got != tt.encrypted {
+				t.Errorf("got encrypted %v, want %v", got, tt.encrypted)
+			}
+
+			decrypted, err := keyring.Decrypt("instance", stored)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if !bytes.Equal(decrypted, tt.data) {
+				t.Errorf("got %q, want %q", decrypted, tt.data)
+			}
+		})
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	path := t.TempDir()
+	keyring := encryption.NewKeyring(masterKey, path)
+
+	encrypted, err := keyring.EncryptString("instance", "hello")
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+
+	for _, want := range []int{1, 0} {
+		rotated, err := keyring.Rotate(newMasterKey)
+		if err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+		if rotated != want {
+			t.Errorf("got %d rotated keys, want %d", rotated, want)
+		}
+	}
+
+	decrypted, err := encryption.NewKeyring(newMasterKey, path).DecryptString("instance", encrypted)
+	if err != nil {
+		t.Fatalf("DecryptString: %v", err)
+	}
+	if decrypted != "hello" {
+		t.Errorf("got %q, want %q", decrypted, "hello")
+	}
+
+	if _, err := encryption.NewKeyring(masterKey, path).DecryptString("instance", encrypted); err == nil {
+		t.Error("expected the old master key to fail")
+	}
+}
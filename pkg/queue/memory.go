@@ -0,0 +1,367 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zapmeow/pkg/logger"
+)
+
+// memoryQueue keeps the queues in process, for single-node deployments
+// without Redis. When path is set, every job is also written to its own file
+// under path, so jobs that weren't acked survive a restart.
+type memoryQueue struct {
+	path    string
+	options Options
+	mutex   sync.Mutex
+	seq     uint64
+	ready   map[string][]*memoryJob
+	pending map[string]map[string]*memoryJob
+	// deadLetters holds dead-lettered jobs when there's no path to move
+	// their files to
+	deadLetters map[string][][]byte
+	// changed is closed, and replaced, whenever jobs become ready
+	changed chan struct{}
+}
+
+// memoryJob holds the data in memory, or the file it was written to when the
+// queue is disk-backed. File names carry the deliveries, so the delivery
+// limit still applies to jobs that crash the process.
+type memoryJob struct {
+	seq        uint64
+	data       []byte
+	file       string
+	deliveries int
+	deadline   time.Time
+}
+
+func NewMemoryQueue(path string, options Options) *memoryQueue {
+	q := &memoryQueue{
+		path:        path,
+		options:     options,
+		ready:       make(map[string][]*memoryJob),
+		pending:     make(map[string]map[string]*memoryJob),
+		deadLetters: make(map[string][][]byte),
+		changed:     make(chan struct{}),
+	}
+	if path != "" {
+		if err := q.load(); err != nil {
+			logger.Fatal("Error loading queue from disk. ", err)
+		}
+	}
+	return q
+}
+
+func (q *memoryQueue) Enqueue(queueName string, data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.seq++
+	job := &memoryJob{seq: q.seq, data: data}
+	if q.path != "" {
+		job = &memoryJob{seq: q.seq, file: q.makeJobPath(queueName, q.seq, 0)}
+		if err := q.writeJob(job.file, data); err != nil {
+			return err
+		}
+	}
+
+	q.ready[queueName] = append(q.ready[queueName], job)
+	q.notify()
+	return nil
+}
+
+func (q *memoryQueue) Dequeue(queueNames []string, timeout time.Duration) (*Job, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var job *Job
+		var err error
+		q.mutex.Lock()
+		for _, queueName := range queueNames {
+			job, err = q.dequeue(queueName)
+			if err != nil || job != nil {
+				break
+			}
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+
+		if err != nil || job != nil {
+			return job, err
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (q *memoryQueue) dequeue(queueName string) (*Job, error) {
+	for {
+		job := q.takeExpired(queueName)
+		if job == nil {
+			ready := q.ready[queueName]
+			if len(ready) == 0 {
+				return nil, nil
+			}
+			job = ready[0]
+			q.ready[queueName] = ready[1:]
+		}
+
+		if err := q.deliver(queueName, job); err != nil {
+			return nil, err
+		}
+
+		if job.deliveries > q.options.MaxDeliveries {
+			if err := q.deadLetter(queueName, job); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data := job.data
+		if job.file != "" {
+			var err error
+			data, err = os.ReadFile(job.file)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		job.deadline = time.Now().Add(q.options.VisibilityTimeout)
+		if q.pending[queueName] == nil {
+			q.pending[queueName] = make(map[string]*memoryJob)
+		}
+		q.pending[queueName][q.makeJobID(job)] = job
+
+		return &Job{
+			Queue:      queueName,
+			ID:         q.makeJobID(job),
+			Data:       data,
+			Deliveries: job.deliveries,
+		}, nil
+	}
+}
+
+func (q *memoryQueue) Ack(queueName string, job *Job) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	pending, ok := q.pending[queueName][job.ID]
+	if !ok {
+		return nil
+	}
+	delete(q.pending[queueName], job.ID)
+
+	if pending.file != "" {
+		return os.Remove(pending.file)
+	}
+	return nil
+}
+
+func (q *memoryQueue) Nack(queueName string, job *Job) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	pending, ok := q.pending[queueName][job.ID]
+	if !ok {
+		return nil
+	}
+	delete(q.pending[queueName], job.ID)
+
+	if pending.deliveries >= q.options.MaxDeliveries {
+		return q.deadLetter(queueName, pending)
+	}
+
+	// ready jobs are kept in enqueue order, so the job goes back ahead of
+	// the ones enqueued after it
+	ready := q.ready[queueName]
+	i := sort.Search(len(ready), func(i int) bool {
+		return ready[i].seq > pending.seq
+	})
+	ready = append(ready, nil)
+	copy(ready[i+1:], ready[i:])
+	ready[i] = pending
+	q.ready[queueName] = ready
+
+	q.notify()
+	return nil
+}
+
+// Close reports the jobs that are lost when the queue isn't kept on disk.
+func (q *memoryQueue) Close() error {
+	if q.path != "" {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	lost := 0
+	for _, ready := range q.ready {
+		lost += len(ready)
+	}
+	for _, pending := range q.pending {
+		lost += len(pending)
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d queued jobs are lost, set QUEUE_PATH to keep them across restarts", lost)
+	}
+	return nil
+}
+
+func (q *memoryQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// takeExpired removes and returns the oldest pending job whose visibility
+// timeout expired.
+func (q *memoryQueue) takeExpired(queueName string) *memoryJob {
+	var expired *memoryJob
+	now := time.Now()
+	for _, job := range q.pending[queueName] {
+		if now.After(job.deadline) && (expired == nil || job.seq < expired.seq) {
+			expired = job
+		}
+	}
+
+	if expired != nil {
+		delete(q.pending[queueName], q.makeJobID(expired))
+	}
+	return expired
+}
+
+// deliver counts a delivery, renaming the file of disk-backed jobs.
+func (q *memoryQueue) deliver(queueName string, job *memoryJob) error {
+	job.deliveries++
+	if job.file == "" {
+		return nil
+	}
+
+	file := q.makeJobPath(queueName, job.seq, job.deliveries)
+	if err := os.Rename(job.file, file); err != nil {
+		return err
+	}
+	job.file = file
+	return nil
+}
+
+func (q *memoryQueue) deadLetter(queueName string, job *memoryJob) error {
+	logger.Error("Moving job ", q.makeJobID(job), " of ", queueName, " to the dead-letter list after ", job.deliveries, " deliveries")
+
+	deadLetterName := makeDeadLetterName(queueName)
+	if job.file == "" {
+		q.deadLetters[deadLetterName] = append(q.deadLetters[deadLetterName], job.data)
+		return nil
+	}
+
+	file := q.makeJobPath(deadLetterName, job.seq, job.deliveries)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return os.Rename(job.file, file)
+}
+
+// load restores the jobs left on disk, in the order they were enqueued.
+// Jobs that were pending when the process stopped are ready again.
+func (q *memoryQueue) load() error {
+	dirs, err := os.ReadDir(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		queueName, err := url.PathUnescape(dir.Name())
+		if err != nil {
+			return err
+		}
+
+		files, err := filepath.Glob(filepath.Join(q.path, dir.Name(), "*.job"))
+		if err != nil {
+			return err
+		}
+		// sequences are zero padded, so names sort in enqueue order
+		sort.Strings(files)
+
+		for _, file := range files {
+			job, err := q.parseJobPath(file)
+			if err != nil {
+				return err
+			}
+			if job.seq > q.seq {
+				q.seq = job.seq
+			}
+			if !strings.HasSuffix(queueName, makeDeadLetterName("")) {
+				q.ready[queueName] = append(q.ready[queueName], job)
+			}
+		}
+	}
+	return nil
+}
+
+func (q *memoryQueue) makeJobID(job *memoryJob) string {
+	return strconv.FormatUint(job.seq, 10)
+}
+
+func (q *memoryQueue) makeJobPath(queueName string, seq uint64, deliveries int) string {
+	return filepath.Join(q.path, url.PathEscape(queueName), fmt.Sprintf("%020d-%d.job", seq, deliveries))
+}
+
+func (q *memoryQueue) parseJobPath(file string) (*memoryJob, error) {
+	name := strings.TrimSuffix(filepath.Base(file), ".job")
+	seqValue, deliveriesValue, _ := strings.Cut(name, "-")
+
+	seq, err := strconv.ParseUint(seqValue, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue job %s: %w", file, err)
+	}
+	deliveries, err := strconv.Atoi(deliveriesValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue job %s: %w", file, err)
+	}
+
+	return &memoryJob{seq: seq, file: file, deliveries: deliveries}, nil
+}
+
+// writeJob writes through a temporary file, so a crash never leaves a
+// partially written job behind.
+func (q *memoryQueue) writeJob(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".job-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
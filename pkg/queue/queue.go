@@ -0,0 +1,42 @@
+package queue
+
+import "time"
+
+// Queue delivers jobs at least once, in FIFO order. A dequeued job is
+// reserved until it's acknowledged; when it's neither acked nor nacked within
+// the visibility timeout (e.g. the process crashed), it's delivered again.
+// Jobs delivered more than MaxDeliveries times are moved to a dead-letter
+// list named after the queue with a ":dead-letter" suffix.
+type Queue interface {
+	Enqueue(queueName string, data []byte) error
+	// Dequeue waits up to timeout for a job of any of the queues, returning
+	// nil if none arrived. Queues with a job ready are taken in the given
+	// order.
+	Dequeue(queueNames []string, timeout time.Duration) (*Job, error)
+	// Ack removes a processed job from the queue.
+	Ack(queueName string, job *Job) error
+	// Nack returns a failed job to the queue, or dead-letters it once it
+	// reached the delivery limit. The job is delivered again before the
+	// jobs enqueued after it.
+	Nack(queueName string, job *Job) error
+	// Close releases the connection of the queue. Jobs that weren't acked
+	// are delivered again after a restart, when the queue is persistent.
+	Close() error
+}
+
+type Job struct {
+	// Queue is the queue the job was dequeued from
+	Queue      string
+	ID         string
+	Data       []byte
+	Deliveries int
+}
+
+type Options struct {
+	VisibilityTimeout time.Duration
+	MaxDeliveries     int
+}
+
+func makeDeadLetterName(queueName string) string {
+	return queueName + ":dead-letter"
+}
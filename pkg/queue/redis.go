@@ -1,21 +1,40 @@
 package queue
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"zapmeow/pkg/logger"
 
 	"github.com/go-redis/redis"
 )
 
-type Queue interface {
-	Enqueue(queueName string, data []byte) error
-	Dequeue(queueName string) ([]byte, error)
-}
+const (
+	consumerGroup = "zapmeow"
+	// pendingScanSize is how many pending jobs are checked for an expired
+	// visibility timeout on each scan.
+	pendingScanSize = 100
+)
 
+// queue stores every queue in a Redis stream read through a consumer group.
+// Stream entries hold the job data and the deliveries of earlier entries of
+// the same job, as a nacked job used to be added again as a new entry.
 type queue struct {
-	client *redis.Client
+	client   *redis.Client
+	options  Options
+	consumer string
+	// streams holds the queues whose stream and group are known to exist
+	streams sync.Map
+	// scans holds when the pending jobs of each queue were last found not
+	// to have expired. Queues are scanned again once half the visibility
+	// timeout passed, or right away after a nack.
+	scans sync.Map
 }
 
-func NewQueue(addr string, password string) *queue {
+func NewQueue(addr string, password string, options Options) *queue {
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
@@ -24,21 +43,290 @@ func NewQueue(addr string, password string) *queue {
 	if _, err := client.Ping().Result(); err != nil {
 		logger.Fatal(err)
 	}
+
+	hostname, _ := os.Hostname()
 	return &queue{
-		client: client,
+		client:   client,
+		options:  options,
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
 	}
 }
 
 func (q *queue) Enqueue(queueName string, data []byte) error {
-	return q.client.LPush(queueName, data).Err()
+	if err := q.setup(queueName); err != nil {
+		return err
+	}
+	return q.add(queueName, data, 0)
+}
+
+// Dequeue claims the expired jobs of the queues due for a scan, and
+// otherwise waits for a new job of any of them with a single blocking read.
+func (q *queue) Dequeue(queueNames []string, timeout time.Duration) (*Job, error) {
+	for _, queueName := range queueNames {
+		if err := q.setup(queueName); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, queueName := range queueNames {
+		if !q.isScanDue(queueName) {
+			continue
+		}
+
+		job, err := q.claimNext(queueName)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			return job, nil
+		}
+		q.scans.Store(queueName, time.Now())
+	}
+	return q.readNew(queueNames, timeout)
+}
+
+func (q *queue) Ack(queueName string, job *Job) error {
+	_, err := q.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.XAck(queueName, consumerGroup, job.ID)
+		pipe.XDel(queueName, job.ID)
+		return nil
+	})
+	return err
+}
+
+// Nack leaves the job pending with an expired visibility timeout, so the
+// next dequeue claims it again before reading newer jobs. The retry count is
+// kept, so the claim doesn't count as a delivery.
+func (q *queue) Nack(queueName string, job *Job) error {
+	if job.Deliveries >= q.options.MaxDeliveries {
+		return q.deadLetter(queueName, job)
+	}
+
+	pending, err := q.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: queueName,
+		Group:  consumerGroup,
+		Start:  job.ID,
+		End:    job.ID,
+		Count:  1,
+	}).Result()
+	if err == redis.Nil || (err == nil && len(pending) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return q.expire(queueName, job.ID, pending[0].RetryCount)
+}
+
+func (q *queue) Close() error {
+	return q.client.Close()
+}
+
+// setup creates the stream and its consumer group on first use. Lists left
+// by the former LPUSH/LPOP queue are moved into the stream, oldest first.
+func (q *queue) setup(queueName string) error {
+	if _, ok := q.streams.Load(queueName); ok {
+		return nil
+	}
+
+	keyType, err := q.client.Type(queueName).Result()
+	if err != nil {
+		return err
+	}
+	if keyType == "list" {
+		if err := q.migrateList(queueName); err != nil {
+			return err
+		}
+	}
+
+	err = q.client.XGroupCreateMkStream(queueName, consumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	q.streams.Store(queueName, true)
+	return nil
+}
+
+func (q *queue) migrateList(queueName string) error {
+	legacyName := queueName + ":legacy"
+	if err := q.client.Rename(queueName, legacyName).Err(); err != nil {
+		return err
+	}
+
+	items, err := q.client.LRange(legacyName, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		if err := q.add(queueName, []byte(items[i]), 0); err != nil {
+			return err
+		}
+	}
+	return q.client.Del(legacyName).Err()
+}
+
+// expire sets the visibility timeout of a pending entry as expired, keeping
+// retryCount as its deliveries, so the next dequeue claims it again.
+func (q *queue) expire(queueName string, id string, retryCount int64) error {
+	q.scans.Delete(queueName)
+
+	idle := int64(q.options.VisibilityTimeout / time.Millisecond)
+	return q.client.Do(
+		"XCLAIM", queueName, consumerGroup, q.consumer, 0, id,
+		"IDLE", idle, "RETRYCOUNT", retryCount, "JUSTID",
+	).Err()
+}
+
+func (q *queue) isScanDue(queueName string) bool {
+	scannedAt, ok := q.scans.Load(queueName)
+	return !ok || time.Since(scannedAt.(time.Time)) >= q.options.VisibilityTimeout/2
+}
+
+// claimNext claims the next expired job of the queue, dead-lettering the
+// ones past the delivery limit.
+func (q *queue) claimNext(queueName string) (*Job, error) {
+	for {
+		job, err := q.claimExpired(queueName)
+		if err != nil || job == nil {
+			return nil, err
+		}
+
+		if job.Deliveries <= q.options.MaxDeliveries {
+			return job, nil
+		}
+		if err := q.deadLetter(queueName, job); err != nil {
+			return nil, err
+		}
+	}
 }
 
-func (q *queue) Dequeue(queueName string) ([]byte, error) {
-	result, err := q.client.LPop(queueName).Bytes()
-	if err != nil && err == redis.Nil {
+// claimExpired takes over a job whose visibility timeout expired, e.g. one
+// left by a consumer that crashed or restarted.
+func (q *queue) claimExpired(queueName string) (*Job, error) {
+	pending, err := q.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: queueName,
+		Group:  consumerGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  pendingScanSize,
+	}).Result()
+	if err == redis.Nil {
 		return nil, nil
-	} else if err != nil {
+	}
+	if err != nil {
 		return nil, err
 	}
-	return result, nil
+
+	for _, entry := range pending {
+		if entry.Idle < q.options.VisibilityTimeout {
+			continue
+		}
+
+		messages, err := q.client.XClaim(&redis.XClaimArgs{
+			Stream:   queueName,
+			Group:    consumerGroup,
+			Consumer: q.consumer,
+			MinIdle:  q.options.VisibilityTimeout,
+			Messages: []string{entry.Id},
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		// another consumer claimed it first
+		if len(messages) == 0 {
+			continue
+		}
+
+		return q.makeJob(queueName, messages[0], int(entry.RetryCount)+1)
+	}
+	return nil, nil
+}
+
+// readNew reads a new job of any of the queues. The read may return a job
+// of each queue, so all but the first are left pending with an expired
+// visibility timeout and no delivery counted, to be claimed by the next
+// dequeue before newer jobs of their queue.
+func (q *queue) readNew(queueNames []string, timeout time.Duration) (*Job, error) {
+	// a zero block waits forever, while a negative one doesn't wait at all
+	block := timeout
+	if block <= 0 {
+		block = -1
+	}
+
+	args := make([]string, 0, 2*len(queueNames))
+	args = append(args, queueNames...)
+	for range queueNames {
+		args = append(args, ">")
+	}
+
+	streams, err := q.client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    consumerGroup,
+		Consumer: q.consumer,
+		Streams:  args,
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job *Job
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			if job == nil && err == nil {
+				job, err = q.makeJob(stream.Stream, message, 1)
+				continue
+			}
+
+			if err := q.expire(stream.Stream, message.ID, 0); err != nil {
+				logger.Error("Error returning job ", message.ID, " to ", stream.Stream, ". ", err)
+			}
+		}
+	}
+	return job, err
+}
+
+func (q *queue) deadLetter(queueName string, job *Job) error {
+	logger.Error("Moving job ", job.ID, " of ", queueName, " to the dead-letter list after ", job.Deliveries, " deliveries")
+
+	_, err := q.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(makeDeadLetterName(queueName), job.Data)
+		pipe.XAck(queueName, consumerGroup, job.ID)
+		pipe.XDel(queueName, job.ID)
+		return nil
+	})
+	return err
+}
+
+func (q *queue) add(queueName string, data []byte, deliveries int) error {
+	return q.client.XAdd(&redis.XAddArgs{
+		Stream: queueName,
+		Values: map[string]interface{}{
+			"data":       data,
+			"deliveries": deliveries,
+		},
+	}).Err()
+}
+
+// makeJob adds the deliveries of the entry itself to the ones recorded for
+// earlier entries of the job.
+func (q *queue) makeJob(queueName string, message redis.XMessage, entryDeliveries int) (*Job, error) {
+	data, _ := message.Values["data"].(string)
+	value, _ := message.Values["deliveries"].(string)
+
+	deliveries, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deliveries of job %s: %w", message.ID, err)
+	}
+
+	return &Job{
+		Queue:      queueName,
+		ID:         message.ID,
+		Data:       []byte(data),
+		Deliveries: deliveries + entryDeliveries,
+	}, nil
 }
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Limits are the outbound limits of a sender. Zero limits are disabled.
+type Limits struct {
+	PerSecond      int
+	PerMinute      int
+	NewChatsPerDay int
+	// MinInterval and MaxInterval bound the random interval between
+	// consecutive sends
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// Error is returned when a send would exceed a limit.
+type Error struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rate limit exceeded: %s", e.Limit)
+}
+
+// Limiter schedules the sends of a single sender. Sends are counted when
+// they're reserved, so a send that fails still counts against the limits.
+type Limiter struct {
+	mutex sync.Mutex
+	// sends and newChats hold the times of the sends within the last minute
+	// and of the new chats within the last day, in order
+	sends    []time.Time
+	newChats []time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{}
+}
+
+// Reserve schedules a send, returning how long to wait before sending it,
+// or an *Error when it would exceed the limits.
+func (l *Limiter) Reserve(limits Limits, newChat bool) (time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.sends = prune(l.sends, now.Add(-time.Minute))
+	l.newChats = prune(l.newChats, now.Add(-24*time.Hour))
+
+	at := now
+	if len(l.sends) > 0 {
+		next := l.sends[len(l.sends)-1].Add(interval(limits))
+		if next.After(at) {
+			at = next
+		}
+	}
+
+	if err := check(l.sends, limits.PerSecond, at, time.Second, now, "messages per second"); err != nil {
+		return 0, err
+	}
+	if err := check(l.sends, limits.PerMinute, at, time.Minute, now, "messages per minute"); err != nil {
+		return 0, err
+	}
+	if newChat {
+		if err := check(l.newChats, limits.NewChatsPerDay, at, 24*time.Hour, now, "new chats per day"); err != nil {
+			return 0, err
+		}
+		l.newChats = append(l.newChats, at)
+	}
+
+	l.sends = append(l.sends, at)
+	return at.Sub(now), nil
+}
+
+// check fails when limit sends already happened within window before at.
+func check(times []time.Time, limit int, at time.Time, window time.Duration, now time.Time, name string) error {
+	if limit <= 0 || len(times) < limit {
+		return nil
+	}
+
+	oldest := times[len(times)-limit]
+	if !oldest.After(at.Add(-window)) {
+		return nil
+	}
+	return &Error{
+		Limit:      name,
+		RetryAfter: oldest.Add(window).Sub(now),
+	}
+}
+
+func prune(times []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(since) {
+		i++
+	}
+	return times[i:]
+}
+
+func interval(limits Limits) time.Duration {
+	if limits.MaxInterval <= limits.MinInterval {
+		return limits.MinInterval
+	}
+	return limits.MinInterval + time.Duration(rand.Int63n(int64(limits.MaxInterval-limits.MinInterval)))
+}
@@ -0,0 +1,137 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"zapmeow/pkg/ratelimit"
+)
+
+// tolerance covers the time passing between consecutive reservations
+const tolerance = 50 * time.Millisecond
+
+type reservation struct {
+	newChat bool
+	// wait and maxWait bound the wait before the send. maxWait defaults to
+	// wait.
+	wait    time.Duration
+	maxWait time.Duration
+	// limit is the limit the send exceeds, if any, and retryAfter when it
+	// can be retried
+	limit      string
+	retryAfter time.Duration
+}
+
+func TestLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		limits       ratelimit.Limits
+		reservations []reservation
+	}{
+		{
+			name:   "no limits",
+			limits: ratelimit.Limits{},
+			reservations: []reservation{
+				{}, {newChat: true}, {}, {newChat: true}, {},
+			},
+		},
+		{
+			name:   "messages per second",
+			limits: ratelimit.Limits{PerSecond: 2},
+			reservations: []reservation{
+				{},
+				{},
+				{limit: "messages per second", retryAfter: time.Second},
+			},
+		},
+		{
+			name:   "messages per minute",
+			limits: ratelimit.Limits{PerSecond: 10, PerMinute: 3},
+			reservations: []reservation{
+				{},
+				{},
+				{},
+				{limit: "messages per minute", retryAfter: time.Minute},
+				{limit: "messages per minute", retryAfter: time.Minute},
+			},
+		},
+		{
+			name:   "new chats per day",
+			limits: ratelimit.Limits{NewChatsPerDay: 1},
+			reservations: []reservation{
+				{newChat: true},
+				{newChat: true, limit: "new chats per day", retryAfter: 24 * time.Hour},
+				{},
+			},
+		},
+		{
+			name:   "fixed interval",
+			limits: ratelimit.Limits{MinInterval: 100 * time.Millisecond, MaxInterval: 100 * time.Millisecond},
+			reservations: []reservation{
+				{},
+				{wait: 100 * time.Millisecond},
+				{wait: 200 * time.Millisecond},
+			},
+		},
+		{
+			name:   "random interval",
+			limits: ratelimit.Limits{MinInterval: 100 * time.Millisecond, MaxInterval: 200 * time.Millisecond},
+			reservations: []reservation{
+				{},
+				{wait: 100 * time.Millisecond, maxWait: 200 * time.Millisecond},
+			},
+		},
+		{
+			name:   "interval spreads sends within the limits",
+			limits: ratelimit.Limits{PerSecond: 2, MinInterval: 600 * time.Millisecond},
+			reservations: []reservation{
+				{},
+				{wait: 600 * time.Millisecond},
+				{wait: 1200 * time.Millisecond},
+			},
+		},
+		{
+			name:   "interval counts towards the limits",
+			limits: ratelimit.Limits{PerSecond: 2, MinInterval: 400 * time.Millisecond},
+			reservations: []reservation{
+				{},
+				{wait: 400 * time.Millisecond},
+				{limit: "messages per second", retryAfter: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := ratelimit.NewLimiter()
+			for i, r := range tt.reservations {
+				wait, err := limiter.Reserve(tt.limits, r.newChat)
+
+				if r.limit != "" {
+					var limitErr *ratelimit.Error
+					if !errors.As(err, &limitErr) {
+						t.Fatalf("reservation %d: got error %v, want %q exceeded", i, err, r.limit)
+					}
+					if limitErr.Limit != r.limit {
+						t.Errorf("reservation %d: got limit %q, want %q", i, limitErr.Limit, r.limit)
+					}
+					if limitErr.RetryAfter <= r.retryAfter-tolerance || limitErr.RetryAfter > r.retryAfter {
+						t.Errorf("reservation %d: got retry after %v, want about %v", i, limitErr.RetryAfter, r.retryAfter)
+					}
+					continue
+				}
+
+				if err != nil {
+					t.Fatalf("reservation %d: unexpected error %v", i, err)
+				}
+				maxWait := r.maxWait
+				if maxWait == 0 {
+					maxWait = r.wait
+				}
+				if wait < r.wait-tolerance || wait > maxWait {
+					t.Errorf("reservation %d: got wait %v, want between %v and %v", i, wait, r.wait, maxWait)
+				}
+			}
+		})
+	}
+}
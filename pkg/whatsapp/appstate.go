@@ -0,0 +1,115 @@
+package whatsapp
+
+import (
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// LastMessage identifies the newest message of a chat. WhatsApp uses it to
+// scope archive, read, clear and delete patches to the messages we've seen.
+type LastMessage struct {
+	ID        string
+	FromMe    bool
+	Timestamp time.Time
+}
+
+func (w *whatsApp) ArchiveChat(instance *Instance, jid JID, archive bool, lastMessage *LastMessage) error {
+	timestamp, key := w.makeMessageRange(jid, lastMessage)
+	return instance.Client.SendAppState(appstate.BuildArchive(jid, archive, timestamp, key))
+}
+
+func (w *whatsApp) PinChat(instance *Instance, jid JID, pin bool) error {
+	return instance.Client.SendAppState(appstate.BuildPin(jid, pin))
+}
+
+func (w *whatsApp) MuteChat(instance *Instance, jid JID, mute bool, duration time.Duration) error {
+	return instance.Client.SendAppState(appstate.BuildMute(jid, mute, duration))
+}
+
+func (w *whatsApp) MarkChatAsRead(instance *Instance, jid JID, read bool, lastMessage *LastMessage) error {
+	return instance.Client.SendAppState(appstate.PatchInfo{
+		Type: appstate.WAPatchRegularLow,
+		Mutations: []appstate.MutationInfo{{
+			Index:   []string{appstate.IndexMarkChatAsRead, jid.String()},
+			Version: 3,
+			Value: &waProto.SyncActionValue{
+				MarkChatAsReadAction: &waProto.MarkChatAsReadAction{
+					Read:         proto.Bool(read),
+					MessageRange: w.makeSyncActionMessageRange(jid, lastMessage),
+				},
+			},
+		}},
+	})
+}
+
+func (w *whatsApp) ClearChat(instance *Instance, jid JID, lastMessage *LastMessage) error {
+	return instance.Client.SendAppState(appstate.PatchInfo{
+		Type: appstate.WAPatchRegularHigh,
+		Mutations: []appstate.MutationInfo{{
+			// the trailing flags keep starred messages and media files: "0" means don't delete
+			Index:   []string{appstate.IndexClearChat, jid.String(), "0", "0"},
+			Version: 6,
+			Value: &waProto.SyncActionValue{
+				ClearChatAction: &waProto.ClearChatAction{
+					MessageRange: w.makeSyncActionMessageRange(jid, lastMessage),
+				},
+			},
+		}},
+	})
+}
+
+func (w *whatsApp) DeleteChat(instance *Instance, jid JID, lastMessage *LastMessage) error {
+	return instance.Client.SendAppState(appstate.PatchInfo{
+		Type: appstate.WAPatchRegularHigh,
+		Mutations: []appstate.MutationInfo{{
+			// the trailing flag keeps media files: "0" means don't delete
+			Index:   []string{appstate.IndexDeleteChat, jid.String(), "0"},
+			Version: 6,
+			Value: &waProto.SyncActionValue{
+				DeleteChatAction: &waProto.DeleteChatAction{
+					MessageRange: w.makeSyncActionMessageRange(jid, lastMessage),
+				},
+			},
+		}},
+	})
+}
+
+func (w *whatsApp) makeMessageRange(jid JID, lastMessage *LastMessage) (time.Time, *waProto.MessageKey) {
+	if lastMessage == nil {
+		return time.Time{}, nil
+	}
+
+	// in groups the key of a received message also needs the participant,
+	// which isn't stored, so only our own messages can be referenced there
+	if jid.Server == types.GroupServer && !lastMessage.FromMe {
+		return lastMessage.Timestamp, nil
+	}
+
+	return lastMessage.Timestamp, &waProto.MessageKey{
+		RemoteJid: proto.String(jid.String()),
+		FromMe:    proto.Bool(lastMessage.FromMe),
+		Id:        proto.String(lastMessage.ID),
+	}
+}
+
+func (w *whatsApp) makeSyncActionMessageRange(jid JID, lastMessage *LastMessage) *waProto.SyncActionMessageRange {
+	timestamp, key := w.makeMessageRange(jid, lastMessage)
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	messageRange := &waProto.SyncActionMessageRange{
+		LastMessageTimestamp: proto.Int64(timestamp.Unix()),
+	}
+	if key != nil {
+		messageRange.Messages = []*waProto.SyncActionMessage{{
+			Key:       key,
+			Timestamp: proto.Int64(timestamp.Unix()),
+		}}
+	}
+	return messageRange
+}
@@ -0,0 +1,88 @@
+package whatsapp
+
+import (
+	"regexp"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/store"
+	"google.golang.org/protobuf/proto"
+)
+
+// DeviceInfo is how an instance shows up in the linked devices of the phone.
+// The name and platform are sent while pairing through a QR code or a phone
+// number, and the browser label is shown by the phone when pairing through a
+// phone number. Empty fields take the defaults of the server.
+type DeviceInfo struct {
+	Name         string
+	Platform     string
+	BrowserLabel string
+}
+
+// WhatsApp only accepts browser labels like "Chrome (Linux)"
+var browserLabelPattern = regexp.MustCompile(`^[^()]+ \([^()]+\)$`)
+
+// deviceMutex guards the device properties of whatsmeow, which are global,
+// while an unpaired client connects with the properties of its instance.
+var deviceMutex sync.Mutex
+
+// IsValidPlatform reports whether platform is a platform type known to
+// WhatsApp, e.g. CHROME or DESKTOP.
+func IsValidPlatform(platform string) bool {
+	_, ok := waProto.DeviceProps_PlatformType_value[platform]
+	return ok
+}
+
+func IsValidBrowserLabel(label string) bool {
+	return browserLabelPattern.MatchString(label)
+}
+
+func (w *whatsApp) makeDeviceInfo(device DeviceInfo) DeviceInfo {
+	if device.Name == "" {
+		device.Name = w.device.Name
+	}
+	if device.Platform == "" || !IsValidPlatform(device.Platform) {
+		device.Platform = w.device.Platform
+	}
+	if device.BrowserLabel == "" {
+		device.BrowserLabel = w.device.BrowserLabel
+	}
+	return device
+}
+
+// connectUnpaired connects an unpaired client, which sends the device
+// properties during the handshake.
+func (w *whatsApp) connectUnpaired(instance *Instance) error {
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	store.DeviceProps.Os = proto.String(instance.Device.Name)
+	store.DeviceProps.PlatformType = waProto.DeviceProps_PlatformType(
+		waProto.DeviceProps_PlatformType_value[instance.Device.Platform],
+	).Enum()
+	return instance.Client.Connect()
+}
+
+// makePairClientType picks the client type sent along with a phone pairing
+// request, which only knows browsers.
+func makePairClientType(platform string) whatsmeow.PairClientType {
+	switch platform {
+	case "FIREFOX":
+		return whatsmeow.PairClientFirefox
+	case "IE":
+		return whatsmeow.PairClientIE
+	case "OPERA":
+		return whatsmeow.PairClientOpera
+	case "SAFARI":
+		return whatsmeow.PairClientSafari
+	case "EDGE":
+		return whatsmeow.PairClientEdge
+	case "DESKTOP":
+		return whatsmeow.PairClientElectron
+	case "UWP":
+		return whatsmeow.PairClientUWP
+	default:
+		return whatsmeow.PairClientChrome
+	}
+}
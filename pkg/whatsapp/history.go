@@ -0,0 +1,43 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// RequestHistorySync asks the phone for up to count messages of the chat
+// sent before oldestMessage. The phone answers with an on-demand history sync.
+func (w *whatsApp) RequestHistorySync(instance *Instance, jid JID, oldestMessage *LastMessage, count int) error {
+	if instance.Client.Store.ID == nil {
+		return errors.New("instance is not logged in")
+	}
+
+	message := &waProto.Message{
+		ProtocolMessage: &waProto.ProtocolMessage{
+			Type: waProto.ProtocolMessage_PEER_DATA_OPERATION_REQUEST_MESSAGE.Enum(),
+			PeerDataOperationRequestMessage: &waProto.PeerDataOperationRequestMessage{
+				PeerDataOperationRequestType: waProto.PeerDataOperationRequestType_HISTORY_SYNC_ON_DEMAND.Enum(),
+				HistorySyncOnDemandRequest: &waProto.PeerDataOperationRequestMessage_HistorySyncOnDemandRequest{
+					ChatJid:              proto.String(jid.String()),
+					OldestMsgId:          proto.String(oldestMessage.ID),
+					OldestMsgFromMe:      proto.Bool(oldestMessage.FromMe),
+					OnDemandMsgCount:     proto.Int32(int32(count)),
+					OldestMsgTimestampMs: proto.Int64(oldestMessage.Timestamp.UnixMilli()),
+				},
+			},
+		},
+	}
+
+	// peer messages go to our own primary device
+	_, err := instance.Client.SendMessage(
+		context.Background(),
+		instance.Client.Store.ID.ToNonAD(),
+		message,
+		whatsmeow.SendRequestExtra{Peer: true},
+	)
+	return err
+}
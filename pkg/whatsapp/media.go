@@ -0,0 +1,113 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MediaInfo is what's needed to download the media of a message after the
+// message itself was received.
+type MediaInfo struct {
+	DirectPath    string
+	MediaKey      []byte
+	FileSHA256    []byte
+	FileEncSHA256 []byte
+	FileLength    uint64
+}
+
+// MediaRetryMessage identifies the message whose media is requested again
+// from the phone.
+type MediaRetryMessage struct {
+	ID       string
+	Chat     JID
+	Sender   JID
+	FromMe   bool
+	MediaKey []byte
+}
+
+func ParseMediaType(value string) (MediaType, bool) {
+	for _, mediaType := range []MediaType{Audio, Image, Document, Sticker} {
+		if mediaType.String() == value {
+			return mediaType, true
+		}
+	}
+	return 0, false
+}
+
+// DownloadMedia downloads media from its info. WhatsApp removes media from
+// its servers after a while, and then the phone has to be asked to upload it
+// again with RequestMediaRetry.
+func (w *whatsApp) DownloadMedia(instance *Instance, mediaType MediaType, info MediaInfo) ([]byte, error) {
+	var mType whatsmeow.MediaType
+	switch mediaType {
+	case Image, Sticker:
+		mType = whatsmeow.MediaImage
+	case Audio:
+		mType = whatsmeow.MediaAudio
+	case Document:
+		mType = whatsmeow.MediaDocument
+	default:
+		return nil, errors.New("unknown media type")
+	}
+
+	if info.DirectPath == "" {
+		return nil, whatsmeow.ErrNoURLPresent
+	}
+
+	return instance.Client.DownloadMediaWithPath(
+		info.DirectPath,
+		info.FileEncSHA256,
+		info.FileSHA256,
+		info.MediaKey,
+		int(info.FileLength),
+		mType,
+		"",
+	)
+}
+
+// RequestMediaRetry asks the phone to upload the media of a message again.
+// The answer arrives as an events.MediaRetry, to be read with
+// DecryptMediaRetry.
+func (w *whatsApp) RequestMediaRetry(instance *Instance, message MediaRetryMessage) error {
+	return instance.Client.SendMediaRetryReceipt(&types.MessageInfo{
+		ID: message.ID,
+		MessageSource: types.MessageSource{
+			Chat:     message.Chat,
+			Sender:   message.Sender,
+			IsFromMe: message.FromMe,
+			IsGroup:  message.Chat.Server == types.GroupServer,
+		},
+	}, message.MediaKey)
+}
+
+// DecryptMediaRetry returns the new direct path of the media the phone
+// uploaded again.
+func (w *whatsApp) DecryptMediaRetry(evt *events.MediaRetry, mediaKey []byte) (string, error) {
+	notification, err := whatsmeow.DecryptMediaRetryNotification(evt, mediaKey)
+	if err != nil {
+		return "", err
+	}
+
+	if notification.GetResult() != waProto.MediaRetryNotification_SUCCESS {
+		return "", fmt.Errorf("media retry failed: %s", notification.GetResult())
+	}
+	return notification.GetDirectPath(), nil
+}
+
+func (w *whatsApp) makeMediaInfo(media whatsmeow.DownloadableMessage) *MediaInfo {
+	info := &MediaInfo{
+		DirectPath:    media.GetDirectPath(),
+		MediaKey:      media.GetMediaKey(),
+		FileSHA256:    media.GetFileSha256(),
+		FileEncSHA256: media.GetFileEncSha256(),
+	}
+	if sized, ok := media.(interface{ GetFileLength() uint64 }); ok {
+		info.FileLength = sized.GetFileLength()
+	}
+	return info
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"time"
 	"zapmeow/config"
 	"zapmeow/pkg/logger"
@@ -27,11 +28,14 @@ type Instance struct {
 	ID              string
 	Client          *Client
 	QrCodeRateLimit uint16
+	Device          DeviceInfo
 }
 
 type Message struct {
 	InstanceID string
 	Body       string
+	Caption    string
+	Filename   string
 	SenderJID  string
 	ChatJID    string
 	MessageID  string
@@ -40,6 +44,7 @@ type Message struct {
 	MediaType  *MediaType
 	Media      *[]byte
 	Mimetype   *string
+	MediaInfo  *MediaInfo
 }
 
 type MediaType int
@@ -104,25 +109,43 @@ type IsOnWhatsAppResponse struct {
 }
 
 type WhatsApp interface {
-	CreateInstance(id string) *Instance
-	CreateInstanceFromDevice(id string, jid JID) *Instance
+	CreateInstance(id string, device DeviceInfo) *Instance
+	CreateInstanceFromDevice(id string, jid JID, device DeviceInfo) *Instance
 	IsLoggedIn(instance *Instance) bool
 	IsConnected(instance *Instance) bool
+	Connect(instance *Instance) error
 	Disconnect(instance *Instance)
+	SetProxy(instance *Instance, proxyURL string) error
 	Logout(instance *Instance) error
+	DeleteDevice(instance *Instance) error
 	EventHandler(instance *Instance, handler func(evt interface{}))
 	InitInstance(instance *Instance, qrcodeHandler func(evt string, qrcode string, err error)) error
+	PairPhone(instance *Instance, phone string) (string, error)
 	SendTextMessage(instance *Instance, jid JID, text string) (MessageResponse, error)
 	SendAudioMessage(instance *Instance, jid JID, audioURL *dataurl.DataURL, mimitype string) (MessageResponse, error)
 	SendImageMessage(instance *Instance, jid JID, imageURL *dataurl.DataURL, mimitype string) (MessageResponse, error)
 	SendDocumentMessage(instance *Instance, jid JID, documentURL *dataurl.DataURL, mimitype string, filename string) (MessageResponse, error)
 	GetContactInfo(instance *Instance, jid JID) (*ContactInfo, error)
+	GetChatName(instance *Instance, jid JID) (string, error)
 	ParseEventMessage(instance *Instance, message *events.Message) (Message, error)
+	ParseEventMessageWithoutMedia(instance *Instance, message *events.Message) Message
 	IsOnWhatsApp(instance *Instance, phones []string) ([]IsOnWhatsAppResponse, error)
+	ArchiveChat(instance *Instance, jid JID, archive bool, lastMessage *LastMessage) error
+	PinChat(instance *Instance, jid JID, pin bool) error
+	MuteChat(instance *Instance, jid JID, mute bool, duration time.Duration) error
+	MarkChatAsRead(instance *Instance, jid JID, read bool, lastMessage *LastMessage) error
+	ClearChat(instance *Instance, jid JID, lastMessage *LastMessage) error
+	DeleteChat(instance *Instance, jid JID, lastMessage *LastMessage) error
+	RequestHistorySync(instance *Instance, jid JID, oldestMessage *LastMessage, count int) error
+	DownloadMedia(instance *Instance, mediaType MediaType, info MediaInfo) ([]byte, error)
+	RequestMediaRetry(instance *Instance, message MediaRetryMessage) error
+	DecryptMediaRetry(evt *events.MediaRetry, mediaKey []byte) (string, error)
 }
 
 type whatsApp struct {
 	container *sqlstore.Container
+	// device is the default of instances that don't set their own
+	device DeviceInfo
 }
 
 func NewWhatsApp(databasePath string) *whatsApp {
@@ -138,35 +161,55 @@ func NewWhatsApp(databasePath string) *whatsApp {
 	if err != nil {
 		logger.Fatal(err)
 	}
-	return &whatsApp{container: container}
+
+	if !IsValidPlatform(cfg.DevicePlatform) {
+		logger.Fatal("Unknown device platform: ", cfg.DevicePlatform)
+	}
+	if !IsValidBrowserLabel(cfg.DeviceBrowserLabel) {
+		logger.Fatal("Device browser label must look like \"Chrome (Linux)\": ", cfg.DeviceBrowserLabel)
+	}
+	store.DeviceProps.Os = proto.String(cfg.DeviceName)
+	store.DeviceProps.PlatformType = waProto.DeviceProps_PlatformType(
+		waProto.DeviceProps_PlatformType_value[cfg.DevicePlatform],
+	).Enum()
+
+	return &whatsApp{
+		container: container,
+		device: DeviceInfo{
+			Name:         cfg.DeviceName,
+			Platform:     cfg.DevicePlatform,
+			BrowserLabel: cfg.DeviceBrowserLabel,
+		},
+	}
 }
 
-func (w *whatsApp) CreateInstance(id string) *Instance {
+func (w *whatsApp) CreateInstance(id string, device DeviceInfo) *Instance {
 	client := w.createClient(w.container.NewDevice())
 	return &Instance{
 		ID:              id,
 		Client:          client,
 		QrCodeRateLimit: 10,
+		Device:          w.makeDeviceInfo(device),
 	}
 }
 
-func (w *whatsApp) CreateInstanceFromDevice(id string, jid JID) *Instance {
-	device, _ := w.container.GetDevice(JID{
-		User:   jid.User,
-		Agent:  jid.Agent,
-		Device: jid.Device,
-		Server: jid.Server,
-		AD:     jid.AD,
+func (w *whatsApp) CreateInstanceFromDevice(id string, jid JID, device DeviceInfo) *Instance {
+	deviceStore, _ := w.container.GetDevice(JID{
+		User:     jid.User,
+		RawAgent: jid.RawAgent,
+		Device:   jid.Device,
+		Server:   jid.Server,
 	})
-	if device != nil {
-		client := w.createClient(device)
+	if deviceStore != nil {
+		client := w.createClient(deviceStore)
 		return &Instance{
 			ID:              id,
 			Client:          client,
 			QrCodeRateLimit: 10,
+			Device:          w.makeDeviceInfo(device),
 		}
 	}
-	return w.CreateInstance(id)
+	return w.CreateInstance(id, device)
 }
 
 func (w *whatsApp) IsLoggedIn(instance *Instance) bool {
@@ -181,14 +224,34 @@ func (w *whatsApp) Disconnect(instance *Instance) {
 	instance.Client.Disconnect()
 }
 
-func (w *whatsApp) Connect(instance *Instance) {
-	instance.Client.Disconnect()
+func (w *whatsApp) Connect(instance *Instance) error {
+	return instance.Client.Connect()
+}
+
+// SetProxy routes the websocket and media transfers of the instance through
+// the proxy, or the proxy of the environment when proxyURL is empty. It takes
+// effect on the next connection.
+func (w *whatsApp) SetProxy(instance *Instance, proxyURL string) error {
+	if proxyURL == "" {
+		instance.Client.SetProxy(http.ProxyFromEnvironment)
+		return nil
+	}
+	return instance.Client.SetProxyAddress(proxyURL)
 }
 
 func (w *whatsApp) Logout(instance *Instance) error {
 	return instance.Client.Logout()
 }
 
+// DeleteDevice deletes the session of the instance from the device store
+// without logging out, e.g. when WhatsApp can't be reached to log out.
+func (w *whatsApp) DeleteDevice(instance *Instance) error {
+	if instance.Client.Store.ID == nil {
+		return nil
+	}
+	return instance.Client.Store.Delete()
+}
+
 func (w *whatsApp) EventHandler(instance *Instance, handler func(evt interface{})) {
 	instance.Client.AddEventHandler(handler)
 }
@@ -210,6 +273,31 @@ func (w *whatsApp) InitInstance(instance *Instance, qrcodeHandler func(evt strin
 	return nil
 }
 
+// PairPhone generates the code to link the instance by entering it on the
+// phone, instead of scanning a QR code. It has to be called while QR codes are
+// generated, as pairing uses the same websocket.
+func (w *whatsApp) PairPhone(instance *Instance, phone string) (string, error) {
+	if instance.Client.Store.ID != nil {
+		return "", errors.New("instance is already paired")
+	}
+
+	// the websocket is connected in the background by InitInstance
+	deadline := time.Now().Add(10 * time.Second)
+	for !instance.Client.IsConnected() {
+		if time.Now().After(deadline) {
+			return "", errors.New("websocket didn't connect within 10 seconds")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return instance.Client.PairPhone(
+		phone,
+		true,
+		makePairClientType(instance.Device.Platform),
+		instance.Device.BrowserLabel,
+	)
+}
+
 func (w *whatsApp) SendTextMessage(instance *Instance, jid JID, text string) (MessageResponse, error) {
 	message := &waProto.Message{
 		ExtendedTextMessage: &waProto.ExtendedTextMessage{
@@ -340,35 +428,73 @@ func (w *whatsApp) GetContactInfo(instance *Instance, jid JID) (*ContactInfo, er
 	}, nil
 }
 
+func (w *whatsApp) GetChatName(instance *Instance, jid JID) (string, error) {
+	if jid.Server == types.GroupServer {
+		groupInfo, err := instance.Client.GetGroupInfo(jid)
+		if err != nil {
+			return "", err
+		}
+		return groupInfo.Name, nil
+	}
+
+	contactInfo, err := instance.Client.Store.Contacts.GetContact(jid)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case contactInfo.FullName != "":
+		return contactInfo.FullName, nil
+	case contactInfo.PushName != "":
+		return contactInfo.PushName, nil
+	default:
+		return contactInfo.BusinessName, nil
+	}
+}
+
+// ParseEventMessageWithoutMedia parses a message like ParseEventMessage, but
+// only tells how to download its media instead of downloading it.
+func (w *whatsApp) ParseEventMessageWithoutMedia(instance *Instance, message *events.Message) Message {
+	base := w.makeMessage(instance, message)
+	if media, mediaType, mimetype := w.getMedia(message.Message); media != nil {
+		base.MediaType = &mediaType
+		base.Mimetype = &mimetype
+		base.MediaInfo = w.makeMediaInfo(media)
+	}
+	return base
+}
+
+// ParseEventMessage parses a message and downloads its media. When the
+// download fails, the message is still returned with its media info, so the
+// media can be downloaded later.
 func (w *whatsApp) ParseEventMessage(instance *Instance, message *events.Message) (Message, error) {
-	media, err := w.downloadMedia(
-		instance,
-		message.Message,
-	)
+	base := w.ParseEventMessageWithoutMedia(instance, message)
+	if base.MediaType == nil {
+		return base, nil
+	}
 
-	if err != nil && media == nil {
-		return Message{}, err
+	media, err := w.downloadMedia(instance, message.Message)
+	if err != nil {
+		logger.Error("Failed to download media. ", err)
+		return base, nil
 	}
 
-	text := w.getTextMessage(message.Message)
-	base := Message{
+	base.Media = &media.Data
+	return base, nil
+}
+
+func (w *whatsApp) makeMessage(instance *Instance, message *events.Message) Message {
+	return Message{
 		InstanceID: instance.ID,
-		Body:       text,
+		Body:       w.getTextMessage(message.Message),
+		Caption:    w.getCaption(message.Message),
+		Filename:   message.Message.GetDocumentMessage().GetFileName(),
 		MessageID:  message.Info.ID,
 		ChatJID:    message.Info.Chat.User,
 		SenderJID:  message.Info.Sender.User,
 		FromMe:     message.Info.MessageSource.IsFromMe,
 		Timestamp:  message.Info.Timestamp,
 	}
-
-	if media != nil && err == nil {
-		base.MediaType = &media.Type
-		base.Mimetype = &media.Mimetype
-		base.Media = &media.Data
-		return base, nil
-	}
-
-	return base, nil
 }
 
 func (w *whatsApp) createClient(deviceStore *store.Device) *whatsmeow.Client {
@@ -379,7 +505,10 @@ func (w *whatsApp) createClient(deviceStore *store.Device) *whatsmeow.Client {
 		level = "ERROR"
 	}
 	log := waLog.Stdout("Client", level, true)
-	return whatsmeow.NewClient(deviceStore, log)
+	client := whatsmeow.NewClient(deviceStore, log)
+	// reconnection is left to the connection supervisor
+	client.EnableAutoReconnect = false
+	return client
 }
 
 func (w *whatsApp) uploadMedia(instance *Instance, media *dataurl.DataURL, mediaType MediaType) (*UploadResponse, error) {
@@ -412,77 +541,40 @@ func (w *whatsApp) uploadMedia(instance *Instance, media *dataurl.DataURL, media
 }
 
 func (w *whatsApp) downloadMedia(instance *Instance, message *waProto.Message) (*DownloadResponse, error) {
-	document := message.GetDocumentMessage()
-	if document != nil {
-		data, err := instance.Client.Download(document)
-		if err != nil {
-			return &DownloadResponse{Type: Document}, err
-		}
-
-		return &DownloadResponse{
-			Data:     data,
-			Type:     Document,
-			Mimetype: document.GetMimetype(),
-		}, nil
+	media, mediaType, mimetype := w.getMedia(message)
+	if media == nil {
+		return nil, nil
 	}
 
-	audio := message.GetAudioMessage()
-	if audio != nil {
-		data, err := instance.Client.Download(audio)
-		if err != nil {
-			return &DownloadResponse{Type: Audio}, err
-		}
-
-		return &DownloadResponse{
-			Data:     data,
-			Type:     Audio,
-			Mimetype: audio.GetMimetype(),
-		}, nil
+	data, err := instance.Client.Download(media)
+	if err != nil {
+		return &DownloadResponse{Type: mediaType}, err
 	}
 
-	image := message.GetImageMessage()
-	if image != nil {
-		data, err := instance.Client.Download(image)
-		if err != nil {
-			return &DownloadResponse{Type: Image}, err
-		}
+	return &DownloadResponse{
+		Data:     data,
+		Type:     mediaType,
+		Mimetype: mimetype,
+	}, nil
+}
 
-		return &DownloadResponse{
-			Data:     data,
-			Type:     Image,
-			Mimetype: image.GetMimetype(),
-		}, nil
+func (w *whatsApp) getMedia(message *waProto.Message) (whatsmeow.DownloadableMessage, MediaType, string) {
+	if document := message.GetDocumentMessage(); document != nil {
+		return document, Document, document.GetMimetype()
 	}
-
-	sticker := message.GetStickerMessage()
-	if sticker != nil {
-		data, err := instance.Client.Download(sticker)
-		if err != nil {
-			return &DownloadResponse{Type: Sticker}, err
-		}
-
-		return &DownloadResponse{
-			Data:     data,
-			Type:     Sticker,
-			Mimetype: sticker.GetMimetype(),
-		}, nil
-	}
-
-	// video := message.GetVideoMessage()
-	// if video != nil {
-	// 	data, err := instance.Client.Download(video)
-	// 	if err != nil {
-	// 		return &DownloadResponse{Type: Video}, err
-	// 	}
-
-	// 	return &DownloadResponse{
-	// 		Data:     data,
-	// 		Type:     Video,
-	// 		Mimetype: video.GetMimetype(),
-	// 	}, nil
+	if audio := message.GetAudioMessage(); audio != nil {
+		return audio, Audio, audio.GetMimetype()
+	}
+	if image := message.GetImageMessage(); image != nil {
+		return image, Image, image.GetMimetype()
+	}
+	if sticker := message.GetStickerMessage(); sticker != nil {
+		return sticker, Sticker, sticker.GetMimetype()
+	}
+	// if video := message.GetVideoMessage(); video != nil {
+	// 	return video, Video, video.GetMimetype()
 	// }
-
-	return nil, nil
+	return nil, 0, ""
 }
 
 func (w *whatsApp) getTextMessage(message *waProto.Message) string {
@@ -493,6 +585,16 @@ func (w *whatsApp) getTextMessage(message *waProto.Message) string {
 	return message.GetConversation()
 }
 
+func (w *whatsApp) getCaption(message *waProto.Message) string {
+	if image := message.GetImageMessage(); image != nil {
+		return image.GetCaption()
+	}
+	if document := message.GetDocumentMessage(); document != nil {
+		return document.GetCaption()
+	}
+	return message.GetVideoMessage().GetCaption()
+}
+
 func (w *whatsApp) generateQrcode(instance *Instance, qrcodeHandler func(evt string, qrcode string, err error)) {
 	qrChan, err := instance.Client.GetQRChannel(context.Background())
 	if err != nil {
@@ -501,7 +603,7 @@ func (w *whatsApp) generateQrcode(instance *Instance, qrcodeHandler func(evt str
 			qrcodeHandler("error", "", errors.New(errMessage))
 		}
 	} else {
-		err = instance.Client.Connect()
+		err = w.connectUnpaired(instance)
 		if err != nil {
 			errMessage := fmt.Sprintf("Failed to connect client to WhatsApp websocket. %s", err)
 			qrcodeHandler("error", "", errors.New(errMessage))
@@ -3,6 +3,7 @@ package zapmeow
 import (
 	"sync"
 	"zapmeow/config"
+	"zapmeow/pkg/cluster"
 	"zapmeow/pkg/database"
 	"zapmeow/pkg/queue"
 	"zapmeow/pkg/whatsapp"
@@ -11,6 +12,7 @@ import (
 type ZapMeow struct {
 	Database  database.Database
 	Queue     queue.Queue
+	Cluster   cluster.Cluster
 	Config    config.Config
 	Instances *sync.Map
 	Wg        *sync.WaitGroup
@@ -21,6 +23,7 @@ type ZapMeow struct {
 func NewZapMeow(
 	database database.Database,
 	queue queue.Queue,
+	cluster cluster.Cluster,
 	config config.Config,
 	instances *sync.Map,
 	wg *sync.WaitGroup,
@@ -30,6 +33,7 @@ func NewZapMeow(
 	return &ZapMeow{
 		Database:  database,
 		Queue:     queue,
+		Cluster:   cluster,
 		Instances: instances,
 		Config:    config,
 		Wg:        wg,
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"time"
+	"zapmeow/api/service"
+	"zapmeow/pkg/cluster"
+	"zapmeow/pkg/logger"
+	"zapmeow/pkg/zapmeow"
+)
+
+type clusterWorker struct {
+	app             *zapmeow.ZapMeow
+	accountService  service.AccountService
+	whatsAppService service.WhatsAppService
+}
+
+type ClusterWorker interface {
+	Balance()
+}
+
+func NewClusterWorker(
+	app *zapmeow.ZapMeow,
+	accountService service.AccountService,
+	whatsAppService service.WhatsAppService,
+) *clusterWorker {
+	return &clusterWorker{
+		app:             app,
+		accountService:  accountService,
+		whatsAppService: whatsAppService,
+	}
+}
+
+// Balance keeps the node registered and its leases renewed, loads the paired
+// instances assigned to it, and hands over the ones assigned to another node
+// after a node joined. Instances of a node that's gone are loaded by the node
+// they're assigned to once their lease expired.
+func (w *clusterWorker) Balance() {
+	ticker := time.NewTicker(makeClusterInterval(w.app))
+	defer ticker.Stop()
+	defer w.app.Wg.Done()
+
+	for {
+		if err := w.balance(); err != nil {
+			logger.Error("Error balancing instances. ", err)
+		}
+
+		select {
+		case <-*w.app.StopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *clusterWorker) balance() error {
+	if err := w.app.Cluster.Heartbeat(); err != nil {
+		return err
+	}
+	w.renewLeases()
+
+	nodes, err := w.app.Cluster.Nodes()
+	if err != nil {
+		return err
+	}
+
+	accounts, err := w.accountService.GetConnectedAccounts()
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		assigned := cluster.Assign(nodes, account.InstanceID)
+		if assigned == nil {
+			continue
+		}
+
+		loaded := w.app.LoadInstance(account.InstanceID) != nil
+		if assigned.ID != w.app.Cluster.NodeID() {
+			// the assigned node loads it once the lease is released
+			if loaded {
+				logger.Info("Handing instance ", account.InstanceID, " over to node ", assigned.ID)
+				w.whatsAppService.UnloadInstance(account.InstanceID)
+			}
+			continue
+		}
+
+		if !loaded {
+			logger.Info("Loading instance: ", account.InstanceID)
+			_, err := w.whatsAppService.GetInstance(account.InstanceID)
+			if err != nil && err != service.ErrInstanceOwnedByAnotherNode {
+				logger.Error("Error getting instance. ", err)
+			}
+		}
+	}
+	return nil
+}
+
+// renewLeases unloads the instances whose lease was lost, e.g. after the node
+// couldn't reach Redis for longer than the lease TTL, as another node may
+// have loaded them already.
+func (w *clusterWorker) renewLeases() {
+	w.app.Instances.Range(func(key, value interface{}) bool {
+		instanceID := key.(string)
+		renewed, err := w.app.Cluster.Renew(instanceID)
+		if err != nil {
+			logger.Error("Failed to renew instance lease. ", err)
+			return true
+		}
+
+		if !renewed {
+			logger.Error("Lease of instance ", instanceID, " was lost")
+			w.whatsAppService.UnloadInstance(instanceID)
+		}
+		return true
+	})
+}
+
+// makeClusterInterval returns how often the cluster is checked. Leases are
+// renewed a few times within their TTL, so a slow tick doesn't lose them.
+func makeClusterInterval(app *zapmeow.ZapMeow) time.Duration {
+	return time.Duration(app.Config.ClusterLeaseTTL) * time.Second / 3
+}
+
+// isOwner tells whether the instance belongs to this node, so work on an
+// instance is done by a single node of the cluster.
+func isOwner(app *zapmeow.ZapMeow, instanceID string) bool {
+	owner, err := app.Cluster.Owner(instanceID)
+	if err != nil {
+		logger.Error("Error getting the node of instance ", instanceID, ". ", err)
+		return false
+	}
+	return owner != nil && owner.ID == app.Cluster.NodeID()
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/api/service"
+	"zapmeow/pkg/logger"
+	"zapmeow/pkg/whatsapp"
+	"zapmeow/pkg/zapmeow"
+)
+
+const (
+	// connectionSupervisorInterval is how often instances are checked
+	connectionSupervisorInterval = 5 * time.Second
+	reconnectBaseDelay           = 2 * time.Second
+	reconnectMaxDelay            = 5 * time.Minute
+)
+
+type connectionSupervisorWorker struct {
+	app             *zapmeow.ZapMeow
+	accountService  service.AccountService
+	whatsAppService service.WhatsAppService
+
+	mutex      sync.Mutex
+	reconnects map[string]*reconnectState
+}
+
+// reconnectState is the backoff of an instance that lost its connection.
+type reconnectState struct {
+	instance   *whatsapp.Instance
+	attempts   int
+	next       time.Time
+	connecting bool
+}
+
+type ConnectionSupervisorWorker interface {
+	Supervise()
+}
+
+func NewConnectionSupervisorWorker(
+	app *zapmeow.ZapMeow,
+	accountService service.AccountService,
+	whatsAppService service.WhatsAppService,
+) *connectionSupervisorWorker {
+	return &connectionSupervisorWorker{
+		app:             app,
+		accountService:  accountService,
+		whatsAppService: whatsAppService,
+		reconnects:      make(map[string]*reconnectState),
+	}
+}
+
+// Supervise reconnects paired instances that lost their connection, with a
+// jittered exponential backoff. Instances whose connection was replaced by
+// another client are left alone, so the two don't keep replacing each other.
+func (w *connectionSupervisorWorker) Supervise() {
+	ticker := time.NewTicker(connectionSupervisorInterval)
+	defer ticker.Stop()
+	defer w.app.Wg.Done()
+
+	for {
+		select {
+		case <-*w.app.StopCh:
+			return
+		case <-ticker.C:
+			w.superviseInstances()
+		}
+	}
+}
+
+func (w *connectionSupervisorWorker) superviseInstances() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	seen := make(map[string]bool)
+	w.app.Instances.Range(func(key, value interface{}) bool {
+		instanceID := key.(string)
+		instance := value.(*whatsapp.Instance)
+		seen[instanceID] = true
+
+		// unpaired instances connect while generating QR codes
+		if instance.Client.Store.ID == nil || instance.Client.IsConnected() {
+			if state := w.reconnects[instanceID]; state == nil || !state.connecting {
+				delete(w.reconnects, instanceID)
+			}
+			return true
+		}
+
+		state := w.reconnects[instanceID]
+		if state == nil || state.instance != instance {
+			state = &reconnectState{instance: instance, next: time.Now()}
+			w.reconnects[instanceID] = state
+		}
+
+		if state.connecting || time.Now().Before(state.next) {
+			return true
+		}
+
+		account, err := w.accountService.GetAccountByInstanceID(instanceID)
+		if err != nil {
+			logger.Error("Failed to get account. ", err)
+			return true
+		}
+		if account == nil || account.ConnectionState == model.ConnectionConflict {
+			delete(w.reconnects, instanceID)
+			return true
+		}
+
+		state.attempts++
+		state.connecting = true
+		w.app.Wg.Add(1)
+		go w.reconnect(instanceID, state)
+		return true
+	})
+
+	// instances that were deleted or logged out
+	for instanceID, state := range w.reconnects {
+		if !seen[instanceID] && !state.connecting {
+			delete(w.reconnects, instanceID)
+		}
+	}
+}
+
+func (w *connectionSupervisorWorker) reconnect(instanceID string, state *reconnectState) {
+	defer w.app.Wg.Done()
+
+	w.whatsAppService.RecordConnectionState(instanceID, model.ConnectionReconnecting, "", state.attempts)
+
+	err := w.whatsAppService.Reconnect(state.instance)
+	if err != nil {
+		logger.Error("Failed to reconnect instance ", instanceID, ". ", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	state.connecting = false
+	state.next = time.Now().Add(w.makeReconnectDelay(state.attempts))
+}
+
+// makeReconnectDelay doubles the delay with each attempt, and picks it at
+// random from its upper half so instances that dropped together don't
+// reconnect together.
+func (w *connectionSupervisorWorker) makeReconnectDelay(attempts int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempts < 20 {
+		delay = reconnectBaseDelay << (attempts - 1)
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -1,12 +1,19 @@
 package worker
 
 import (
+	"fmt"
+	"math"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 	"zapmeow/api/helper"
 	"zapmeow/api/model"
 	"zapmeow/api/queue"
+	"zapmeow/api/response"
 	"zapmeow/api/service"
+	"zapmeow/pkg/cluster"
+	"zapmeow/pkg/http"
 	"zapmeow/pkg/logger"
 	"zapmeow/pkg/whatsapp"
 	"zapmeow/pkg/zapmeow"
@@ -21,7 +28,22 @@ type historySyncWorker struct {
 	app             *zapmeow.ZapMeow
 	messageService  service.MessageService
 	accountService  service.AccountService
+	chatService     service.ChatService
 	whatsAppService service.WhatsAppService
+
+	historySyncProgressService service.HistorySyncProgressService
+	syncSettingsService        service.SyncSettingsService
+	contactService             service.ContactService
+
+	// owned holds the partitions of the queue assigned to this node
+	ownedMutex sync.RWMutex
+	owned      map[int]bool
+}
+
+// historySyncChat points at the newest imported message of a conversation.
+type historySyncChat struct {
+	messageIndex int
+	isGroup      bool
 }
 
 type HistorySyncWorker interface {
@@ -32,35 +54,153 @@ func NewHistorySyncWorker(
 	app *zapmeow.ZapMeow,
 	messageService service.MessageService,
 	accountService service.AccountService,
+	chatService service.ChatService,
 	whatsAppService service.WhatsAppService,
+	historySyncProgressService service.HistorySyncProgressService,
+	syncSettingsService service.SyncSettingsService,
+	contactService service.ContactService,
 ) *historySyncWorker {
 	return &historySyncWorker{
-		messageService:  messageService,
-		accountService:  accountService,
-		whatsAppService: whatsAppService,
-		app:             app,
+		messageService:             messageService,
+		accountService:             accountService,
+		chatService:                chatService,
+		whatsAppService:            whatsAppService,
+		historySyncProgressService: historySyncProgressService,
+		syncSettingsService:        syncSettingsService,
+		contactService:             contactService,
+		app:                        app,
 	}
 }
 
+const (
+	// historySyncDequeueTimeout bounds how long a worker blocks waiting for
+	// a history sync, and so how long it takes to notice a stop
+	historySyncDequeueTimeout = 5 * time.Second
+	historySyncRetryDelay     = 3 * time.Second
+)
+
+// ProcessQueue runs the history sync workers, each waiting on its share of
+// the partitions of the queue, and returns once all of them stopped, after
+// finishing their current item.
 func (q *historySyncWorker) ProcessQueue() {
-	queue := queue.NewHistorySyncQueue(q.app)
+	historySyncQueue := queue.NewHistorySyncQueue(q.app)
 	defer q.app.Wg.Done()
-	for {
+
+	var wg sync.WaitGroup
+	q.updateOwnedPartitions()
+	if q.app.Config.ClusterMode {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.trackOwnedPartitions()
+		}()
+	}
+
+	workers := helper.Min(q.app.Config.HistorySyncWorkers, queue.HistorySyncPartitions)
+	for worker := 0; worker < workers; worker++ {
+		var partitions []int
+		for partition := worker; partition < queue.HistorySyncPartitions; partition += workers {
+			partitions = append(partitions, partition)
+		}
+
+		wg.Add(1)
+		go func(partitions []int) {
+			defer wg.Done()
+			q.processPartitions(historySyncQueue, partitions)
+		}(partitions)
+	}
+	wg.Wait()
+}
+
+// processPartitions imports the history syncs of the partitions of a
+// worker, one at a time, waiting on all of them at once.
+func (q *historySyncWorker) processPartitions(queue queue.HistorySyncQueue, partitions []int) {
+	for round := 0; ; round++ {
 		select {
 		case <-*q.app.StopCh:
 			return
 		default:
-			if err := q.processHistorySync(queue); err != nil {
-				logger.Error("Error processing history sync. ", err)
+		}
+
+		owned := q.ownedPartitions(partitions, round)
+		if len(owned) == 0 {
+			// none of them is assigned to this node for now
+			select {
+			case <-*q.app.StopCh:
+				return
+			case <-time.After(historySyncDequeueTimeout):
 			}
+			continue
+		}
+
+		if err := q.processHistorySync(queue, owned); err != nil {
+			logger.Error("Error processing history sync. ", err)
+			time.Sleep(historySyncRetryDelay)
+		}
+	}
+}
+
+// trackOwnedPartitions updates the partitions assigned to this node as
+// often as the cluster is balanced, so workers don't look up the nodes of
+// the cluster on every dequeue.
+func (q *historySyncWorker) trackOwnedPartitions() {
+	ticker := time.NewTicker(makeClusterInterval(q.app))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-*q.app.StopCh:
+			return
+		case <-ticker.C:
+			q.updateOwnedPartitions()
+		}
+	}
+}
+
+// updateOwnedPartitions spreads the partitions over the nodes like
+// instances are, so each partition is consumed by a single node and keeps
+// its order. No partition is consumed while the nodes are unknown.
+func (q *historySyncWorker) updateOwnedPartitions() {
+	nodes, err := q.app.Cluster.Nodes()
+	if err != nil {
+		logger.Error("Error getting cluster nodes. ", err)
+		nodes = nil
+	}
+
+	owned := make(map[int]bool)
+	for partition := 0; partition < queue.HistorySyncPartitions; partition++ {
+		assigned := cluster.Assign(nodes, fmt.Sprintf("history-sync:%d", partition))
+		if assigned != nil && assigned.ID == q.app.Cluster.NodeID() {
+			owned[partition] = true
 		}
+	}
+
+	q.ownedMutex.Lock()
+	defer q.ownedMutex.Unlock()
+	q.owned = owned
+}
 
-		time.Sleep(3 * time.Second)
+// ownedPartitions returns the partitions assigned to this node, starting
+// from a different one each round, so a busy partition doesn't keep the
+// others waiting.
+func (q *historySyncWorker) ownedPartitions(partitions []int, round int) []int {
+	q.ownedMutex.RLock()
+	defer q.ownedMutex.RUnlock()
+
+	var owned []int
+	for i := range partitions {
+		partition := partitions[(round+i)%len(partitions)]
+		if q.owned[partition] {
+			owned = append(owned, partition)
+		}
 	}
+	return owned
 }
 
-func (q *historySyncWorker) processHistorySync(queue queue.HistorySyncQueue) error {
-	data, err := queue.Dequeue()
+// processHistorySync imports the next history sync of the partitions, if
+// one arrives in time.
+func (q *historySyncWorker) processHistorySync(queue queue.HistorySyncQueue, partitions []int) error {
+	data, err := queue.Dequeue(partitions, historySyncDequeueTimeout)
 	if err != nil {
 		return err
 	}
@@ -69,12 +209,26 @@ func (q *historySyncWorker) processHistorySync(queue queue.HistorySyncQueue) err
 		return nil
 	}
 
+	if err := q.importHistorySync(data); err != nil {
+		if nackErr := queue.Nack(data); nackErr != nil {
+			logger.Error("Error returning history sync to the queue. ", nackErr)
+		}
+		return err
+	}
+	return queue.Ack(data)
+}
+
+// importHistorySync may run more than once for the same data, when a failed
+// or interrupted import is delivered again, so stored messages are skipped.
+func (q *historySyncWorker) importHistorySync(data *queue.HistorySyncQueueData) error {
 	historySync, err := q.parseHistorySync(data.History)
 	if err != nil {
 		return err
 	}
 
-	instance, err := q.whatsAppService.GetInstance(data.InstanceID)
+	// messages are only parsed, so instances loaded by another node
+	// aren't connected here
+	instance, err := q.whatsAppService.GetStoredInstance(data.InstanceID)
 	if err != nil {
 		return err
 	}
@@ -84,27 +238,224 @@ func (q *historySyncWorker) processHistorySync(queue queue.HistorySyncQueue) err
 		return err
 	}
 
-	if !account.WasSynced {
+	firstSync, err := q.isFirstSync(account.InstanceID, historySync)
+	if err != nil {
+		return err
+	}
+
+	// the history of a new pairing replaces whatever was left stored
+	if firstSync {
 		if err := q.accountService.DeleteAccountMessages(account.InstanceID); err != nil {
 			return err
 		}
+	}
+
+	settings, err := q.syncSettingsService.GetSettings(account.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	messages, chats, err := q.processMessages(historySync, account, instance, settings)
+	if err != nil {
+		return err
+	}
+
+	newMessages, err := q.skipStoredMessages(account.InstanceID, messages)
+	if err != nil {
+		return err
+	}
+
+	if len(newMessages) > 0 {
+		if err := q.messageService.CreateMessages(&newMessages); err != nil {
+			return err
+		}
+	}
 
-		if err := q.accountService.UpdateAccount(account.InstanceID, map[string]interface{}{
-			"WasSynced": true,
-		}); err != nil {
+	// chats ignore messages older than their last one, so chats whose
+	// messages were already stored are left as they are
+	for _, chat := range chats {
+		if err := q.chatService.RecordHistoryMessage(&messages[chat.messageIndex], chat.isGroup); err != nil {
 			return err
 		}
 	}
 
-	messages, err := q.processMessages(historySync, account, instance)
+	if err := q.importMetadata(account.InstanceID, historySync, settings); err != nil {
+		return err
+	}
+
+	return q.recordProgress(account.InstanceID, historySync, newMessages)
+}
+
+// isFirstSync tells whether the history sync starts the history of a new
+// pairing: an initial or full sync, while no history of the pairing was
+// imported yet. The sync progress is deleted with the messages on logout, so
+// reconnecting and on-demand syncs never count as first syncs.
+func (q *historySyncWorker) isFirstSync(instanceID string, historySync *waProto.HistorySync) (bool, error) {
+	switch historySync.GetSyncType() {
+	case waProto.HistorySync_INITIAL_BOOTSTRAP, waProto.HistorySync_FULL:
+	default:
+		return false, nil
+	}
+
+	progress, err := q.historySyncProgressService.GetProgressByInstanceID(instanceID)
 	if err != nil {
+		return false, err
+	}
+
+	for _, syncProgress := range progress {
+		if syncProgress.SyncType != service.HistorySyncOnDemand && syncProgress.Chunks > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// importMetadata stores the push names, contact names and chat state sent
+// with the history, so chats are listed with their names even when none of
+// their messages were imported. On-demand syncs only bring messages.
+func (q *historySyncWorker) importMetadata(instanceID string, evt *waProto.HistorySync, settings *model.SyncSettings) error {
+	pushNames := make(map[string]string)
+	for _, pushName := range evt.GetPushnames() {
+		jid, err := types.ParseJID(pushName.GetId())
+		if err != nil || jid.Server != types.DefaultUserServer || pushName.GetPushname() == "" {
+			continue
+		}
+		pushNames[jid.User] = pushName.GetPushname()
+	}
+
+	if err := q.contactService.RecordPushNames(instanceID, pushNames); err != nil {
 		return err
 	}
 
-	if err := q.messageService.CreateMessages(&messages); err != nil {
+	if evt.GetSyncType() == waProto.HistorySync_ON_DEMAND {
+		return nil
+	}
+
+	names := make(map[string]string)
+	for _, conv := range evt.GetConversations() {
+		chatJID, err := types.ParseJID(conv.GetId())
+		if err != nil {
+			continue
+		}
+
+		isGroup := chatJID.Server == types.GroupServer
+		if !isGroup && chatJID.Server != types.DefaultUserServer {
+			continue
+		}
+
+		name := conv.GetName()
+		if name == "" {
+			name = conv.GetDisplayName()
+		}
+		if !isGroup && name != "" {
+			names[chatJID.User] = name
+		}
+
+		if !settings.Enabled || (isGroup && !settings.IncludeGroups) {
+			continue
+		}
+
+		err = q.chatService.RecordHistoryMetadata(
+			q.makeChat(instanceID, chatJID, name, conv),
+			q.makeChatSettings(instanceID, chatJID, conv),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return q.contactService.RecordNames(instanceID, names)
+}
+
+func (q *historySyncWorker) makeChat(instanceID string, chatJID types.JID, name string, conv *waProto.Conversation) *model.Chat {
+	timestamp := conv.GetLastMsgTimestamp()
+	if timestamp == 0 {
+		timestamp = conv.GetConversationTimestamp()
+	}
+
+	var lastMessageAt time.Time
+	if timestamp > 0 {
+		lastMessageAt = time.Unix(int64(timestamp), 0)
+	}
+
+	return &model.Chat{
+		InstanceID:    instanceID,
+		ChatJID:       chatJID.User,
+		Name:          name,
+		Description:   conv.GetDescription(),
+		IsGroup:       chatJID.Server == types.GroupServer,
+		LastMessageAt: lastMessageAt,
+		UnreadCount:   int(conv.GetUnreadCount()),
+	}
+}
+
+func (q *historySyncWorker) makeChatSettings(instanceID string, chatJID types.JID, conv *waProto.Conversation) *model.ChatSettings {
+	settings := &model.ChatSettings{
+		InstanceID:   instanceID,
+		ChatJID:      chatJID.User,
+		Archived:     conv.GetArchived(),
+		Pinned:       conv.GetPinned() > 0,
+		MarkedUnread: conv.GetMarkedAsUnread(),
+	}
+
+	// the mute end is in seconds, and doesn't fit an int64 when muted forever
+	muteEndTime := conv.GetMuteEndTime()
+	if muteEndTime > math.MaxInt64 {
+		settings.Muted = true
+		return settings
+	}
+
+	mutedUntil := time.Unix(int64(muteEndTime), 0)
+	if muteEndTime > 0 && mutedUntil.After(time.Now()) {
+		settings.Muted = true
+		settings.MutedUntil = &mutedUntil
+	}
+	return settings
+}
+
+// recordProgress adds the chunk to the sync progress of the instance and
+// notifies the webhook when it completes the sync. Syncs without
+// conversations, like push names, aren't tracked.
+func (q *historySyncWorker) recordProgress(instanceID string, historySync *waProto.HistorySync, newMessages []model.Message) error {
+	var syncType string
+	switch historySync.GetSyncType() {
+	case waProto.HistorySync_INITIAL_BOOTSTRAP,
+		waProto.HistorySync_RECENT,
+		waProto.HistorySync_FULL,
+		waProto.HistorySync_ON_DEMAND:
+		syncType = strings.ToLower(historySync.GetSyncType().String())
+	default:
+		return nil
+	}
+
+	conversations := make(map[string]bool)
+	for _, message := range newMessages {
+		conversations[message.ChatJID] = true
+	}
+
+	progress, completed, err := q.historySyncProgressService.RecordChunk(
+		instanceID,
+		syncType,
+		historySync.GetChunkOrder(),
+		historySync.GetProgress(),
+		len(conversations),
+		len(newMessages),
+	)
+	if err != nil {
 		return err
 	}
 
+	if completed {
+		body := map[string]interface{}{
+			"instanceId": instanceID,
+			"event":      "history_sync_completed",
+			"sync":       response.NewHistorySyncProgressResponse(*progress),
+		}
+
+		if err := http.Request(q.accountService.GetWebhookURL(instanceID), body); err != nil {
+			logger.Error("Failed to send webhook request. ", err)
+		}
+	}
 	return nil
 }
 
@@ -116,18 +467,32 @@ func (q *historySyncWorker) parseHistorySync(history []byte) (*waProto.HistorySy
 	return &data, nil
 }
 
-func (q *historySyncWorker) processMessages(evt *waProto.HistorySync, account *model.Account, instance *whatsapp.Instance) ([]model.Message, error) {
+// processMessages picks the messages to import according to the sync
+// settings of the instance. On-demand syncs were requested for the chat, so
+// they aren't limited by them.
+func (q *historySyncWorker) processMessages(
+	evt *waProto.HistorySync,
+	account *model.Account,
+	instance *whatsapp.Instance,
+	settings *model.SyncSettings,
+) ([]model.Message, []historySyncChat, error) {
 	var messages []model.Message
+	var chats []historySyncChat
+
+	onDemand := evt.GetSyncType() == waProto.HistorySync_ON_DEMAND
+	if !onDemand && !settings.Enabled {
+		return nil, nil, nil
+	}
+
+	var oldest time.Time
+	if !onDemand && settings.MaxAgeDays > 0 {
+		oldest = time.Now().AddDate(0, 0, -settings.MaxAgeDays)
+	}
 
 	for _, conv := range evt.GetConversations() {
 		chatJID, _ := types.ParseJID(conv.GetId())
 
-		count, err := q.messageService.CountChatMessages(account.InstanceID, chatJID.User)
-		if err != nil {
-			return nil, err
-		}
-
-		if count > int64(q.app.Config.MaxMessageSync) {
+		if !onDemand && !settings.IncludeGroups && chatJID.Server == types.GroupServer {
 			continue
 		}
 
@@ -136,33 +501,58 @@ func (q *historySyncWorker) processMessages(evt *waProto.HistorySync, account *m
 			continue
 		}
 
+		// remaining is how many more messages the chat may get, -1 for no limit
+		remaining := -1
+		if !onDemand && settings.MaxMessagesPerChat > 0 {
+			count, err := q.messageService.CountChatMessages(account.InstanceID, chatJID.User)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			remaining = settings.MaxMessagesPerChat - int(count)
+			if remaining <= 0 {
+				continue
+			}
+		}
+
 		eventsMessage, err := q.processConversation(conv, chatJID, instance)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		sort.Slice(eventsMessage, func(i, j int) bool {
 			return eventsMessage[i].Info.Timestamp.After(eventsMessage[j].Info.Timestamp)
 		})
 
-		maxMessages := helper.Min(q.app.Config.MaxMessageSync, len(eventsMessage))
-		slice := eventsMessage[:maxMessages]
+		slice := eventsMessage
+		if !oldest.IsZero() {
+			slice = slice[:sort.Search(len(slice), func(i int) bool {
+				return slice[i].Info.Timestamp.Before(oldest)
+			})]
+		}
+		if remaining >= 0 {
+			slice = slice[:helper.Min(remaining, len(slice))]
+		}
+
+		// messages are sorted newest first, so the first one kept is the chat's last message
+		if chatJID.Server != types.BroadcastServer {
+			chats = append(chats, historySyncChat{
+				messageIndex: len(messages),
+				isGroup:      chatJID.Server == types.GroupServer,
+			})
+		}
 
 		for _, evtMessage := range slice {
-			parsedEvtMesage, err := q.whatsAppService.ParseEventMessage(instance, evtMessage)
-			if err != nil {
-				continue
-			}
+			messages = append(messages, q.makeMessage(instance, evtMessage, settings.DownloadMedia))
+		}
 
-			message, err := q.makeMessage(instance, parsedEvtMesage)
-			if err != nil {
-				continue
-			}
-			messages = append(messages, *message)
+		// drop the chat again if none of its messages could be imported
+		if len(chats) > 0 && chats[len(chats)-1].messageIndex == len(messages) {
+			chats = chats[:len(chats)-1]
 		}
 	}
 
-	return messages, nil
+	return messages, chats, nil
 }
 
 func (q *historySyncWorker) processConversation(conv *waProto.Conversation, chatJID types.JID, instance *whatsapp.Instance) ([]*events.Message, error) {
@@ -177,7 +567,12 @@ func (q *historySyncWorker) processConversation(conv *waProto.Conversation, chat
 	return eventsMessage, nil
 }
 
-func (q *historySyncWorker) makeMessage(instance *whatsapp.Instance, parsedMessage whatsapp.Message) (*model.Message, error) {
+// makeMessage never downloads media, so a large history doesn't hold up the
+// queue. The media info is stored instead, and the media is downloaded when
+// the message is first read.
+func (q *historySyncWorker) makeMessage(instance *whatsapp.Instance, evtMessage *events.Message, downloadMedia bool) model.Message {
+	parsedMessage := q.whatsAppService.ParseEventMessageWithoutMedia(instance, evtMessage)
+
 	message := model.Message{
 		SenderJID:  parsedMessage.SenderJID,
 		ChatJID:    parsedMessage.ChatJID,
@@ -185,24 +580,43 @@ func (q *historySyncWorker) makeMessage(instance *whatsapp.Instance, parsedMessa
 		MessageID:  parsedMessage.MessageID,
 		Timestamp:  parsedMessage.Timestamp,
 		Body:       parsedMessage.Body,
+		Caption:    parsedMessage.Caption,
+		Filename:   parsedMessage.Filename,
 		FromMe:     parsedMessage.FromMe,
 	}
 
 	if parsedMessage.MediaType != nil {
-		path, err := helper.SaveMedia(
-			instance.ID,
-			parsedMessage.MessageID,
-			*parsedMessage.Media,
-			*parsedMessage.Mimetype,
-		)
-
-		if err != nil {
-			return nil, err
+		message.MediaType = parsedMessage.MediaType.String()
+		message.MediaMimetype = *parsedMessage.Mimetype
+		// without download, the message keeps its media type but can't get a file
+		if downloadMedia {
+			helper.SetMessageMediaInfo(&message, parsedMessage.MediaInfo)
 		}
+	}
 
-		message.MediaType = parsedMessage.MediaType.String()
-		message.MediaPath = path
+	return message
+}
+
+// skipStoredMessages leaves out the messages already stored.
+func (q *historySyncWorker) skipStoredMessages(instanceID string, messages []model.Message) ([]model.Message, error) {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.MessageID)
+	}
+
+	stored, err := q.messageService.GetStoredMessageIDs(instanceID, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) == 0 {
+		return messages, nil
 	}
 
-	return &message, nil
+	var newMessages []model.Message
+	for _, message := range messages {
+		if !stored[message.MessageID] {
+			newMessages = append(newMessages, message)
+		}
+	}
+	return newMessages, nil
 }
@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"os"
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/api/service"
+	"zapmeow/pkg/logger"
+	"zapmeow/pkg/zapmeow"
+)
+
+type mediaRetentionWorker struct {
+	app                    *zapmeow.ZapMeow
+	messageService         service.MessageService
+	retentionPolicyService service.RetentionPolicyService
+}
+
+type MediaRetentionWorker interface {
+	ProcessRetention()
+}
+
+func NewMediaRetentionWorker(
+	app *zapmeow.ZapMeow,
+	messageService service.MessageService,
+	retentionPolicyService service.RetentionPolicyService,
+) *mediaRetentionWorker {
+	return &mediaRetentionWorker{
+		app:                    app,
+		messageService:         messageService,
+		retentionPolicyService: retentionPolicyService,
+	}
+}
+
+func (w *mediaRetentionWorker) ProcessRetention() {
+	ticker := time.NewTicker(time.Duration(w.app.Config.MediaRetentionInterval) * time.Minute)
+	defer ticker.Stop()
+	defer w.app.Wg.Done()
+
+	for {
+		if err := w.applyPolicies(); err != nil {
+			logger.Error("Error applying media retention policies. ", err)
+		}
+
+		select {
+		case <-*w.app.StopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyPolicies runs every policy independently, so when a type-specific
+// policy and an all-types policy overlap, the stricter limit wins. In cluster
+// mode, the policies of an instance are applied by the node that owns it.
+func (w *mediaRetentionWorker) applyPolicies() error {
+	policies, err := w.retentionPolicyService.GetPolicies()
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		if !isOwner(w.app, policy.InstanceID) {
+			continue
+		}
+
+		if err := w.applyMaxAge(policy); err != nil {
+			logger.Error("Error expiring media by age of instance ", policy.InstanceID, ". ", err)
+		}
+		if err := w.applyMaxSize(policy); err != nil {
+			logger.Error("Error expiring media by size of instance ", policy.InstanceID, ". ", err)
+		}
+	}
+	return nil
+}
+
+func (w *mediaRetentionWorker) applyMaxAge(policy model.RetentionPolicy) error {
+	if policy.MaxAgeDays <= 0 {
+		return nil
+	}
+
+	before := time.Now().AddDate(0, 0, -policy.MaxAgeDays)
+	messages, err := w.messageService.GetMediaMessages(policy.InstanceID, policy.MediaType, before)
+	if err != nil {
+		return err
+	}
+	return w.expire(policy, messages)
+}
+
+// applyMaxSize keeps the newest media that fits in the quota and expires the
+// rest. A blob shared by several messages counts once, and files that are
+// already gone count as nothing and are expired too.
+func (w *mediaRetentionWorker) applyMaxSize(policy model.RetentionPolicy) error {
+	if policy.MaxSizeBytes <= 0 {
+		return nil
+	}
+
+	messages, err := w.messageService.GetMediaMessages(policy.InstanceID, policy.MediaType, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	var expired []model.Message
+	// keep tells, per file, whether it fits in the quota
+	keep := make(map[string]bool)
+	for _, message := range messages {
+		kept, counted := keep[message.MediaPath]
+		if !counted {
+			info, err := os.Stat(message.MediaPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				total += info.Size()
+				kept = total <= policy.MaxSizeBytes
+			}
+			keep[message.MediaPath] = kept
+		}
+
+		if !kept {
+			expired = append(expired, message)
+		}
+	}
+	return w.expire(policy, expired)
+}
+
+func (w *mediaRetentionWorker) expire(policy model.RetentionPolicy, messages []model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if err := w.messageService.ExpireMessagesMedia(messages); err != nil {
+		return err
+	}
+
+	logger.Info("Expired ", len(messages), " media files of instance ", policy.InstanceID)
+	return nil
+}
@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"zapmeow/api/model"
+	"zapmeow/api/response"
+	"zapmeow/api/service"
+	"zapmeow/pkg/http"
+	"zapmeow/pkg/logger"
+	"zapmeow/pkg/ratelimit"
+	"zapmeow/pkg/zapmeow"
+)
+
+const (
+	// sendJobInterval is how often due send jobs are looked for
+	sendJobInterval       = time.Second
+	sendJobRetryBaseDelay = 10 * time.Second
+	sendJobRetryMaxDelay  = 5 * time.Minute
+	// completeJobAttempts is how many times marking a sent job as completed
+	// is tried, as the job is sent again once its claim expires
+	completeJobAttempts = 3
+)
+
+type sendJobWorker struct {
+	app             *zapmeow.ZapMeow
+	accountService  service.AccountService
+	whatsAppService service.WhatsAppService
+	sendService     service.SendService
+	sendJobService  service.SendJobService
+
+	// sending holds the instances whose jobs are being sent
+	mutex   sync.Mutex
+	sending map[string]bool
+}
+
+type SendJobWorker interface {
+	ProcessJobs()
+}
+
+func NewSendJobWorker(
+	app *zapmeow.ZapMeow,
+	accountService service.AccountService,
+	whatsAppService service.WhatsAppService,
+	sendService service.SendService,
+	sendJobService service.SendJobService,
+) *sendJobWorker {
+	return &sendJobWorker{
+		app:             app,
+		accountService:  accountService,
+		whatsAppService: whatsAppService,
+		sendService:     sendService,
+		sendJobService:  sendJobService,
+		sending:         make(map[string]bool),
+	}
+}
+
+// ProcessJobs sends the messages enqueued with async=true. The jobs of an
+// instance are sent one at a time and in order, by the node that owns the
+// instance, while different instances are sent in parallel.
+func (w *sendJobWorker) ProcessJobs() {
+	ticker := time.NewTicker(sendJobInterval)
+	defer ticker.Stop()
+	defer w.app.Wg.Done()
+
+	for {
+		select {
+		case <-*w.app.StopCh:
+			return
+		case <-ticker.C:
+			w.startInstances()
+		}
+	}
+}
+
+func (w *sendJobWorker) startInstances() {
+	jobs, err := w.sendJobService.GetNextJobs()
+	if err != nil {
+		logger.Error("Error getting send jobs. ", err)
+		return
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if job.NextAttemptAt.After(now) || !isOwner(w.app, job.InstanceID) {
+			continue
+		}
+
+		w.mutex.Lock()
+		if w.sending[job.InstanceID] {
+			w.mutex.Unlock()
+			continue
+		}
+		w.sending[job.InstanceID] = true
+		w.mutex.Unlock()
+
+		w.app.Wg.Add(1)
+		go w.sendJobs(job.InstanceID)
+	}
+}
+
+// sendJobs sends the due jobs of the instance until one has to wait.
+func (w *sendJobWorker) sendJobs(instanceID string) {
+	defer w.app.Wg.Done()
+	defer func() {
+		w.mutex.Lock()
+		delete(w.sending, instanceID)
+		w.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case <-*w.app.StopCh:
+			return
+		default:
+		}
+
+		job, err := w.sendJobService.GetNextJob(instanceID)
+		if err != nil {
+			logger.Error("Error getting send job. ", err)
+			return
+		}
+
+		if job == nil || job.NextAttemptAt.After(time.Now()) {
+			return
+		}
+
+		visibilityTimeout := time.Duration(w.app.Config.QueueVisibilityTimeout) * time.Second
+		claimed, err := w.sendJobService.ClaimJob(job, time.Now().Add(visibilityTimeout))
+		if err != nil {
+			logger.Error("Error claiming send job. ", err)
+			return
+		}
+
+		if !claimed {
+			return
+		}
+
+		w.processJob(job)
+	}
+}
+
+func (w *sendJobWorker) completeJob(job *model.SendJob, sent *model.Message) {
+	for attempt := 1; ; attempt++ {
+		err := w.sendJobService.CompleteJob(job, sent)
+		if err == nil {
+			return
+		}
+		logger.Error("Error completing send job. ", err)
+		if attempt == completeJobAttempts {
+			return
+		}
+		time.Sleep(sendJobInterval)
+	}
+}
+
+// processJob sends the job, retrying it later when it failed. Waiting for
+// the rate limits of the instance, or being interrupted by a shutdown while
+// waiting, doesn't count as a failed attempt.
+func (w *sendJobWorker) processJob(job *model.SendJob) {
+	sent, err := w.send(job)
+	if err == nil {
+		w.completeJob(job, sent)
+		w.notify(job)
+		return
+	}
+
+	var limitErr *ratelimit.Error
+	switch {
+	case errors.As(err, &limitErr):
+		err = w.sendJobService.RetryJob(job, time.Now().Add(limitErr.RetryAfter), false, err)
+	case errors.Is(err, service.ErrShuttingDown):
+		err = w.sendJobService.RetryJob(job, time.Now(), false, err)
+	case errors.Is(err, service.ErrInvalidMessage),
+		errors.Is(err, service.ErrInstanceNotFound),
+		job.Attempts+1 >= w.app.Config.QueueMaxDeliveries:
+		logger.Error("Send job ", job.ID, " of instance ", job.InstanceID, " failed. ", err)
+		err = w.sendJobService.FailJob(job, err)
+		w.notify(job)
+	default:
+		err = w.sendJobService.RetryJob(job, time.Now().Add(w.makeRetryDelay(job.Attempts+1)), true, err)
+	}
+	if err != nil {
+		logger.Error("Error updating send job. ", err)
+	}
+}
+
+func (w *sendJobWorker) send(job *model.SendJob) (*model.Message, error) {
+	message, err := w.sendJobService.ParseMessage(job)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := w.whatsAppService.GetInstance(job.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.sendService.Send(context.Background(), instance, message)
+}
+
+func (w *sendJobWorker) notify(job *model.SendJob) {
+	body := map[string]interface{}{
+		"instanceId": job.InstanceID,
+		"event":      "send_job",
+		"job":        response.NewSendJobResponse(*job),
+	}
+
+	if err := http.Request(w.accountService.GetWebhookURL(job.InstanceID), body); err != nil {
+		logger.Error("Failed to send webhook request. ", err)
+	}
+}
+
+func (w *sendJobWorker) makeRetryDelay(attempts int) time.Duration {
+	if attempts >= 10 {
+		return sendJobRetryMaxDelay
+	}
+
+	delay := sendJobRetryBaseDelay << (attempts - 1)
+	if delay > sendJobRetryMaxDelay {
+		delay = sendJobRetryMaxDelay
+	}
+	return delay
+}